@@ -1,6 +1,8 @@
 CREATE TABLE sessions (
     id INT AUTO_INCREMENT PRIMARY KEY,
     seed BIGINT NOT NULL,
+    master_seed BIGINT NOT NULL DEFAULT 0,
+    session_index INT NOT NULL DEFAULT 0,
     program_version VARCHAR(255) NOT NULL,
     host VARCHAR(255) NOT NULL,
     k JSON NOT NULL,
@@ -11,11 +13,57 @@ CREATE TABLE sessions (
     data_size INT NOT NULL,
     tpm_type VARCHAR(255) NOT NULL,
     learn_rule VARCHAR(255) NOT NULL,
+    boundary_mode VARCHAR(255) NOT NULL DEFAULT 'CLIP',
+    learn_layers VARCHAR(255) NOT NULL DEFAULT 'ALL',
+    learn_step INT NOT NULL DEFAULT 1,
+    learn_probability DOUBLE NOT NULL DEFAULT 1,
+    learn_units INT NOT NULL DEFAULT 0,
+    field_mode VARCHAR(255) NOT NULL DEFAULT 'FAST',
+    zero_field VARCHAR(255) NOT NULL DEFAULT 'NEGATIVE',
+    query_field DOUBLE NOT NULL DEFAULT 0,
+    connectivity JSON,
+    fan_in INT NOT NULL DEFAULT 0,
+    wiring_seed BIGINT NOT NULL DEFAULT 0,
+    window_size INT NOT NULL DEFAULT 0,
+    stride INT NOT NULL DEFAULT 0,
+    window_wrap BOOLEAN NOT NULL DEFAULT FALSE,
     start_time DATETIME NOT NULL,
     end_time DATETIME NOT NULL,
     status VARCHAR(255) NOT NULL,
     stimulate_iterations INT NOT NULL,
     learn_iterations INT NOT NULL,
     initial_state JSON NOT NULL,
-    final_state JSON NOT NULL
+    final_state JSON NOT NULL,
+    attack_type VARCHAR(255) NOT NULL DEFAULT 'NONE',
+    attack_learn_rule VARCHAR(255) NOT NULL DEFAULT '',
+    attacker_count INT NOT NULL DEFAULT 0,
+    population_cap INT NOT NULL DEFAULT 0,
+    mutation_count INT NOT NULL DEFAULT 0,
+    attacker_synced BOOLEAN NOT NULL DEFAULT FALSE,
+    attacker_sync_iteration INT NOT NULL DEFAULT -1,
+    attacker_peak_population INT NOT NULL DEFAULT 0,
+    sync_criterion VARCHAR(255) NOT NULL DEFAULT 'EXACT_WEIGHTS',
+    sync_threshold DOUBLE NOT NULL DEFAULT 0,
+    sync_consecutive_outputs INT NOT NULL DEFAULT 0,
+    abort_on_attacker_sync BOOLEAN NOT NULL DEFAULT FALSE,
+    kdf VARCHAR(255) NOT NULL DEFAULT 'HKDF-SHA256',
+    key_bits INT NOT NULL DEFAULT 256,
+    key_fingerprint CHAR(64) NOT NULL DEFAULT '',
+    distinct_weights INT NOT NULL DEFAULT 0,
+    keys_match BOOLEAN NOT NULL DEFAULT FALSE,
+    channel_flip_probability DOUBLE NOT NULL DEFAULT 0,
+    channel_burst_probability DOUBLE NOT NULL DEFAULT 0,
+    channel_burst_length INT NOT NULL DEFAULT 0,
+    channel_drop_probability DOUBLE NOT NULL DEFAULT 0,
+    channel_errors INT NOT NULL DEFAULT 0,
+    party_count INT NOT NULL DEFAULT 2,
+    group_topology VARCHAR(255) NOT NULL DEFAULT 'PAIR',
+    group_messages INT NOT NULL DEFAULT 0,
+    output_classes INT NOT NULL DEFAULT 0,
+    stimulus_generator VARCHAR(255) NOT NULL DEFAULT 'UNIFORM',
+    stimulus_sigma DOUBLE NOT NULL DEFAULT 0,
+    stimulus_bias DOUBLE NOT NULL DEFAULT 0,
+    overlap_50_iteration INT NOT NULL DEFAULT -1,
+    overlap_90_iteration INT NOT NULL DEFAULT -1,
+    overlap_99_iteration INT NOT NULL DEFAULT -1
 );
\ No newline at end of file
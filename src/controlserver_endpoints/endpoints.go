@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"strings"
 	"time"
 	"tpm_sync/tpm_controllers"
+	"tpm_sync/tpm_stimHandlers"
 
 	"github.com/joho/godotenv"
 	"github.com/sourcegraph/conc/pool"
@@ -27,12 +30,7 @@ func main() {
 	welcomeMessage := " -  -  TPM Control Server V2  -  - "
 	fmt.Println(welcomeMessage)
 
-	dbController, err := tpm_controllers.NewDatabaseController(
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"))
+	dbController, err := tpm_controllers.NewSessionStorage()
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -51,7 +49,7 @@ func main() {
 
 	simController := tpm_controllers.SimulationController{
 		SyncController:     tpm_controllers.SyncController{},
-		DatabaseController: *dbController,
+		DatabaseController: dbController,
 		WorkerPool:         workerPool,
 	}
 
@@ -79,6 +77,18 @@ func main() {
 		getIterationHistogram(w, r, dbController)
 	})
 
+	http.HandleFunc("/attackSuccessRate", func(w http.ResponseWriter, r *http.Request) {
+		getAttackSuccessRate(w, r, dbController)
+	})
+
+	http.HandleFunc("/replay", func(w http.ResponseWriter, r *http.Request) {
+		replaySessionHandler(w, r, &simController)
+	})
+
+	http.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		listCapabilitiesHandler(w, r, simController.SyncController)
+	})
+
 	http.HandleFunc("/events", realTimeSessionHandler)
 	http.HandleFunc("/get-config", settingsByUidHandler)
 
@@ -219,6 +229,76 @@ func realTimeSessionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func replaySessionHandler(w http.ResponseWriter, r *http.Request, simController *tpm_controllers.SimulationController) {
+	sessionId, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid session id", http.StatusBadRequest)
+		return
+	}
+	tableName := r.FormValue("table")
+	if tableName == "" {
+		tableName = os.Getenv("DB_NAME")
+	}
+
+	replayChannel := make(chan tpm_controllers.SessionStateMessage)
+	err = simController.ReplaySession(tableName, sessionId, replayChannel)
+	if err != nil {
+		fmt.Println("Error while replaying session: ", err)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+		case errors.Is(err, tpm_controllers.ErrInvalidStoredSettings):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	// The replay keeps sending until it ends, drain whatever is left if we stop reading early so it doesn't block forever
+	defer func() {
+		go func() {
+			for range replayChannel {
+			}
+		}()
+	}()
+
+	// Set http headers required for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// You may need this locally for CORS requests
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Create a channel for client disconnection
+	clientGone := r.Context().Done()
+
+	rc := http.NewResponseController(w)
+
+	for {
+		select {
+		case <-clientGone:
+			return
+		case currentState, ok := <-replayChannel:
+			if !ok {
+				return
+			}
+			parsedState, err := json.Marshal(currentState)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", parsedState)
+			if err != nil {
+				return
+			}
+			err = rc.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
 func settingsByUidHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.FormValue("id")
 	var session tpm_controllers.OpenSession
@@ -255,7 +335,7 @@ type GraphRequestBody struct {
 	TableName string `json:"TableName"`
 }
 
-func get3DGraphHandler(w http.ResponseWriter, r *http.Request, dbController *tpm_controllers.DatabaseController) {
+func get3DGraphHandler(w http.ResponseWriter, r *http.Request, dbController tpm_controllers.SessionStorage) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
@@ -310,13 +390,49 @@ func get3DGraphHandler(w http.ResponseWriter, r *http.Request, dbController *tpm
 }
 
 type NewNoOverlapRequestBody struct {
-	N               []int
-	K_last          int
-	L               int
-	M               int
-	Rule            string
-	MaxSessionCount int
-	MaxIterations   int
+	N                       []int
+	K_last                  int
+	L                       int
+	M                       int
+	Rule                    string
+	MaxSessionCount         int
+	MaxIterations           int
+	MasterSeed              int64
+	AttackType              string
+	AttackLearnRule         string
+	AttackerCount           int
+	PopulationCap           int
+	MutationCount           int
+	SyncCriterion           string
+	SyncThreshold           float64
+	SyncConsecutiveOutputs  int
+	AbortOnAttackerSync     bool
+	Kdf                     string
+	KeyBits                 int
+	ChannelFlipProbability  float64
+	ChannelBurstProbability float64
+	ChannelBurstLength      int
+	ChannelDropProbability  float64
+	PartyCount              int
+	GroupTopology           string
+	OutputClasses           int
+	StimulusGenerator       string
+	StimulusSigma           float64
+	StimulusBias            float64
+	BoundaryMode            string
+	LearnLayers             string
+	LearnStep               int
+	LearnProbability        float64
+	LearnUnits              int
+	FieldMode               string
+	ZeroField               string
+	Kernel                  string
+	QueryField              float64
+	FanIn                   int
+	WiringSeed              int64
+	Window                  int
+	Stride                  int
+	WindowWrap              bool
 }
 
 func createNewNoOverlapSession(w http.ResponseWriter, r *http.Request, simController *tpm_controllers.SimulationController) {
@@ -334,22 +450,85 @@ func createNewNoOverlapSession(w http.ResponseWriter, r *http.Request, simContro
 		return
 	}
 
-	tpmInstanceSettings, err := simController.SyncController.SettingsFactory(requestBody.N, requestBody.K_last, requestBody.L, requestBody.M, "NO_OVERLAP", requestBody.Rule)
-	if err != nil {
-		fmt.Println("Error while creating settings for an instance: ", err)
-		http.Error(w, "Error while creating settings for an instance", http.StatusInternalServerError)
-
-		return
-	}
-
 	baseSettings := tpm_controllers.BaseSettings{
 		TpmType:         "NO_OVERLAP",
 		MaxSessionCount: requestBody.MaxSessionCount,
 		MaxIterations:   requestBody.MaxIterations,
 		MaxWorkerCount:  1,
-		LearnRules:      []string{requestBody.Rule},
-		MConfigs:        []int{requestBody.M},
-		LConfigs:        []int{requestBody.L},
+		MasterSeed:      requestBody.MasterSeed,
+		Kernel:          requestBody.Kernel,
+		AttackSettings: tpm_controllers.AttackSettings{
+			AttackType:      requestBody.AttackType,
+			AttackLearnRule: requestBody.AttackLearnRule,
+			AttackerCount:   requestBody.AttackerCount,
+			PopulationCap:   requestBody.PopulationCap,
+			MutationCount:   requestBody.MutationCount,
+		},
+		SyncSettings: tpm_controllers.SyncSettings{
+			SyncCriterion:          requestBody.SyncCriterion,
+			SyncThreshold:          requestBody.SyncThreshold,
+			SyncConsecutiveOutputs: requestBody.SyncConsecutiveOutputs,
+			AbortOnAttackerSync:    requestBody.AbortOnAttackerSync,
+		},
+		KeySettings: tpm_controllers.KeySettings{
+			Kdf:     requestBody.Kdf,
+			KeyBits: requestBody.KeyBits,
+		},
+		ChannelSettings: tpm_controllers.ChannelSettings{
+			ChannelFlipProbability:  requestBody.ChannelFlipProbability,
+			ChannelBurstProbability: requestBody.ChannelBurstProbability,
+			ChannelBurstLength:      requestBody.ChannelBurstLength,
+			ChannelDropProbability:  requestBody.ChannelDropProbability,
+		},
+		GroupSettings: tpm_controllers.GroupSettings{
+			PartyCount:    requestBody.PartyCount,
+			GroupTopology: requestBody.GroupTopology,
+		},
+		VariantSettings: tpm_controllers.VariantSettings{
+			OutputClasses: requestBody.OutputClasses,
+		},
+		StimulusSettings: tpm_controllers.StimulusSettings{
+			StimulusGenerator: requestBody.StimulusGenerator,
+			StimulusSigma:     requestBody.StimulusSigma,
+			StimulusBias:      requestBody.StimulusBias,
+		},
+		NumericsSettings: tpm_controllers.NumericsSettings{
+			FieldMode: requestBody.FieldMode,
+			ZeroField: requestBody.ZeroField,
+		},
+		LearnRules:         []string{requestBody.Rule},
+		BoundaryModes:      []string{requestBody.BoundaryMode},
+		LearnLayers:        requestBody.LearnLayers,
+		LearnSteps:         []int{requestBody.LearnStep},
+		LearnProbabilities: []float64{requestBody.LearnProbability},
+		LearnUnitConfigs:   []int{requestBody.LearnUnits},
+		QueryFields:        []float64{requestBody.QueryField},
+		FanInConfigs:       []int{requestBody.FanIn},
+		WiringSeeds:        []int64{requestBody.WiringSeed},
+		WindowConfigs:      []int{requestBody.Window},
+		StrideConfigs:      []int{requestBody.Stride},
+		WindowWrap:         requestBody.WindowWrap,
+		MConfigs:           []int{requestBody.M},
+		LConfigs:           []int{requestBody.L},
+	}
+
+	tpmInstanceSettings, err := simController.SyncController.SweepSettingsFactory(tpm_controllers.SweepInstance{
+		K:              requestBody.N,
+		N0:             requestBody.K_last,
+		L:              requestBody.L,
+		M:              requestBody.M,
+		LearnRule:      requestBody.Rule,
+		BoundaryMode:   requestBody.BoundaryMode,
+		QueryField:     requestBody.QueryField,
+		SparseSettings: tpm_controllers.SparseSettings{FanIn: requestBody.FanIn, WiringSeed: requestBody.WiringSeed},
+		WindowSettings: tpm_controllers.WindowSettings{Window: requestBody.Window, Stride: requestBody.Stride, WindowWrap: requestBody.WindowWrap},
+		LearnSettings:  tpm_controllers.LearnSettings{LearnStep: requestBody.LearnStep, LearnProbability: requestBody.LearnProbability, LearnUnits: requestBody.LearnUnits},
+	}, baseSettings)
+	if err != nil {
+		fmt.Println("Error while creating settings for an instance: ", err)
+		http.Error(w, "Error while creating settings for an instance", http.StatusInternalServerError)
+
+		return
 	}
 
 	newSessionToken := simController.SimulateOnDemand(sessionMap, tpmInstanceSettings, baseSettings)
@@ -366,14 +545,51 @@ func createNewNoOverlapSession(w http.ResponseWriter, r *http.Request, simContro
 }
 
 type NewOverlapRequestBody struct {
-	K               []int
-	N_0             int
-	L               int
-	M               int
-	Rule            string
-	MaxSessionCount int
-	MaxIterations   int
-	Scenario        string
+	K                       []int
+	N_0                     int
+	L                       int
+	M                       int
+	Rule                    string
+	MaxSessionCount         int
+	MaxIterations           int
+	MasterSeed              int64
+	AttackType              string
+	AttackLearnRule         string
+	AttackerCount           int
+	PopulationCap           int
+	MutationCount           int
+	SyncCriterion           string
+	SyncThreshold           float64
+	SyncConsecutiveOutputs  int
+	AbortOnAttackerSync     bool
+	Kdf                     string
+	KeyBits                 int
+	ChannelFlipProbability  float64
+	ChannelBurstProbability float64
+	ChannelBurstLength      int
+	ChannelDropProbability  float64
+	PartyCount              int
+	GroupTopology           string
+	OutputClasses           int
+	StimulusGenerator       string
+	StimulusSigma           float64
+	StimulusBias            float64
+	BoundaryMode            string
+	LearnLayers             string
+	LearnStep               int
+	LearnProbability        float64
+	LearnUnits              int
+	FieldMode               string
+	ZeroField               string
+	Kernel                  string
+	QueryField              float64
+	FanIn                   int
+	WiringSeed              int64
+	Window                  int
+	Stride                  int
+	WindowWrap              bool
+	Connectivity            *tpm_stimHandlers.Connectivity
+	Scenario                string
 }
 
 func createNewOverlapSession(w http.ResponseWriter, r *http.Request, simController *tpm_controllers.SimulationController) {
@@ -391,22 +607,86 @@ func createNewOverlapSession(w http.ResponseWriter, r *http.Request, simControll
 		return
 	}
 
-	tpmInstanceSettings, err := simController.SyncController.SettingsFactory(requestBody.K, requestBody.N_0, requestBody.L, requestBody.M, requestBody.Scenario, requestBody.Rule)
-	if err != nil {
-		fmt.Println("Error while creating settings for an instance: ", err)
-		http.Error(w, "Error while creating settings for an instance", http.StatusInternalServerError)
-
-		return
-	}
-
 	baseSettings := tpm_controllers.BaseSettings{
 		TpmType:         requestBody.Scenario,
 		MaxSessionCount: requestBody.MaxSessionCount,
 		MaxIterations:   requestBody.MaxIterations,
 		MaxWorkerCount:  1,
-		LearnRules:      []string{requestBody.Rule},
-		MConfigs:        []int{requestBody.M},
-		LConfigs:        []int{requestBody.L},
+		MasterSeed:      requestBody.MasterSeed,
+		Kernel:          requestBody.Kernel,
+		Connectivity:    requestBody.Connectivity,
+		AttackSettings: tpm_controllers.AttackSettings{
+			AttackType:      requestBody.AttackType,
+			AttackLearnRule: requestBody.AttackLearnRule,
+			AttackerCount:   requestBody.AttackerCount,
+			PopulationCap:   requestBody.PopulationCap,
+			MutationCount:   requestBody.MutationCount,
+		},
+		SyncSettings: tpm_controllers.SyncSettings{
+			SyncCriterion:          requestBody.SyncCriterion,
+			SyncThreshold:          requestBody.SyncThreshold,
+			SyncConsecutiveOutputs: requestBody.SyncConsecutiveOutputs,
+			AbortOnAttackerSync:    requestBody.AbortOnAttackerSync,
+		},
+		KeySettings: tpm_controllers.KeySettings{
+			Kdf:     requestBody.Kdf,
+			KeyBits: requestBody.KeyBits,
+		},
+		ChannelSettings: tpm_controllers.ChannelSettings{
+			ChannelFlipProbability:  requestBody.ChannelFlipProbability,
+			ChannelBurstProbability: requestBody.ChannelBurstProbability,
+			ChannelBurstLength:      requestBody.ChannelBurstLength,
+			ChannelDropProbability:  requestBody.ChannelDropProbability,
+		},
+		GroupSettings: tpm_controllers.GroupSettings{
+			PartyCount:    requestBody.PartyCount,
+			GroupTopology: requestBody.GroupTopology,
+		},
+		VariantSettings: tpm_controllers.VariantSettings{
+			OutputClasses: requestBody.OutputClasses,
+		},
+		StimulusSettings: tpm_controllers.StimulusSettings{
+			StimulusGenerator: requestBody.StimulusGenerator,
+			StimulusSigma:     requestBody.StimulusSigma,
+			StimulusBias:      requestBody.StimulusBias,
+		},
+		NumericsSettings: tpm_controllers.NumericsSettings{
+			FieldMode: requestBody.FieldMode,
+			ZeroField: requestBody.ZeroField,
+		},
+		LearnRules:         []string{requestBody.Rule},
+		BoundaryModes:      []string{requestBody.BoundaryMode},
+		LearnLayers:        requestBody.LearnLayers,
+		LearnSteps:         []int{requestBody.LearnStep},
+		LearnProbabilities: []float64{requestBody.LearnProbability},
+		LearnUnitConfigs:   []int{requestBody.LearnUnits},
+		QueryFields:        []float64{requestBody.QueryField},
+		FanInConfigs:       []int{requestBody.FanIn},
+		WiringSeeds:        []int64{requestBody.WiringSeed},
+		WindowConfigs:      []int{requestBody.Window},
+		StrideConfigs:      []int{requestBody.Stride},
+		WindowWrap:         requestBody.WindowWrap,
+		MConfigs:           []int{requestBody.M},
+		LConfigs:           []int{requestBody.L},
+	}
+
+	tpmInstanceSettings, err := simController.SyncController.SweepSettingsFactory(tpm_controllers.SweepInstance{
+		K:              requestBody.K,
+		N0:             requestBody.N_0,
+		L:              requestBody.L,
+		M:              requestBody.M,
+		LearnRule:      requestBody.Rule,
+		BoundaryMode:   requestBody.BoundaryMode,
+		QueryField:     requestBody.QueryField,
+		SparseSettings: tpm_controllers.SparseSettings{FanIn: requestBody.FanIn, WiringSeed: requestBody.WiringSeed},
+		WindowSettings: tpm_controllers.WindowSettings{Window: requestBody.Window, Stride: requestBody.Stride, WindowWrap: requestBody.WindowWrap},
+		LearnSettings:  tpm_controllers.LearnSettings{LearnStep: requestBody.LearnStep, LearnProbability: requestBody.LearnProbability, LearnUnits: requestBody.LearnUnits},
+	}, baseSettings)
+	if err != nil {
+		fmt.Println("Error while creating settings for an instance: ", err)
+		http.Error(w, "Error while creating settings for an instance", http.StatusInternalServerError)
+
+		return
 	}
 
 	newSessionToken := simController.SimulateOnDemand(sessionMap, tpmInstanceSettings, baseSettings)
@@ -433,7 +713,7 @@ type SuccessIterationCorrelationRequestBody struct {
 	MinDataSize     int
 }
 
-func getIterationHistogram(w http.ResponseWriter, r *http.Request, dbController *tpm_controllers.DatabaseController) {
+func getIterationHistogram(w http.ResponseWriter, r *http.Request, dbController tpm_controllers.SessionStorage) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
@@ -457,3 +737,49 @@ func getIterationHistogram(w http.ResponseWriter, r *http.Request, dbController
 	json.NewEncoder(w).Encode(response)
 
 }
+
+type AttackSuccessRateRequestBody struct {
+	TableName string
+}
+
+func getAttackSuccessRate(w http.ResponseWriter, r *http.Request, dbController tpm_controllers.SessionStorage) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Decode the incoming JSON request body into the RequestBody struct
+	var requestBody AttackSuccessRateRequestBody
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&requestBody)
+	if err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	successRates, err := dbController.QueryAttackSuccessRate(requestBody.TableName)
+	if err != nil {
+		fmt.Println("Error while querying attack success rate")
+		fmt.Println(err)
+		http.Error(w, "Error while querying attack success rate", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string][]tpm_controllers.AttackSuccessData{
+		"success_rates": successRates,
+	}
+	json.NewEncoder(w).Encode(response)
+
+}
+
+// listCapabilitiesHandler serves the learn rules and TPM types that can be picked, with their descriptions and parameters
+func listCapabilitiesHandler(w http.ResponseWriter, r *http.Request, syncController tpm_controllers.SyncController) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(syncController.ListCapabilities())
+}
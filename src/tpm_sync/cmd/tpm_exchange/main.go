@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"tpm_sync/tpm_controllers"
+	"tpm_sync/tpm_exchange"
+)
+
+const usage = `usage:
+  tpm_exchange server [-addr :9000] [-seed 0] [-timeout 30s]
+  tpm_exchange client [-addr localhost:9000] [-seed 0] [-timeout 30s] [-k 3] [-n0 10] [-l 3] [-m 1]
+                      [-type FULLY_CONNECTED] [-rule HEBBIAN] [-outputs 40] [-max 0] [-kdf HKDF-SHA256] [-bits 256]`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "server":
+		err = runServer(os.Args[2:])
+	case "client":
+		err = runClient(os.Args[2:])
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+func runServer(args []string) error {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	addr := flags.String("addr", ":9000", "address to listen on")
+	seed := flags.Int64("seed", 0, "seed of the weights of B, 0 picks one from the clock")
+	timeout := flags.Duration("timeout", 30*time.Second, "deadline of every message")
+	flags.Parse(args)
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	fmt.Println("Listening on", listener.Addr(), "with seed", *seed)
+
+	exchangeController := tpm_controllers.ExchangeController{SyncController: tpm_controllers.SyncController{}, Timeout: *timeout}
+	results := make(chan tpm_controllers.ExchangeResult)
+	go func() {
+		for result := range results {
+			printResult(result)
+		}
+	}()
+	return exchangeController.Listen(listener, *seed, results)
+}
+
+func runClient(args []string) error {
+	flags := flag.NewFlagSet("client", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:9000", "address of the server")
+	seed := flags.Int64("seed", 0, "seed of the weights of A and the stimulus seeds, 0 picks one from the clock")
+	timeout := flags.Duration("timeout", 30*time.Second, "deadline of every message")
+	k := flags.String("k", "3", "comma separated K of every layer, or N of every layer for NO_OVERLAP")
+	n0 := flags.Int("n0", 10, "N of the first layer, or K of the last layer for NO_OVERLAP")
+	l := flags.Int("l", 3, "weight bound")
+	m := flags.Int("m", 1, "stimulus bound")
+	tpmType := flags.String("type", "FULLY_CONNECTED", "FULLY_CONNECTED, PARTIALLY_CONNECTED or NO_OVERLAP")
+	rule := flags.String("rule", "HEBBIAN", "HEBBIAN, ANTI-HEBBIAN or RANDOM-WALK")
+	outputs := flags.Int("outputs", 40, "matching outputs in a row needed to stop")
+	maxIterations := flags.Int("max", 0, "iteration limit, 0 means none")
+	kdf := flags.String("kdf", "HKDF-SHA256", "KDF used on the weights")
+	keyBits := flags.Int("bits", 256, "length of the derived key")
+	flags.Parse(args)
+
+	K, err := parseIntList(*k)
+	if err != nil {
+		return err
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	hello := tpm_exchange.HelloMessage{
+		K:                  K,
+		N0:                 *n0,
+		L:                  *l,
+		M:                  *m,
+		TpmType:            *tpmType,
+		LearnRule:          *rule,
+		ConsecutiveOutputs: *outputs,
+		MaxIterations:      *maxIterations,
+		Kdf:                *kdf,
+		KeyBits:            *keyBits,
+	}
+
+	conn, err := net.DialTimeout("tcp", *addr, *timeout)
+	if err != nil {
+		return err
+	}
+	exchangeController := tpm_controllers.ExchangeController{SyncController: tpm_controllers.SyncController{}, Timeout: *timeout}
+	result, err := exchangeController.RunClient(conn, hello, *seed)
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	return nil
+}
+
+func parseIntList(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid list %q: %v", list, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func printResult(result tpm_controllers.ExchangeResult) {
+	encoded, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fmt.Println("Error while encoding the result:", err)
+		return
+	}
+	fmt.Println(string(encoded))
+}
@@ -0,0 +1,151 @@
+package tpm_attacks
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_stimHandlers"
+)
+
+// TPMAttackHandler is an eavesdropper that only sees the public stimulus and the outputs exchanged by A and B
+type TPMAttackHandler interface {
+	AttackIteration(stimulus [][]int, output_a int, output_b int)
+	CompareWeights(weights_a [][][]int) bool
+	AttackState(weights_a [][][]int) AttackState
+}
+
+// AttackState is what gets tracked from the attackers, the overlap of each attacker network with A
+// and the most attacker networks that were alive at the same time
+type AttackState struct {
+	Overlaps       []float64
+	PeakPopulation int
+}
+
+// TPMNetwork is the public structure of the TPMs, the attacker is assumed to know it
+type TPMNetwork struct {
+	H                  int
+	K                  []int
+	N                  []int
+	L                  int
+	StimulationHandler tpm_stimHandlers.TPMStimulationHandlers
+	LearnRuleHandlers  []tpm_learnRules.TPMLearnRuleHandler //One per layer
+	LayerSelection     tpm_learnRules.TPMLayerSelection
+	Numerics           tpm_core.Numerics //Needs its own Rand, apart from the parties, when zero fields are random
+}
+
+// AttackerTPM is a single attacker network and the state of its last stimulation
+type AttackerTPM struct {
+	Weights_E        [][][]int
+	Outputs_E        [][]int
+	fields_e         [][]float64
+	layer_stimulus_e [][][]int
+}
+
+func NewAttackerTPM(network TPMNetwork, localRand *rand.Rand) *AttackerTPM {
+	weights_e := make([][][]int, network.H)
+	for layer := 0; layer < network.H; layer++ {
+		weights_e[layer] = tpm_core.CreateRandomLayerWeightsArray(network.K[layer], network.N[layer], network.L, localRand)
+	}
+
+	return &AttackerTPM{
+		Weights_E:        weights_e,
+		Outputs_E:        make([][]int, network.H),
+		fields_e:         make([][]float64, network.H),
+		layer_stimulus_e: make([][][]int, network.H),
+	}
+}
+
+// Stimulate runs the stimulus through every layer of the attacker and returns its output
+func (network TPMNetwork) Stimulate(tpm *AttackerTPM, stimulus [][]int) int {
+	tpm.layer_stimulus_e[0] = stimulus
+	return network.stimulateFromLayer(tpm, 0)
+}
+
+// stimulateFromLayer recalculates the outputs from a layer onwards, the stimulus of that layer must be already set
+func (network TPMNetwork) stimulateFromLayer(tpm *AttackerTPM, firstLayer int) int {
+	last := network.H - 1
+	for layer := firstLayer; layer < last; layer++ {
+		tpm.Outputs_E[layer], tpm.fields_e[layer] = network.Numerics.StimulateLayerWithFields(tpm.layer_stimulus_e[layer], tpm.Weights_E[layer], network.K[layer], network.N[layer])
+		tpm.layer_stimulus_e[layer+1] = network.StimulationHandler.CreateStimulusFromLayerOutput(tpm.Outputs_E, layer+1, network.K[layer+1], network.N[layer+1])
+	}
+	if firstLayer <= last {
+		tpm.Outputs_E[last], tpm.fields_e[last] = network.Numerics.StimulateLayerWithFields(tpm.layer_stimulus_e[last], tpm.Weights_E[last], network.K[last], network.N[last])
+	}
+	return tpm_core.Thau(tpm.Outputs_E[last], network.K[last])
+}
+
+// Learn applies the learn rules to the layers that A and B would learn, the attacker learns towards the output of A
+func (network TPMNetwork) Learn(tpm *AttackerTPM, output_a int, output_b int) {
+	for layer := 0; layer < network.H; layer++ {
+		if !network.LayerSelection.LearnsLayer(tpm.Outputs_E, layer, output_a) {
+			continue
+		}
+		network.LearnRuleHandlers[layer].TPMLearnLayer(network.K[layer], network.N[layer], network.L, tpm.Weights_E[layer], tpm.layer_stimulus_e[layer], tpm.Outputs_E[layer], output_a, output_b)
+	}
+}
+
+func (network TPMNetwork) CompareWeights(tpm *AttackerTPM, weights_a [][][]int) bool {
+	return tpm_core.CompareWeights(network.H, network.K, network.N, weights_a, tpm.Weights_E)
+}
+
+func (network TPMNetwork) Overlap(tpm *AttackerTPM, weights_a [][][]int) float64 {
+	return tpm_core.NetworkOverlap(network.H, network.K, network.N, weights_a, tpm.Weights_E)
+}
+
+// hiddenUnit is a neuron of any layer, with the |local field| it had on the last stimulation
+type hiddenUnit struct {
+	layer int
+	i     int
+	field float64
+}
+
+// sortedHiddenUnits lists the hidden units of every layer, from the least to the most confident
+func (network TPMNetwork) sortedHiddenUnits(tpm *AttackerTPM) []hiddenUnit {
+	var units []hiddenUnit
+	for layer := 0; layer < network.H; layer++ {
+		for i := 0; i < network.K[layer]; i++ {
+			units = append(units, hiddenUnit{layer: layer, i: i, field: math.Abs(tpm.fields_e[layer][i])})
+		}
+	}
+	sort.SliceStable(units, func(a, b int) bool {
+		return units[a].field < units[b].field
+	})
+	return units
+}
+
+// GeometricCorrection flips the hidden unit with the smallest |local field| whose flip makes the attacker output the target.
+// Flipping a unit of a hidden layer changes the stimulus of the next layers, so those are stimulated again before checking the output.
+// Returns false if no single flip reaches the target, in that case the attacker is left as it was.
+func (network TPMNetwork) GeometricCorrection(tpm *AttackerTPM, target int) bool {
+	last := network.H - 1
+	for _, unit := range network.sortedHiddenUnits(tpm) {
+		if unit.layer == last {
+			//The last layer goes straight into tau, flipping any of its units always flips the output
+			tpm.Outputs_E[last][unit.i] *= -1
+			return true
+		}
+
+		savedOutputs := make([][]int, network.H-unit.layer)
+		savedFields := make([][]float64, network.H-unit.layer)
+		savedStimulus := make([][][]int, network.H-unit.layer)
+		copy(savedOutputs, tpm.Outputs_E[unit.layer:])
+		copy(savedFields, tpm.fields_e[unit.layer:])
+		copy(savedStimulus, tpm.layer_stimulus_e[unit.layer:])
+
+		flipped := make([]int, network.K[unit.layer])
+		copy(flipped, tpm.Outputs_E[unit.layer])
+		flipped[unit.i] *= -1
+		tpm.Outputs_E[unit.layer] = flipped
+		tpm.layer_stimulus_e[unit.layer+1] = network.StimulationHandler.CreateStimulusFromLayerOutput(tpm.Outputs_E, unit.layer+1, network.K[unit.layer+1], network.N[unit.layer+1])
+		if network.stimulateFromLayer(tpm, unit.layer+1) == target {
+			return true
+		}
+
+		copy(tpm.Outputs_E[unit.layer:], savedOutputs)
+		copy(tpm.fields_e[unit.layer:], savedFields)
+		copy(tpm.layer_stimulus_e[unit.layer:], savedStimulus)
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package tpm_attacks
+
+import (
+	"container/heap"
+	"math/rand"
+	"tpm_sync/tpm_core"
+)
+
+// GeneticAttack keeps a population of attacker networks. While there is room, every member is replaced by variants
+// that learn with the internal representations closest to its own that agree with A and B. Once the population
+// would go over the cap, the members whose output disagrees are pruned instead.
+type GeneticAttack struct {
+	network        TPMNetwork
+	populationCap  int
+	mutationCount  int
+	Population     []*AttackerTPM
+	PeakPopulation int
+}
+
+func NewGeneticAttack(network TPMNetwork, populationCap int, mutationCount int, localRand *rand.Rand) *GeneticAttack {
+	return &GeneticAttack{
+		network:        network,
+		populationCap:  populationCap,
+		mutationCount:  mutationCount,
+		Population:     []*AttackerTPM{NewAttackerTPM(network, localRand)},
+		PeakPopulation: 1,
+	}
+}
+
+func (attack *GeneticAttack) AttackIteration(stimulus [][]int, output_a int, output_b int) {
+	outputs_e := make([]int, len(attack.Population))
+	for i, member := range attack.Population {
+		outputs_e[i] = attack.network.Stimulate(member, stimulus)
+	}
+	if output_a != output_b {
+		return
+	}
+
+	if len(attack.Population)*attack.mutationCount <= attack.populationCap {
+		nextPopulation := make([]*AttackerTPM, 0, len(attack.Population)*attack.mutationCount)
+		for _, member := range attack.Population {
+			for _, flips := range attack.network.closestVariants(member, output_a, attack.mutationCount) {
+				variant := member.clone()
+				attack.network.applyFlips(variant, flips)
+				attack.network.Learn(variant, output_a, output_b)
+				nextPopulation = append(nextPopulation, variant)
+			}
+		}
+		attack.Population = nextPopulation
+	} else {
+		var survivors []*AttackerTPM
+		for i, member := range attack.Population {
+			if outputs_e[i] == output_a {
+				survivors = append(survivors, member)
+			}
+		}
+		//If everyone disagrees, correct them instead of losing the whole population
+		if len(survivors) == 0 {
+			for _, member := range attack.Population {
+				attack.network.GeometricCorrection(member, output_a)
+			}
+			survivors = attack.Population
+		}
+		for _, member := range survivors {
+			attack.network.Learn(member, output_a, output_b)
+		}
+		attack.Population = survivors
+	}
+
+	if len(attack.Population) > attack.PeakPopulation {
+		attack.PeakPopulation = len(attack.Population)
+	}
+}
+
+// CompareWeights is true when any member of the population has the same weights as A
+func (attack *GeneticAttack) CompareWeights(weights_a [][][]int) bool {
+	for _, member := range attack.Population {
+		if attack.network.CompareWeights(member, weights_a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (attack *GeneticAttack) AttackState(weights_a [][][]int) AttackState {
+	overlaps := make([]float64, len(attack.Population))
+	for i, member := range attack.Population {
+		overlaps[i] = attack.network.Overlap(member, weights_a)
+	}
+	return AttackState{Overlaps: overlaps, PeakPopulation: attack.PeakPopulation}
+}
+
+// clone copies the weights of the member, the outputs and stimulus of the last stimulation are shared until they are replaced
+func (tpm *AttackerTPM) clone() *AttackerTPM {
+	weights := make([][][]int, len(tpm.Weights_E))
+	for layer := range tpm.Weights_E {
+		weights[layer] = make([][]int, len(tpm.Weights_E[layer]))
+		for i := range tpm.Weights_E[layer] {
+			weights[layer][i] = make([]int, len(tpm.Weights_E[layer][i]))
+			copy(weights[layer][i], tpm.Weights_E[layer][i])
+		}
+	}
+	cloned := tpm.representation()
+	cloned.Weights_E = weights
+	return cloned
+}
+
+// representation is the member with its own outputs, fields and stimulus of the last stimulation, but the same weights.
+// The layers are shared until they are replaced, so it's enough to try flips on
+func (tpm *AttackerTPM) representation() *AttackerTPM {
+	copied := &AttackerTPM{
+		Weights_E:        tpm.Weights_E,
+		Outputs_E:        make([][]int, len(tpm.Outputs_E)),
+		fields_e:         make([][]float64, len(tpm.fields_e)),
+		layer_stimulus_e: make([][][]int, len(tpm.layer_stimulus_e)),
+	}
+	copy(copied.Outputs_E, tpm.Outputs_E)
+	copy(copied.fields_e, tpm.fields_e)
+	copy(copied.layer_stimulus_e, tpm.layer_stimulus_e)
+	return copied
+}
+
+// applyFlips sets the internal representation of a variant and returns its output. The flips are applied layer by layer:
+// like in GeometricCorrection, the layers after a flipped one are stimulated again from the flipped outputs, and the flips of
+// those layers are applied to the outputs they get. So every layer holds what the forward pass of the variant gives it
+func (network TPMNetwork) applyFlips(tpm *AttackerTPM, flips []hiddenUnit) int {
+	last := network.H - 1
+	if len(flips) == 0 {
+		return tpm_core.Thau(tpm.Outputs_E[last], network.K[last])
+	}
+	firstLayer := network.H
+	flipsByLayer := make([][]int, network.H)
+	for _, unit := range flips {
+		flipsByLayer[unit.layer] = append(flipsByLayer[unit.layer], unit.i)
+		if unit.layer < firstLayer {
+			firstLayer = unit.layer
+		}
+	}
+	for layer := firstLayer; layer <= last; layer++ {
+		if layer > firstLayer {
+			tpm.Outputs_E[layer], tpm.fields_e[layer] = network.Numerics.StimulateLayerWithFields(tpm.layer_stimulus_e[layer], tpm.Weights_E[layer], network.K[layer], network.N[layer])
+		}
+		if len(flipsByLayer[layer]) > 0 {
+			//The outputs of the first layer can still be shared with the member the variant was cloned from
+			flipped := make([]int, network.K[layer])
+			copy(flipped, tpm.Outputs_E[layer])
+			for _, i := range flipsByLayer[layer] {
+				flipped[i] *= -1
+			}
+			tpm.Outputs_E[layer] = flipped
+		}
+		if layer < last {
+			tpm.layer_stimulus_e[layer+1] = network.StimulationHandler.CreateStimulusFromLayerOutput(tpm.Outputs_E, layer+1, network.K[layer+1], network.N[layer+1])
+		}
+	}
+	return tpm_core.Thau(tpm.Outputs_E[last], network.K[last])
+}
+
+// closestVariants enumerates the sets of hidden units to flip, from the smallest sum of |local field| up, and returns the first
+// count sets that make the attacker output the target. Units of any layer can be flipped, every layer is a hidden representation.
+// When only the last layer is flipped the parity of the flips says if the output changes, otherwise the flips are tried with
+// applyFlips, since the layers after a flipped one are stimulated again
+func (network TPMNetwork) closestVariants(tpm *AttackerTPM, target int, count int) [][]hiddenUnit {
+	last := network.H - 1
+	units := network.sortedHiddenUnits(tpm)
+	output_e := tpm_core.Thau(tpm.Outputs_E[last], network.K[last])
+
+	var variants [][]hiddenUnit
+	candidates := &flipSetHeap{{}}
+	for candidates.Len() > 0 && len(variants) < count {
+		candidate := heap.Pop(candidates).(flipSet)
+
+		flips := make([]hiddenUnit, len(candidate.units))
+		onlyLastLayer := true
+		for i, index := range candidate.units {
+			flips[i] = units[index]
+			onlyLastLayer = onlyLastLayer && units[index].layer == last
+		}
+		if onlyLastLayer {
+			if (len(flips)%2 == 1) == (output_e != target) {
+				variants = append(variants, flips)
+			}
+		} else if network.applyFlips(tpm.representation(), flips) == target {
+			variants = append(variants, flips)
+		}
+
+		//Every subset is reached once, either by adding the next unit or by swapping the highest one for the next unit
+		next := len(units)
+		if len(candidate.units) > 0 {
+			next = candidate.units[len(candidate.units)-1] + 1
+		} else if len(units) > 0 {
+			next = 0
+		}
+		if next < len(units) {
+			added := append(append([]int{}, candidate.units...), next)
+			heap.Push(candidates, flipSet{units: added, cost: candidate.cost + units[next].field})
+			if len(candidate.units) > 0 {
+				swapped := append([]int{}, candidate.units...)
+				swapped[len(swapped)-1] = next
+				heap.Push(candidates, flipSet{units: swapped, cost: candidate.cost - units[next-1].field + units[next].field})
+			}
+		}
+	}
+	return variants
+}
+
+// flipSet is a set of indexes of the sorted hidden units, ordered by the sum of their |local field|
+type flipSet struct {
+	units []int
+	cost  float64
+}
+
+type flipSetHeap []flipSet
+
+func (h flipSetHeap) Len() int            { return len(h) }
+func (h flipSetHeap) Less(i, j int) bool  { return h[i].cost < h[j].cost }
+func (h flipSetHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *flipSetHeap) Push(x interface{}) { *h = append(*h, x.(flipSet)) }
+func (h *flipSetHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,63 @@
+package tpm_attacks
+
+import (
+	"math/rand"
+	"testing"
+	"tpm_sync/tpm_core"
+)
+
+// TestGeneticVariantsAreConsistent checks that the representation of every variant is its own forward pass, apart from the flipped
+// units, and that its output is the target
+func TestGeneticVariantsAreConsistent(t *testing.T) {
+	network := testNetwork()
+	localRand := rand.New(rand.NewSource(3))
+	last := network.H - 1
+	for trial := 0; trial < 50; trial++ {
+		member := NewAttackerTPM(network, localRand)
+		stimulus := tpm_core.CreateRandomStimulusArray(network.K[0], network.N[0], 1, localRand)
+		network.Stimulate(member, stimulus)
+		for _, target := range []int{-1, 1} {
+			variants := network.closestVariants(member, target, 6)
+			if len(variants) == 0 {
+				t.Fatalf("trial %d: no variant reaches %d", trial, target)
+			}
+			for _, flips := range variants {
+				variant := member.clone()
+				if output := network.applyFlips(variant, flips); output != target {
+					t.Errorf("trial %d: variant %v outputs %d, want %d", trial, flips, output, target)
+				}
+				if tau := tpm_core.Thau(variant.Outputs_E[last], network.K[last]); tau != target {
+					t.Errorf("trial %d: variant %v has tau %d, want %d", trial, flips, tau, target)
+				}
+				flipped := make([]map[int]bool, network.H)
+				for layer := range flipped {
+					flipped[layer] = map[int]bool{}
+				}
+				for _, unit := range flips {
+					flipped[unit.layer][unit.i] = true
+				}
+				for layer := 1; layer < network.H; layer++ {
+					layerStimulus := network.StimulationHandler.CreateStimulusFromLayerOutput(variant.Outputs_E, layer, network.K[layer], network.N[layer])
+					outputs := network.Numerics.StimulateLayer(layerStimulus, variant.Weights_E[layer], network.K[layer], network.N[layer])
+					for i, output := range outputs {
+						if flipped[layer][i] {
+							output *= -1
+						}
+						if output != variant.Outputs_E[layer][i] {
+							t.Errorf("trial %d: variant %v has unit %d of layer %d at %d, its forward pass gives %d", trial, flips, i, layer, variant.Outputs_E[layer][i], output)
+						}
+					}
+				}
+			}
+			//The member itself must not change while its variants are tried
+			for layer := range member.Outputs_E {
+				outputs := network.Numerics.StimulateLayer(member.layer_stimulus_e[layer], member.Weights_E[layer], network.K[layer], network.N[layer])
+				for i := range outputs {
+					if outputs[i] != member.Outputs_E[layer][i] {
+						t.Fatalf("trial %d: trying variants changed unit %d of layer %d of the member", trial, i, layer)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package tpm_attacks
+
+import (
+	"math/rand"
+)
+
+// GeometricAttack is a single eavesdropper TPM that, when its output disagrees with A and B,
+// flips the hidden unit closest to changing its output before learning
+type GeometricAttack struct {
+	network  TPMNetwork
+	Attacker *AttackerTPM
+}
+
+func NewGeometricAttack(network TPMNetwork, localRand *rand.Rand) *GeometricAttack {
+	return &GeometricAttack{
+		network:  network,
+		Attacker: NewAttackerTPM(network, localRand),
+	}
+}
+
+func (attack *GeometricAttack) AttackIteration(stimulus [][]int, output_a int, output_b int) {
+	output_e := attack.network.Stimulate(attack.Attacker, stimulus)
+	if output_a != output_b {
+		return
+	}
+	if output_e != output_a && !attack.network.GeometricCorrection(attack.Attacker, output_a) {
+		return
+	}
+	attack.network.Learn(attack.Attacker, output_a, output_b)
+}
+
+func (attack *GeometricAttack) CompareWeights(weights_a [][][]int) bool {
+	return attack.network.CompareWeights(attack.Attacker, weights_a)
+}
+
+func (attack *GeometricAttack) AttackState(weights_a [][][]int) AttackState {
+	return AttackState{Overlaps: []float64{attack.network.Overlap(attack.Attacker, weights_a)}, PeakPopulation: 1}
+}
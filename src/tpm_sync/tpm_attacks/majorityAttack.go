@@ -0,0 +1,81 @@
+package tpm_attacks
+
+import (
+	"math/rand"
+	"tpm_sync/tpm_core"
+)
+
+// MajorityAttack is an ensemble of geometric attackers, after correcting their outputs every attacker learns
+// with the majority vote of the hidden units, so the ensemble moves together
+type MajorityAttack struct {
+	network   TPMNetwork
+	Attackers []*AttackerTPM
+}
+
+// NewMajorityAttack creates one attacker per random stream, so each one starts from different weights
+func NewMajorityAttack(network TPMNetwork, localRands []*rand.Rand) *MajorityAttack {
+	attackers := make([]*AttackerTPM, len(localRands))
+	for i, localRand := range localRands {
+		attackers[i] = NewAttackerTPM(network, localRand)
+	}
+	return &MajorityAttack{
+		network:   network,
+		Attackers: attackers,
+	}
+}
+
+func (attack *MajorityAttack) AttackIteration(stimulus [][]int, output_a int, output_b int) {
+	for _, attacker := range attack.Attackers {
+		output_e := attack.network.Stimulate(attacker, stimulus)
+		if output_a == output_b && output_e != output_a {
+			attack.network.GeometricCorrection(attacker, output_a)
+		}
+	}
+	if output_a != output_b {
+		return
+	}
+
+	//Vote layer by layer, the stimulus of the next layer comes from the voted outputs
+	majorityStimulus := stimulus
+	majorityLayers := make([][]int, attack.network.H)
+	for layer := 0; layer < attack.network.H; layer++ {
+		majorityOutputs := make([]int, attack.network.K[layer])
+		for i := 0; i < attack.network.K[layer]; i++ {
+			votes := 0
+			for _, attacker := range attack.Attackers {
+				votes += attacker.Outputs_E[layer][i]
+			}
+			majorityOutputs[i] = tpm_core.OutputSigma(float64(votes))
+		}
+		for _, attacker := range attack.Attackers {
+			attacker.layer_stimulus_e[layer] = majorityStimulus
+			attacker.Outputs_E[layer] = majorityOutputs
+		}
+		majorityLayers[layer] = majorityOutputs
+		if layer < attack.network.H-1 {
+			majorityStimulus = attack.network.StimulationHandler.CreateStimulusFromLayerOutput(majorityLayers, layer+1, attack.network.K[layer+1], attack.network.N[layer+1])
+		}
+	}
+
+	for _, attacker := range attack.Attackers {
+		attack.network.Learn(attacker, output_a, output_b)
+	}
+}
+
+// CompareWeights is true when any of the attackers has the same weights as A
+func (attack *MajorityAttack) CompareWeights(weights_a [][][]int) bool {
+	for _, attacker := range attack.Attackers {
+		if attack.network.CompareWeights(attacker, weights_a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (attack *MajorityAttack) AttackState(weights_a [][][]int) AttackState {
+	overlaps := make([]float64, len(attack.Attackers))
+	for i, attacker := range attack.Attackers {
+		overlaps[i] = attack.network.Overlap(attacker, weights_a)
+	}
+	return AttackState{Overlaps: overlaps, PeakPopulation: len(attack.Attackers)}
+}
@@ -0,0 +1,65 @@
+package tpm_attacks
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_stimHandlers"
+)
+
+// testNetwork is a two layer network, K and N are small enough for the attackers to learn on most iterations
+func testNetwork() TPMNetwork {
+	k := []int{4, 2}
+	n, _ := tpm_stimHandlers.FullConnectionTPM{}.CreateStimulationStructure(k, 8)
+	return TPMNetwork{
+		H:                  len(k),
+		K:                  k,
+		N:                  n,
+		L:                  3,
+		StimulationHandler: tpm_stimHandlers.FullConnectionTPM{},
+		LayerSelection:     tpm_learnRules.AllLayers{},
+	}
+}
+
+// stochasticRules are learn rules that skip half of the updates, decided by skips
+func stochasticRules(h int, skips *tpm_learnRules.UpdateSkips) []tpm_learnRules.TPMLearnRuleHandler {
+	rules := make([]tpm_learnRules.TPMLearnRuleHandler, h)
+	for layer := range rules {
+		rules[layer] = tpm_learnRules.HebbianLearnRule{Params: tpm_learnRules.Params{Step: 1, Probability: 0.5, Layer: layer, Skips: skips}}
+	}
+	return rules
+}
+
+// TestMajorityAttackersAreIndependentOfTheirOrder checks that the stochastic rules skip the same updates for every attacker,
+// so the ensemble ends the same whatever order the attackers are in
+func TestMajorityAttackersAreIndependentOfTheirOrder(t *testing.T) {
+	network := testNetwork()
+	skips := tpm_learnRules.NewUpdateSkips(99)
+	network.LearnRuleHandlers = stochasticRules(network.H, skips)
+	const attackers = 3
+	newAttack := func(order []int) *MajorityAttack {
+		localRands := make([]*rand.Rand, attackers)
+		for position, attacker := range order {
+			localRands[position] = rand.New(rand.NewSource(int64(attacker + 1)))
+		}
+		return NewMajorityAttack(network, localRands)
+	}
+	inOrder := newAttack([]int{0, 1, 2})
+	reversed := newAttack([]int{2, 1, 0})
+
+	localRand := rand.New(rand.NewSource(5))
+	for iteration := 0; iteration < 200; iteration++ {
+		skips.SetIteration(iteration)
+		stimulus := tpm_core.CreateRandomStimulusArray(network.K[0], network.N[0], 1, localRand)
+		output := 2*localRand.Intn(2) - 1
+		inOrder.AttackIteration(stimulus, output, output)
+		reversed.AttackIteration(stimulus, output, output)
+	}
+	for position := 0; position < attackers; position++ {
+		if !reflect.DeepEqual(inOrder.Attackers[position].Weights_E, reversed.Attackers[attackers-1-position].Weights_E) {
+			t.Errorf("attacker %d learned differently when the attackers were reversed", position)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tpm_attacks
+
+import (
+	"math/rand"
+)
+
+// SimpleAttack is a single eavesdropper TPM that learns only when its output agrees with both A and B
+type SimpleAttack struct {
+	network  TPMNetwork
+	Attacker *AttackerTPM
+}
+
+func NewSimpleAttack(network TPMNetwork, localRand *rand.Rand) *SimpleAttack {
+	return &SimpleAttack{
+		network:  network,
+		Attacker: NewAttackerTPM(network, localRand),
+	}
+}
+
+func (attack *SimpleAttack) AttackIteration(stimulus [][]int, output_a int, output_b int) {
+	output_e := attack.network.Stimulate(attack.Attacker, stimulus)
+	if output_a == output_b && output_e == output_a {
+		attack.network.Learn(attack.Attacker, output_a, output_b)
+	}
+}
+
+func (attack *SimpleAttack) CompareWeights(weights_a [][][]int) bool {
+	return attack.network.CompareWeights(attack.Attacker, weights_a)
+}
+
+func (attack *SimpleAttack) AttackState(weights_a [][][]int) AttackState {
+	return AttackState{Overlaps: []float64{attack.network.Overlap(attack.Attacker, weights_a)}, PeakPopulation: 1}
+}
@@ -0,0 +1,70 @@
+package tpm_channels
+
+import "math/rand"
+
+// TPMChannel carries the output of one party to the other, delivered is false when the message was dropped
+type TPMChannel interface {
+	Transmit(tau int) (received int, delivered bool)
+	Errors() int //Messages that were flipped or dropped so far
+}
+
+// PerfectChannel delivers every output intact
+type PerfectChannel struct{}
+
+// NoisyChannel flips outputs independently with FlipProbability, starts bursts of BurstLength flipped outputs with BurstProbability
+// and drops outputs with DropProbability
+type NoisyChannel struct {
+	FlipProbability  float64
+	BurstProbability float64
+	BurstLength      int
+	DropProbability  float64
+	localRand        *rand.Rand
+	burstLeft        int
+	errors           int
+}
+
+func NewNoisyChannel(flipProbability float64, burstProbability float64, burstLength int, dropProbability float64, localRand *rand.Rand) *NoisyChannel {
+	return &NoisyChannel{
+		FlipProbability:  flipProbability,
+		BurstProbability: burstProbability,
+		BurstLength:      burstLength,
+		DropProbability:  dropProbability,
+		localRand:        localRand,
+	}
+}
+
+func (channel PerfectChannel) Transmit(tau int) (int, bool) {
+	return tau, true
+}
+
+func (channel PerfectChannel) Errors() int {
+	return 0
+}
+
+func (channel *NoisyChannel) Transmit(tau int) (int, bool) {
+	if channel.localRand.Float64() < channel.DropProbability {
+		channel.errors++
+		return 0, false
+	}
+
+	flip := false
+	if channel.burstLeft > 0 {
+		flip = true
+		channel.burstLeft--
+	} else if channel.localRand.Float64() < channel.BurstProbability {
+		flip = true
+		channel.burstLeft = channel.BurstLength - 1
+	} else if channel.localRand.Float64() < channel.FlipProbability {
+		flip = true
+	}
+
+	if flip {
+		channel.errors++
+		return -tau, true
+	}
+	return tau, true
+}
+
+func (channel *NoisyChannel) Errors() int {
+	return channel.errors
+}
@@ -0,0 +1,109 @@
+package tpm_channels
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// transmitted sends count outputs of 1 through channel and returns what was flipped and dropped, in order
+func transmitted(channel TPMChannel, count int) (flipped []bool, dropped []bool) {
+	flipped = make([]bool, count)
+	dropped = make([]bool, count)
+	for i := 0; i < count; i++ {
+		received, delivered := channel.Transmit(1)
+		dropped[i] = !delivered
+		flipped[i] = delivered && received == -1
+	}
+	return flipped, dropped
+}
+
+func count(events []bool) int {
+	count := 0
+	for _, event := range events {
+		if event {
+			count++
+		}
+	}
+	return count
+}
+
+func rate(events []bool) float64 {
+	return float64(count(events)) / float64(len(events))
+}
+
+func TestNoisyChannelRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		flip     float64
+		drop     float64
+		wantFlip float64
+		wantDrop float64
+	}{
+		{"flips", 0.1, 0, 0.1, 0},
+		{"drops", 0, 0.2, 0, 0.2},
+		//Only delivered outputs can flip
+		{"flips and drops", 0.1, 0.2, 0.08, 0.2},
+		{"no noise", 0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channel := NewNoisyChannel(test.flip, 0, 0, test.drop, rand.New(rand.NewSource(1)))
+			flipped, dropped := transmitted(channel, 100000)
+			if got := rate(flipped); math.Abs(got-test.wantFlip) > 0.005 {
+				t.Errorf("flipped %v of the outputs, want %v", got, test.wantFlip)
+			}
+			if got := rate(dropped); math.Abs(got-test.wantDrop) > 0.005 {
+				t.Errorf("dropped %v of the outputs, want %v", got, test.wantDrop)
+			}
+			if want := count(flipped) + count(dropped); channel.Errors() != want {
+				t.Errorf("Errors() = %d, want the %d flipped or dropped outputs", channel.Errors(), want)
+			}
+		})
+	}
+}
+
+// TestNoisyChannelBursts checks that without other noise the outputs flip in runs of whole bursts, back to back bursts
+// make a run of several of them
+func TestNoisyChannelBursts(t *testing.T) {
+	const burstLength = 4
+	channel := NewNoisyChannel(0, 0.05, burstLength, 0, rand.New(rand.NewSource(2)))
+	flipped, _ := transmitted(channel, 10000)
+	runs, run := 0, 0
+	for _, flip := range append(flipped, false) {
+		if flip {
+			run++
+			continue
+		}
+		if run%burstLength != 0 {
+			t.Fatalf("a run of %d flipped outputs isn't made of bursts of %d", run, burstLength)
+		}
+		if run > 0 {
+			runs++
+		}
+		run = 0
+	}
+	if runs == 0 {
+		t.Errorf("no burst started")
+	}
+	if channel.Errors() != count(flipped) {
+		t.Errorf("Errors() = %d, want the %d flipped outputs", channel.Errors(), count(flipped))
+	}
+}
+
+func TestNoisyChannelIsSeeded(t *testing.T) {
+	a, _ := transmitted(NewNoisyChannel(0.1, 0.01, 3, 0.1, rand.New(rand.NewSource(3))), 1000)
+	b, _ := transmitted(NewNoisyChannel(0.1, 0.01, 3, 0.1, rand.New(rand.NewSource(3))), 1000)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("output %d flipped with one channel and not the other with the same seed", i)
+		}
+	}
+}
+
+func TestPerfectChannel(t *testing.T) {
+	flipped, dropped := transmitted(PerfectChannel{}, 100)
+	if rate(flipped) != 0 || rate(dropped) != 0 || (PerfectChannel{}).Errors() != 0 {
+		t.Errorf("the perfect channel flipped %v and dropped %v of the outputs", rate(flipped), rate(dropped))
+	}
+}
@@ -10,12 +10,30 @@ import (
 	"strings"
 	"time"
 	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_stimHandlers"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// sessionColumns is the insert order of the sessions table, every column needs a value in the sqlData map of InsertSession
+var sessionColumns = []string{
+	"host", "seed", "master_seed", "session_index", "program_version",
+	"k", "n_0", "l", "m", "h", "data_size", "tpm_type", "learn_rule", "boundary_mode", "learn_layers", "learn_step", "learn_probability", "learn_units", "field_mode", "zero_field", "query_field", "connectivity", "fan_in", "wiring_seed", "window_size", "stride", "window_wrap",
+	"start_time", "end_time", "status", "stimulate_iterations", "learn_iterations", "initial_state", "final_state",
+	"attack_type", "attack_learn_rule", "attacker_count", "population_cap", "mutation_count",
+	"attacker_synced", "attacker_sync_iteration", "attacker_peak_population",
+	"sync_criterion", "sync_threshold", "sync_consecutive_outputs", "abort_on_attacker_sync",
+	"kdf", "key_bits", "key_fingerprint", "distinct_weights", "keys_match",
+	"channel_flip_probability", "channel_burst_probability", "channel_burst_length", "channel_drop_probability", "channel_errors",
+	"party_count", "group_topology", "group_messages", "output_classes",
+	"stimulus_generator", "stimulus_sigma", "stimulus_bias",
+	"overlap_50_iteration", "overlap_90_iteration", "overlap_99_iteration",
+}
+
 type DatabaseController struct {
-	db *sql.DB
+	db        *sql.DB
+	tableName string
 }
 
 func NewDatabaseController(username, password, db_host, db_port, db_name string) (*DatabaseController, error) {
@@ -27,22 +45,59 @@ func NewDatabaseController(username, password, db_host, db_port, db_name string)
 		return nil, err
 	}
 
-	dbController := DatabaseController{db: db}
+	dbController := DatabaseController{db: db, tableName: os.Getenv("DB_NAME")}
 
 	return &dbController, nil
 }
 
+// NewSessionStorage picks the storage backend from DB_DRIVER ("mysql" by default, or "sqlite")
+func NewSessionStorage() (SessionStorage, error) {
+	switch strings.ToLower(os.Getenv("DB_DRIVER")) {
+	case "", "mysql":
+		dbController, err := NewDatabaseController(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+		if err != nil {
+			return nil, err
+		}
+		return dbController, nil
+	case "sqlite":
+		sqlitePath, ok := os.LookupEnv("SQLITE_PATH")
+		if !ok {
+			sqlitePath = "tpm_sessions.db"
+		}
+		tableName, ok := os.LookupEnv("DB_NAME")
+		if !ok {
+			tableName = "sessions"
+		}
+		dbController, err := NewSQLiteDatabaseController(sqlitePath, tableName)
+		if err != nil {
+			return nil, err
+		}
+		return dbController, nil
+	}
+	return nil, fmt.Errorf("DB_DRIVER is invalid: %s", os.Getenv("DB_DRIVER"))
+}
+
 func (dc *DatabaseController) CloseDb() error {
 	return dc.db.Close()
 }
 
-func (dc *DatabaseController) insertIntoDB(config TPMmSettings, session SessionData, startTime time.Time, endTime time.Time) {
+func (dc *DatabaseController) InsertSession(config TPMmSettings, session SessionData, startTime time.Time, endTime time.Time) error {
 
 	kJSON, err := json.Marshal(config.K)
 	if err != nil {
 		fmt.Println(fmt.Errorf("failed to marshal K: %v", err))
 	}
 
+	//Only ADJACENCY TPMs have a connectivity, the rest store NULL
+	var connectivityJSON interface{}
+	if config.Connectivity != nil {
+		connectivity, err := json.Marshal(config.Connectivity)
+		if err != nil {
+			fmt.Println(fmt.Errorf("failed to marshal connectivity: %v", err))
+		}
+		connectivityJSON = string(connectivity)
+	}
+
 	initialStateJSON, err := json.Marshal(session.InitialState)
 	if err != nil {
 		fmt.Println(fmt.Errorf("failed to marshal K: %v", err))
@@ -61,31 +116,85 @@ func (dc *DatabaseController) insertIntoDB(config TPMmSettings, session SessionD
 	}
 
 	sqlData := map[string]interface{}{
-		"host":                 hostname,
-		"seed":                 session.Seed,
-		"program_version":      runtime.Version(),
-		"k":                    string(kJSON),
-		"n_0":                  config.N[0],
-		"l":                    config.L,
-		"m":                    config.M,
-		"h":                    config.H,
-		"data_size":            tpm_core.GetNetworkDataSize(config.H, config.K, config.N),
-		"tpm_type":             config.LinkType,
-		"learn_rule":           config.LearnRule,
-		"start_time":           startTime.Format("2006-01-02 15:04:05"),
-		"end_time":             endTime.Format("2006-01-02 15:04:05"),
-		"status":               session.Status,
-		"stimulate_iterations": session.StimulateIterations,
-		"learn_iterations":     session.LearnIterations,
-		"initial_state":        string(initialStateJSON),
-		"final_state":          string(finalStateJSON),
-	}
-	query := fmt.Sprintf("INSERT INTO %s (host, seed, program_version, k, n_0, l, m, h, data_size, tpm_type, learn_rule, start_time, end_time, status, stimulate_iterations, learn_iterations, initial_state, final_state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", os.Getenv("DB_NAME"))
-	_, err = dc.db.Exec(query, sqlData["host"], sqlData["seed"], sqlData["program_version"], sqlData["k"], sqlData["n_0"], sqlData["l"], sqlData["m"], sqlData["h"], sqlData["data_size"], sqlData["tpm_type"], sqlData["learn_rule"], sqlData["start_time"], sqlData["end_time"], sqlData["status"], sqlData["stimulate_iterations"], sqlData["learn_iterations"], sqlData["initial_state"], sqlData["final_state"])
-	if err != nil {
-		fmt.Println(fmt.Errorf("failed to insert data into MySQL: %v", err))
+		"host":                      hostname,
+		"seed":                      session.Seed,
+		"master_seed":               session.MasterSeed,
+		"session_index":             session.SessionIndex,
+		"program_version":           runtime.Version(),
+		"k":                         string(kJSON),
+		"n_0":                       config.InputsPerUnit(),
+		"l":                         config.L,
+		"m":                         config.M,
+		"h":                         config.H,
+		"data_size":                 tpm_core.GetNetworkDataSize(config.H, config.K, config.N),
+		"tpm_type":                  config.LinkType,
+		"learn_rule":                config.LearnRule,
+		"boundary_mode":             config.BoundaryMode,
+		"learn_layers":              config.LearnLayers,
+		"learn_step":                config.LearnStep,
+		"learn_probability":         config.LearnProbability,
+		"learn_units":               config.LearnUnits,
+		"field_mode":                config.FieldMode,
+		"zero_field":                config.ZeroField,
+		"query_field":               config.QueryField,
+		"connectivity":              connectivityJSON,
+		"fan_in":                    config.FanIn,
+		"wiring_seed":               config.WiringSeed,
+		"window_size":               config.Window,
+		"stride":                    config.Stride,
+		"window_wrap":               config.WindowWrap,
+		"start_time":                startTime.Format("2006-01-02 15:04:05"),
+		"end_time":                  endTime.Format("2006-01-02 15:04:05"),
+		"status":                    session.Status,
+		"stimulate_iterations":      session.StimulateIterations,
+		"learn_iterations":          session.LearnIterations,
+		"initial_state":             string(initialStateJSON),
+		"final_state":               string(finalStateJSON),
+		"attack_type":               config.AttackType,
+		"attack_learn_rule":         config.AttackLearnRule,
+		"attacker_count":            config.AttackerCount,
+		"population_cap":            config.PopulationCap,
+		"mutation_count":            config.MutationCount,
+		"attacker_peak_population":  session.AttackerPeakPopulation,
+		"sync_criterion":            config.SyncCriterion,
+		"sync_threshold":            config.SyncThreshold,
+		"sync_consecutive_outputs":  config.SyncConsecutiveOutputs,
+		"abort_on_attacker_sync":    config.AbortOnAttackerSync,
+		"kdf":                       config.Kdf,
+		"key_bits":                  config.KeyBits,
+		"key_fingerprint":           session.Key.Fingerprint,
+		"distinct_weights":          session.Key.DistinctWeights,
+		"keys_match":                session.Key.KeysMatch,
+		"channel_flip_probability":  config.ChannelFlipProbability,
+		"channel_burst_probability": config.ChannelBurstProbability,
+		"channel_burst_length":      config.ChannelBurstLength,
+		"channel_drop_probability":  config.ChannelDropProbability,
+		"channel_errors":            session.ChannelErrors,
+		"party_count":               config.PartyCount,
+		"group_topology":            config.GroupTopology,
+		"group_messages":            session.GroupMessages,
+		"output_classes":            config.OutputClasses,
+		"stimulus_generator":        config.StimulusGenerator,
+		"stimulus_sigma":            config.StimulusSigma,
+		"stimulus_bias":             config.StimulusBias,
+		"overlap_50_iteration":      session.OverlapIterations[0],
+		"overlap_90_iteration":      session.OverlapIterations[1],
+		"overlap_99_iteration":      session.OverlapIterations[2],
+		"attacker_synced":           session.AttackerSynced,
+		"attacker_sync_iteration":   session.AttackerSyncIteration,
 	}
 
+	values := make([]interface{}, len(sessionColumns))
+	for i, column := range sessionColumns {
+		values[i] = sqlData[column]
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(sessionColumns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dc.tableName, strings.Join(sessionColumns, ", "), placeholders)
+	_, err = dc.db.Exec(query, values...)
+	if err != nil {
+		return fmt.Errorf("failed to insert session into %s: %v", dc.tableName, err)
+	}
+	return nil
 }
 
 func (dc *DatabaseController) FetchFullTableAsJSON(tableName string) (string, error) {
@@ -174,6 +283,8 @@ func (dc *DatabaseController) FetchFullTableAsJSON(tableName string) (string, er
 
 // QueryGraph performs the query and returns the data for the graph
 func (dc *DatabaseController) QuerySurfaceGraph(X string, Y string, tableName string, learnRule string, scenario string) ([][]interface{}, error) {
+	learnRule = tpm_learnRules.NormalizeLayerRules(learnRule)
+	scenario = tpm_stimHandlers.NormalizeName(scenario)
 	queryBody := fmt.Sprintf(`MIN(stimulate_iterations), MAX(stimulate_iterations), AVG(stimulate_iterations),
                   	MIN(learn_iterations), MAX(learn_iterations), AVG(learn_iterations)
             		FROM %s 
@@ -244,6 +355,56 @@ func (dc *DatabaseController) QueryFinishedCount(tableName string) ([]FinishedCo
 	return results, nil
 }
 
+// QueryAttackSuccessRate retrieves the attacker success rate of every configuration that was simulated with an attacker
+func (dc *DatabaseController) QueryAttackSuccessRate(tableName string) ([]AttackSuccessData, error) {
+	fmt.Println("Querying attack success rate to DB...")
+	query := fmt.Sprintf(`
+        SELECT
+            learn_rule,
+            tpm_type,
+            attack_type,
+            attacker_count,
+            population_cap,
+            mutation_count,
+            CAST(k AS CHAR) AS k_config,
+            n_0,
+            l,
+            m,
+            COUNT(CASE WHEN attacker_synced THEN 1 END) AS success_count,
+            COUNT(*) AS total_count,
+            COALESCE(AVG(CASE WHEN attacker_synced THEN attacker_sync_iteration END), 0) AS avg_sync_iteration,
+            AVG(attacker_peak_population) AS avg_peak_population
+        FROM
+            %s
+        WHERE
+            attack_type <> 'NONE'
+        GROUP BY
+            learn_rule, tpm_type, attack_type, attacker_count, population_cap, mutation_count, k_config, n_0, l, m;
+    `, tableName)
+
+	rows, err := dc.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AttackSuccessData
+
+	for rows.Next() {
+		var data AttackSuccessData
+		err := rows.Scan(&data.LearnRule, &data.TPMType, &data.AttackType, &data.AttackerCount, &data.PopulationCap, &data.MutationCount, &data.K, &data.N0, &data.L, &data.M, &data.SuccessCount, &data.TotalCount, &data.AvgAttackerSyncIteration, &data.AvgPeakPopulation)
+		if err != nil {
+			return nil, err
+		}
+		if data.TotalCount > 0 {
+			data.SuccessRate = float64(data.SuccessCount) / float64(data.TotalCount)
+		}
+		results = append(results, data)
+	}
+
+	return results, nil
+}
+
 func (dc *DatabaseController) QuerySuccessIterationCorrelation(tableName, bucketColumn, scenario, learnRule string, countUnfinished, limitDataSize bool, maxDataSize, minDataSize int) []HistogramEntry {
 
 	conditionSubQuery := dc.generateConditionsSubquery(scenario, learnRule, limitDataSize, maxDataSize, minDataSize)
@@ -301,28 +462,35 @@ func (dc *DatabaseController) QuerySuccessIterationCorrelation(tableName, bucket
 	return results
 }
 
+// GetSessionsByK averages the sessions of a K, MySQL prints JSON arrays with a space after every comma
 func (dc *DatabaseController) GetSessionsByK(kValues []int, tableName string, tpmType string) (*SessionAvgsAndCounts, error) {
+	return dc.sessionsByK(kValues, ", ", tableName, tpmType)
+}
+
+// sessionsByK averages the sessions whose K, cast to text, is kValues joined with separator
+func (dc *DatabaseController) sessionsByK(kValues []int, separator string, tableName string, tpmType string) (*SessionAvgsAndCounts, error) {
 	// Convert kValues into a JSON array string for querying
 	jsonArray := make([]string, len(kValues))
 	for i, val := range kValues {
 		jsonArray[i] = fmt.Sprintf("%d", val)
 	}
-	jsonK := fmt.Sprintf("[%s]", strings.Join(jsonArray, ", "))
+	jsonK := fmt.Sprintf("[%s]", strings.Join(jsonArray, separator))
 	query := fmt.Sprintf(`
         SELECT 
             COALESCE(AVG(learn_iterations), 0) AS avg_learn_iterations, 
             COALESCE(AVG(stimulate_iterations), 0) AS avg_stimulate_iterations,
 			COUNT(*) AS total_count,
-            SUM(CASE WHEN status = 'FINISHED' THEN 1 ELSE 0 END) AS finished_count
+            COALESCE(SUM(CASE WHEN status = 'FINISHED' THEN 1 ELSE 0 END), 0) AS finished_count,
+            COALESCE(SUM(CASE WHEN status <> 'FINISHED' THEN 1 ELSE 0 END), 0) AS unfinished_count
 		FROM 
             %s
         WHERE 
-			tpm_type = %s
+			tpm_type = ?
 			AND CAST(K as CHAR) = ?
-    `, tableName, tpmType)
+    `, tableName)
 
 	result := SessionAvgsAndCounts{}
-	err := dc.db.QueryRow(query, jsonK).Scan(
+	err := dc.db.QueryRow(query, tpm_stimHandlers.NormalizeName(tpmType), jsonK).Scan(
 		&result.AvgLearnIterations,
 		&result.AvgStimulateIterations,
 		&result.TotalCount,
@@ -336,6 +504,85 @@ func (dc *DatabaseController) GetSessionsByK(kValues []int, tableName string, tp
 	return &result, nil
 }
 
+// GetSessionById reads a single stored session, used to replay it from its seed. A missing session gives an error wrapping sql.ErrNoRows
+func (dc *DatabaseController) GetSessionById(tableName string, id int) (*StoredSession, error) {
+	query := fmt.Sprintf(`
+		SELECT seed, k, n_0, l, m, tpm_type, learn_rule, boundary_mode, learn_layers, learn_step, learn_probability, learn_units, field_mode, zero_field, query_field, connectivity, fan_in, wiring_seed, window_size, stride, window_wrap, attack_type, attack_learn_rule, attacker_count, population_cap, mutation_count,
+			sync_criterion, sync_threshold, sync_consecutive_outputs, abort_on_attacker_sync, kdf, key_bits,
+			channel_flip_probability, channel_burst_probability, channel_burst_length, channel_drop_probability,
+			party_count, group_topology, output_classes, stimulus_generator, stimulus_sigma, stimulus_bias, status, stimulate_iterations, learn_iterations, final_state
+		FROM %s
+		WHERE id = ?`, tableName)
+
+	result := StoredSession{Id: id}
+	var kJSON, connectivityJSON, finalStateJSON []byte
+	err := dc.db.QueryRow(query, id).Scan(
+		&result.Seed,
+		&kJSON,
+		&result.N0,
+		&result.L,
+		&result.M,
+		&result.TPMType,
+		&result.LearnRule,
+		&result.BoundaryMode,
+		&result.LearnLayers,
+		&result.LearnStep,
+		&result.LearnProbability,
+		&result.LearnUnits,
+		&result.FieldMode,
+		&result.ZeroField,
+		&result.QueryField,
+		&connectivityJSON,
+		&result.FanIn,
+		&result.WiringSeed,
+		&result.Window,
+		&result.Stride,
+		&result.WindowWrap,
+		&result.AttackType,
+		&result.AttackLearnRule,
+		&result.AttackerCount,
+		&result.PopulationCap,
+		&result.MutationCount,
+		&result.SyncCriterion,
+		&result.SyncThreshold,
+		&result.SyncConsecutiveOutputs,
+		&result.AbortOnAttackerSync,
+		&result.Kdf,
+		&result.KeyBits,
+		&result.ChannelFlipProbability,
+		&result.ChannelBurstProbability,
+		&result.ChannelBurstLength,
+		&result.ChannelDropProbability,
+		&result.PartyCount,
+		&result.GroupTopology,
+		&result.OutputClasses,
+		&result.StimulusGenerator,
+		&result.StimulusSigma,
+		&result.StimulusBias,
+		&result.Status,
+		&result.StimulateIterations,
+		&result.LearnIterations,
+		&finalStateJSON,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading session %d: %w", id, err)
+	}
+	if err := json.Unmarshal(kJSON, &result.K); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal K of session %d: %v", id, err)
+	}
+	//Sessions of the other TPM types have a NULL connectivity
+	if len(connectivityJSON) != 0 {
+		if err := json.Unmarshal(connectivityJSON, &result.Connectivity); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal connectivity of session %d: %v", id, err)
+		}
+	}
+	if err := json.Unmarshal(finalStateJSON, &result.FinalState); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal final state of session %d: %v", id, err)
+	}
+
+	return &result, nil
+}
+
 func (dc *DatabaseController) ValidateGraphAxis(axis string) bool {
 
 	availableAxis := []string{"H", "N_0", "L", "DATA_SIZE", "M"}
@@ -346,26 +593,20 @@ func (dc *DatabaseController) ValidateGraphAxis(axis string) bool {
 	}
 	return false
 }
-func (dc *DatabaseController) ValidateLearnRule(rule string) bool {
 
-	availableRules := []string{"HEBBIAN", "ANTI-HEBBIAN", "RANDOM-WALK"}
-	for _, item := range availableRules {
-		if item == rule {
-			return true
+// ValidateLearnRule accepts a single rule or a comma separated list with one rule per layer, parsed like the settings parse them
+func (dc *DatabaseController) ValidateLearnRule(rule string) bool {
+	for _, layerRule := range tpm_learnRules.ParseLayerRules(rule) {
+		if !tpm_learnRules.IsRegistered(layerRule) {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
+// ValidateScenario accepts the registered TPM types
 func (dc *DatabaseController) ValidateScenario(rule string) bool {
-
-	availableRules := []string{"NO_OVERLAP", "FULLY_CONNECTED", "PARTIALLY_CONNECTED"}
-	for _, item := range availableRules {
-		if item == rule {
-			return true
-		}
-	}
-	return false
+	return tpm_stimHandlers.IsRegistered(rule)
 }
 
 // calculateBuckets calculates the optimal bucket size based on min, max, and bucketCount
@@ -411,6 +652,10 @@ func (dc *DatabaseController) generateBucketSubquery(min, max, bucketCount int,
 
 func (dc *DatabaseController) generateConditionsSubquery(scenario, learnRule string, limitDataSize bool, maxDataSize, minDataSize int) string {
 
+	//The sessions store the normalized type and rule, so they are queried the same way
+	scenario = tpm_stimHandlers.NormalizeName(scenario)
+	learnRule = tpm_learnRules.NormalizeLayerRules(learnRule)
+
 	output := ""
 	if dc.ValidateScenario(scenario) {
 		output = fmt.Sprintf("WHERE tpm_type = '%s'", scenario)
@@ -0,0 +1,33 @@
+package tpm_controllers
+
+import "testing"
+
+// TestValidateLearnRuleAcceptsWhatTheSettingsAccept checks that the query endpoints accept the learn rules a sweep runs with
+func TestValidateLearnRuleAcceptsWhatTheSettingsAccept(t *testing.T) {
+	var dc DatabaseController
+	for _, learnRule := range []string{"HEBBIAN", "hebbian", "HEBBIAN,RANDOM-WALK", "HEBBIAN, RANDOM-WALK", "anti-hebbian , random-walk"} {
+		tpmSettings, err := SyncController{}.SettingsFactory([]int{3, 1}, 4, 3, 1, "fully_connected", learnRule, nil, WindowSettings{})
+		if err != nil {
+			t.Fatalf("SettingsFactory rejected %q: %v", learnRule, err)
+		}
+		if !dc.ValidateLearnRule(learnRule) {
+			t.Errorf("ValidateLearnRule rejected %q", learnRule)
+		}
+		if !dc.ValidateLearnRule(tpmSettings.LearnRule) {
+			t.Errorf("ValidateLearnRule rejected the stored rule %q", tpmSettings.LearnRule)
+		}
+	}
+	for _, learnRule := range []string{"", "HEBB", "HEBBIAN,", "HEBBIAN;RANDOM-WALK"} {
+		if dc.ValidateLearnRule(learnRule) {
+			t.Errorf("ValidateLearnRule accepted %q", learnRule)
+		}
+	}
+}
+
+func TestConditionsUseTheStoredNames(t *testing.T) {
+	var dc DatabaseController
+	got := dc.generateConditionsSubquery("fully_connected", "hebbian, random-walk", false, 0, 0)
+	if want := "WHERE tpm_type = 'FULLY_CONNECTED' AND learn_rule = 'HEBBIAN,RANDOM-WALK'"; got != want {
+		t.Errorf("generateConditionsSubquery = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package tpm_controllers
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDatabaseController stores sessions in a local SQLite file, so sweeps can run without the MySQL stack.
+// It reuses the MySQL queries and only overrides the ones that depend on the SQL dialect.
+type SQLiteDatabaseController struct {
+	*DatabaseController
+}
+
+func NewSQLiteDatabaseController(path string, tableName string) (*SQLiteDatabaseController, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the sqlite database: %v", err)
+	}
+	// SQLite only allows one writer at a time, the worker pool would get "database is locked" errors otherwise
+	db.SetMaxOpenConns(1)
+
+	dbController := SQLiteDatabaseController{DatabaseController: &DatabaseController{db: db, tableName: tableName}}
+	if err := dbController.createSessionsTable(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &dbController, nil
+}
+
+// createSessionsTable mirrors init.sql, which is only run by the MySQL container
+func (dc *SQLiteDatabaseController) createSessionsTable() error {
+	query := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		seed BIGINT NOT NULL,
+		master_seed BIGINT NOT NULL DEFAULT 0,
+		session_index INT NOT NULL DEFAULT 0,
+		program_version VARCHAR(255) NOT NULL,
+		host VARCHAR(255) NOT NULL,
+		k JSON NOT NULL,
+		n_0 INT NOT NULL,
+		l INT NOT NULL,
+		m INT NOT NULL,
+		h INT NOT NULL,
+		data_size INT NOT NULL,
+		tpm_type VARCHAR(255) NOT NULL,
+		learn_rule VARCHAR(255) NOT NULL,
+		boundary_mode VARCHAR(255) NOT NULL DEFAULT 'CLIP',
+		learn_layers VARCHAR(255) NOT NULL DEFAULT 'ALL',
+		learn_step INT NOT NULL DEFAULT 1,
+		learn_probability DOUBLE NOT NULL DEFAULT 1,
+		learn_units INT NOT NULL DEFAULT 0,
+		field_mode VARCHAR(255) NOT NULL DEFAULT 'FAST',
+		zero_field VARCHAR(255) NOT NULL DEFAULT 'NEGATIVE',
+		query_field DOUBLE NOT NULL DEFAULT 0,
+		connectivity JSON,
+		fan_in INT NOT NULL DEFAULT 0,
+		wiring_seed BIGINT NOT NULL DEFAULT 0,
+		window_size INT NOT NULL DEFAULT 0,
+		stride INT NOT NULL DEFAULT 0,
+		window_wrap BOOLEAN NOT NULL DEFAULT FALSE,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		status VARCHAR(255) NOT NULL,
+		stimulate_iterations INT NOT NULL,
+		learn_iterations INT NOT NULL,
+		initial_state JSON NOT NULL,
+		final_state JSON NOT NULL,
+		attack_type VARCHAR(255) NOT NULL DEFAULT 'NONE',
+		attack_learn_rule VARCHAR(255) NOT NULL DEFAULT '',
+		attacker_count INT NOT NULL DEFAULT 0,
+		population_cap INT NOT NULL DEFAULT 0,
+		mutation_count INT NOT NULL DEFAULT 0,
+		attacker_synced BOOLEAN NOT NULL DEFAULT FALSE,
+		attacker_sync_iteration INT NOT NULL DEFAULT -1,
+		attacker_peak_population INT NOT NULL DEFAULT 0,
+		sync_criterion VARCHAR(255) NOT NULL DEFAULT 'EXACT_WEIGHTS',
+		sync_threshold DOUBLE NOT NULL DEFAULT 0,
+		sync_consecutive_outputs INT NOT NULL DEFAULT 0,
+		abort_on_attacker_sync BOOLEAN NOT NULL DEFAULT FALSE,
+		kdf VARCHAR(255) NOT NULL DEFAULT 'HKDF-SHA256',
+		key_bits INT NOT NULL DEFAULT 256,
+		key_fingerprint CHAR(64) NOT NULL DEFAULT '',
+		distinct_weights INT NOT NULL DEFAULT 0,
+		keys_match BOOLEAN NOT NULL DEFAULT FALSE,
+		channel_flip_probability DOUBLE NOT NULL DEFAULT 0,
+		channel_burst_probability DOUBLE NOT NULL DEFAULT 0,
+		channel_burst_length INT NOT NULL DEFAULT 0,
+		channel_drop_probability DOUBLE NOT NULL DEFAULT 0,
+		channel_errors INT NOT NULL DEFAULT 0,
+		party_count INT NOT NULL DEFAULT 2,
+		group_topology VARCHAR(255) NOT NULL DEFAULT 'PAIR',
+		group_messages INT NOT NULL DEFAULT 0,
+		output_classes INT NOT NULL DEFAULT 0,
+		stimulus_generator VARCHAR(255) NOT NULL DEFAULT 'UNIFORM',
+		stimulus_sigma DOUBLE NOT NULL DEFAULT 0,
+		stimulus_bias DOUBLE NOT NULL DEFAULT 0,
+		overlap_50_iteration INT NOT NULL DEFAULT -1,
+		overlap_90_iteration INT NOT NULL DEFAULT -1,
+		overlap_99_iteration INT NOT NULL DEFAULT -1
+	);`, dc.tableName)
+	_, err := dc.db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to create table %s: %v", dc.tableName, err)
+	}
+	return nil
+}
+
+// QueryFinishedCount retrieves the count of 'FINISHED' rows and total rows, SQLite has no CONCAT on older versions
+func (dc *SQLiteDatabaseController) QueryFinishedCount(tableName string) ([]FinishedCountData, error) {
+	fmt.Println("Querying session count to DB...")
+	query := fmt.Sprintf(`
+        SELECT
+            learn_rule,
+            tpm_type,
+            H || '-' || L AS h_l_group,
+            COUNT(CASE WHEN status = 'FINISHED' THEN 1 END) AS finished_count,
+            COUNT(*) AS total_count
+        FROM
+            %s
+        GROUP BY
+            learn_rule, tpm_type, h_l_group;
+    `, tableName)
+
+	rows, err := dc.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []FinishedCountData
+
+	for rows.Next() {
+		var data FinishedCountData
+		err := rows.Scan(&data.LearnRule, &data.TPMType, &data.HLGroup, &data.FinishedCount, &data.TotalCount)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, data)
+	}
+
+	return results, nil
+}
+
+// GetSessionsByK averages the sessions of a K, SQLite keeps the JSON text of InsertSession, which has no spaces
+func (dc *SQLiteDatabaseController) GetSessionsByK(kValues []int, tableName string, tpmType string) (*SessionAvgsAndCounts, error) {
+	return dc.sessionsByK(kValues, ",", tableName, tpmType)
+}
@@ -0,0 +1,135 @@
+package tpm_controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// analyticsDB is an in-memory SQLite database with three sessions without attack on K [3] and L 2, two of them finished,
+// and two GEOMETRIC attack sessions on K [4 2] and L 3, one of them synced the attacker at iteration 40
+func analyticsDB(t *testing.T) *SQLiteDatabaseController {
+	t.Helper()
+	dbController, err := NewSQLiteDatabaseController(":memory:", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbController.CloseDb() })
+
+	plain, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: []int{3}, N0: 4, L: 2, M: 1, LearnRule: "HEBBIAN"}, BaseSettings{TpmType: "FULLY_CONNECTED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacked, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: []int{4, 2}, N0: 4, L: 3, M: 1, LearnRule: "HEBBIAN"}, BaseSettings{TpmType: "FULLY_CONNECTED", AttackSettings: AttackSettings{AttackType: "GEOMETRIC"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := []struct {
+		settings TPMmSettings
+		session  SessionData
+	}{
+		{plain, SessionData{Status: "FINISHED", StimulateIterations: 100, LearnIterations: 40}},
+		{plain, SessionData{Status: "FINISHED", StimulateIterations: 200, LearnIterations: 60}},
+		{plain, SessionData{Status: "LIMIT_REACHED", StimulateIterations: 1000, LearnIterations: 300}},
+		{attacked, SessionData{Status: "FINISHED", StimulateIterations: 300, LearnIterations: 90, AttackerSynced: true, AttackerSyncIteration: 40, AttackerPeakPopulation: 2}},
+		{attacked, SessionData{Status: "FINISHED", StimulateIterations: 500, LearnIterations: 110, AttackerSyncIteration: -1, AttackerPeakPopulation: 4}},
+	}
+	for _, stored := range sessions {
+		stored.session.OverlapIterations = []int{-1, -1, -1}
+		if err := dbController.InsertSession(stored.settings, stored.session, time.Time{}, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbController
+}
+
+func TestSQLiteQueryFinishedCount(t *testing.T) {
+	got, err := analyticsDB(t).QueryFinishedCount("sessions")
+	if err != nil {
+		t.Fatalf("QueryFinishedCount failed: %v", err)
+	}
+	want := []FinishedCountData{
+		{LearnRule: "HEBBIAN", TPMType: "FULLY_CONNECTED", HLGroup: "1-2", FinishedCount: 2, TotalCount: 3},
+		{LearnRule: "HEBBIAN", TPMType: "FULLY_CONNECTED", HLGroup: "2-3", FinishedCount: 2, TotalCount: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryFinishedCount() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSQLiteQueryAttackSuccessRate(t *testing.T) {
+	got, err := analyticsDB(t).QueryAttackSuccessRate("sessions")
+	if err != nil {
+		t.Fatalf("QueryAttackSuccessRate failed: %v", err)
+	}
+	want := []AttackSuccessData{{
+		LearnRule: "HEBBIAN", TPMType: "FULLY_CONNECTED", AttackType: "GEOMETRIC", AttackerCount: 1, K: "[4,2]", N0: 4, L: 3, M: 1,
+		SuccessCount: 1, TotalCount: 2, SuccessRate: 0.5, AvgAttackerSyncIteration: 40, AvgPeakPopulation: 3,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryAttackSuccessRate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSQLiteQuerySurfaceGraph(t *testing.T) {
+	got, err := analyticsDB(t).QuerySurfaceGraph("H", "L", "sessions", "hebbian", "fully_connected")
+	if err != nil {
+		t.Fatalf("QuerySurfaceGraph failed: %v", err)
+	}
+	want := [][]interface{}{
+		{"X", "Y", "stimulate_min", "stimulate_max", "stimulate_avg", "learn_min", "learn_max", "learn_avg"},
+		{"1", "2", 100.0, 200.0, 150.0, 40.0, 60.0, 50.0},
+		{"2", "3", 300.0, 500.0, 400.0, 90.0, 110.0, 100.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QuerySurfaceGraph() = %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteQuerySuccessIterationCorrelation(t *testing.T) {
+	dbController := analyticsDB(t)
+	got := dbController.QuerySuccessIterationCorrelation("sessions", "l", "FULLY_CONNECTED", "HEBBIAN", false, false, 0, 0)
+	want := []HistogramEntry{
+		{RangeLabel: "2", FinishedCount: 2, TotalCount: 3, AvgLearn: 100.0 / 3, AvgStim: 100, AvgDataSize: got[0].AvgDataSize},
+		{RangeLabel: "3", FinishedCount: 2, TotalCount: 2, AvgLearn: 100, AvgStim: 400, AvgDataSize: got[1].AvgDataSize},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QuerySuccessIterationCorrelation() = %+v, want %+v", got, want)
+	}
+	unfinished := dbController.QuerySuccessIterationCorrelation("sessions", "l", "FULLY_CONNECTED", "HEBBIAN", true, false, 0, 0)
+	if len(unfinished) != 2 || unfinished[0].AvgStim != 1300.0/3 {
+		t.Errorf("counting the unfinished sessions gave %+v, want an average of %v stimulate iterations for L 2", unfinished, 1300.0/3)
+	}
+}
+
+func TestSQLiteGetSessionsByK(t *testing.T) {
+	dbController := analyticsDB(t)
+	tests := []struct {
+		k       []int
+		tpmType string
+		want    SessionAvgsAndCounts
+	}{
+		{[]int{3}, "FULLY_CONNECTED", SessionAvgsAndCounts{AvgLearnIterations: 400.0 / 3, AvgStimulateIterations: 1300.0 / 3, TotalCount: 3, FinishedCount: 2, UnfinishedCount: 1}},
+		{[]int{4, 2}, "fully_connected", SessionAvgsAndCounts{AvgLearnIterations: 100, AvgStimulateIterations: 400, TotalCount: 2, FinishedCount: 2}},
+		{[]int{4, 2}, "PARTIALLY_CONNECTED", SessionAvgsAndCounts{}},
+	}
+	for _, test := range tests {
+		got, err := dbController.GetSessionsByK(test.k, "sessions", test.tpmType)
+		if err != nil {
+			t.Fatalf("GetSessionsByK(%v, %s) failed: %v", test.k, test.tpmType, err)
+		}
+		if *got != test.want {
+			t.Errorf("GetSessionsByK(%v, %s) = %+v, want %+v", test.k, test.tpmType, *got, test.want)
+		}
+	}
+}
+
+func TestSQLiteFetchFullTableAsJSON(t *testing.T) {
+	got, err := analyticsDB(t).FetchFullTableAsJSON("sessions")
+	if err != nil {
+		t.Fatalf("FetchFullTableAsJSON failed: %v", err)
+	}
+	if got == "" || got == "null" {
+		t.Errorf("FetchFullTableAsJSON() = %q, want the 5 sessions", got)
+	}
+}
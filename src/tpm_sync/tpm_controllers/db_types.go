@@ -1,5 +1,26 @@
 package tpm_controllers
 
+import (
+	"time"
+	"tpm_sync/tpm_stimHandlers"
+)
+
+// SessionStorage is the backend where finished sessions are stored and analytics are queried from
+type SessionStorage interface {
+	InsertSession(config TPMmSettings, session SessionData, startTime time.Time, endTime time.Time) error
+	FetchFullTableAsJSON(tableName string) (string, error)
+	QuerySurfaceGraph(X string, Y string, tableName string, learnRule string, scenario string) ([][]interface{}, error)
+	QueryFinishedCount(tableName string) ([]FinishedCountData, error)
+	QuerySuccessIterationCorrelation(tableName, bucketColumn, scenario, learnRule string, countUnfinished, limitDataSize bool, maxDataSize, minDataSize int) []HistogramEntry
+	GetSessionsByK(kValues []int, tableName string, tpmType string) (*SessionAvgsAndCounts, error)
+	GetSessionById(tableName string, id int) (*StoredSession, error)
+	QueryAttackSuccessRate(tableName string) ([]AttackSuccessData, error)
+	ValidateGraphAxis(axis string) bool
+	ValidateLearnRule(rule string) bool
+	ValidateScenario(rule string) bool
+	CloseDb() error
+}
+
 // IterationGroup defines two columns that will be used to GROUP BY the results and get the averages, min and max
 type IterationGroup struct {
 	X string
@@ -20,6 +41,25 @@ type FinishedCountData struct {
 	TotalCount    int    `json:"total_count"`
 }
 
+// AttackSuccessData holds how often the attacker ended synchronized with A, for each configuration
+type AttackSuccessData struct {
+	LearnRule                string  `json:"learn_rule"`
+	TPMType                  string  `json:"tpm_type"`
+	AttackType               string  `json:"attack_type"`
+	AttackerCount            int     `json:"attacker_count"`
+	PopulationCap            int     `json:"population_cap"`
+	MutationCount            int     `json:"mutation_count"`
+	K                        string  `json:"k"`
+	N0                       int     `json:"n_0"`
+	L                        int     `json:"l"`
+	M                        int     `json:"m"`
+	SuccessCount             int     `json:"success_count"`
+	TotalCount               int     `json:"total_count"`
+	SuccessRate              float64 `json:"success_rate"`
+	AvgAttackerSyncIteration float64 `json:"avg_attacker_sync_iteration"`
+	AvgPeakPopulation        float64 `json:"avg_peak_population"`
+}
+
 // SessionAvgsAndCounts holds relevant data for a specific query, like all sessions with a specific K
 type SessionAvgsAndCounts struct {
 	AvgLearnIterations     float64 `json:"avg_learn_iterations"`
@@ -29,6 +69,37 @@ type SessionAvgsAndCounts struct {
 	UnfinishedCount        int     `json:"unfinished_count"`
 }
 
+// StoredSession holds what is needed from a sessions row to replay it
+type StoredSession struct {
+	Id           int
+	Seed         int64
+	K            []int
+	N0           int
+	L            int
+	M            int
+	TPMType      string
+	LearnRule    string
+	BoundaryMode string
+	LearnLayers  string
+	QueryField   float64
+	Connectivity *tpm_stimHandlers.Connectivity
+	AttackSettings
+	SyncSettings
+	KeySettings
+	ChannelSettings
+	GroupSettings
+	VariantSettings
+	StimulusSettings
+	NumericsSettings
+	SparseSettings
+	WindowSettings
+	LearnSettings
+	Status              string
+	StimulateIterations int
+	LearnIterations     int
+	FinalState          TPMmSessionState
+}
+
 type HistogramEntry struct {
 	RangeLabel    string
 	FinishedCount int
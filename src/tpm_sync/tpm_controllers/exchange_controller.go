@@ -0,0 +1,289 @@
+package tpm_controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_exchange"
+	"tpm_sync/tpm_keyDerivation"
+	"tpm_sync/tpm_stimHandlers"
+	"tpm_sync/tpm_syncCriteria"
+)
+
+// ExchangeController runs A and B as two parties that only share the stimulus seeds and their outputs over a connection
+type ExchangeController struct {
+	SyncController SyncController
+	Timeout        time.Duration //Deadline of every message, 0 means none
+}
+
+// ExchangeResult is what one party measured during a key exchange, round trips are only measured by the client
+type ExchangeResult struct {
+	Role            string
+	Status          string //FINISHED or LIMIT_REACHED
+	Iterations      int
+	LearnIterations int
+	Key             tpm_keyDerivation.KeyData
+	tpm_exchange.WireMetrics
+	AvgRoundTrip  time.Duration
+	MinRoundTrip  time.Duration
+	MaxRoundTrip  time.Duration
+	HandshakeTime time.Duration //From HELLO to the fingerprint exchange
+}
+
+// exchangeParty is one TPM with its own weights, the stimulation is the same as in StartSyncSession
+type exchangeParty struct {
+	tpmSettings    TPMmSettings
+	weights        [][][]int
+	layer_stimulus [][][]int
+	outputs        [][]int
+}
+
+func newExchangeParty(tpmSettings TPMmSettings, localRand *rand.Rand) *exchangeParty {
+	weights := make([][][]int, tpmSettings.H)
+	for layer := 0; layer < tpmSettings.H; layer++ {
+		weights[layer] = tpm_core.CreateRandomLayerWeightsArray(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, localRand)
+	}
+	return &exchangeParty{
+		tpmSettings:    tpmSettings,
+		weights:        weights,
+		layer_stimulus: make([][][]int, tpmSettings.H),
+		outputs:        make([][]int, tpmSettings.H),
+	}
+}
+
+// stimulate creates the stimulus of a round from its public seed and returns the output of the party
+func (p *exchangeParty) stimulate(stimulusSeed int64) int {
+	settings := p.tpmSettings
+	stimulus := tpm_core.CreateRandomStimulusArray(settings.K[0], settings.N[0], settings.M, rand.New(rand.NewSource(stimulusSeed)))
+	return SyncController{}.stimulateNetwork(settings, stimulus, p.weights, p.layer_stimulus, p.outputs)
+}
+
+func (p *exchangeParty) learn(tau_self int, tau_other int) {
+	SyncController{}.learnNetwork(p.tpmSettings, p.weights, p.layer_stimulus, p.outputs, tau_self, tau_other)
+}
+
+func (p *exchangeParty) keyData() tpm_keyDerivation.KeyData {
+	return tpm_keyDerivation.PartyKeyData(p.tpmSettings.kdfHandler, p.tpmSettings.KeyBits, p.tpmSettings.H, p.tpmSettings.K, p.tpmSettings.N, p.weights)
+}
+
+// SettingsFromHello builds the settings of an exchange, the parties can't compare weights so it always stops on consecutive outputs.
+// HELLO only carries the structure, so the TPM types that need wiring or window settings are rejected, the errors name the field
+func (e ExchangeController) SettingsFromHello(hello tpm_exchange.HelloMessage) (TPMmSettings, error) {
+	switch tpm_stimHandlers.NormalizeName(hello.TpmType) {
+	case "ADJACENCY", "STRIDED_WINDOW":
+		return TPMmSettings{}, fmt.Errorf("tpm_type is unsupported by the key exchange: %s, HELLO doesn't carry its wiring", hello.TpmType)
+	}
+	tpmSettings, err := e.SyncController.SettingsFactory(hello.K, hello.N0, hello.L, hello.M, hello.TpmType, hello.LearnRule, nil, WindowSettings{})
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	if !tpmSettings.binaryOutputs() {
+		return TPMmSettings{}, fmt.Errorf("tpm_type is unsupported by the key exchange: %s, outputs are sent as a single bit and these TPMs don't have binary outputs", tpmSettings.LinkType)
+	}
+	if _, isSparse := tpmSettings.stimulationHandlers.(tpm_stimHandlers.RandomSparseTPM); isSparse {
+		return TPMmSettings{}, fmt.Errorf("tpm_type is unsupported by the key exchange: %s, the wiring is drawn from the session seed and the parties don't share one", tpmSettings.LinkType)
+	}
+	tpmSettings, err = e.SyncController.StimulusSettingsFactory(tpmSettings, StimulusSettings{StimulusGenerator: hello.StimulusGenerator})
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	if tpmSettings.StimulusGenerator != "UNIFORM" {
+		return TPMmSettings{}, fmt.Errorf("stimulus_generator is unsupported by the key exchange: %s, the stimulus of a round is drawn uniformly from its seed", tpmSettings.StimulusGenerator)
+	}
+	tpmSettings, err = e.SyncController.SyncCriterionSettingsFactory(tpmSettings, SyncSettings{SyncCriterion: "CONSECUTIVE_OUTPUTS", SyncConsecutiveOutputs: hello.ConsecutiveOutputs})
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	return e.SyncController.KeySettingsFactory(tpmSettings, KeySettings{Kdf: hello.Kdf, KeyBits: hello.KeyBits})
+}
+
+// ServeConn runs party B on an accepted connection until the client sends its fingerprint
+func (e ExchangeController) ServeConn(netConn net.Conn, seed int64) (ExchangeResult, error) {
+	conn := tpm_exchange.NewConn(netConn)
+	conn.Timeout = e.Timeout
+	defer conn.Close()
+
+	payload, err := conn.Expect(tpm_exchange.MsgHello)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	start := time.Now()
+	var hello tpm_exchange.HelloMessage
+	err = json.Unmarshal(payload, &hello)
+	if err != nil {
+		conn.SendError(err)
+		return ExchangeResult{}, err
+	}
+	tpmSettings, err := e.SettingsFromHello(hello)
+	if err != nil {
+		conn.SendError(err)
+		return ExchangeResult{}, err
+	}
+	err = conn.Send(tpm_exchange.MsgHelloAck, nil)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+
+	party := newExchangeParty(tpmSettings, rand.New(rand.NewSource(seed)))
+	result := ExchangeResult{Role: "SERVER"}
+	for {
+		msgType, payload, err := conn.Receive()
+		if err != nil {
+			return ExchangeResult{}, err
+		}
+		switch msgType {
+		case tpm_exchange.MsgRound:
+			round, err := tpm_exchange.DecodeRound(payload)
+			if err != nil {
+				conn.SendError(err)
+				return ExchangeResult{}, err
+			}
+			tau_b := party.stimulate(round.StimulusSeed)
+			err = conn.Send(tpm_exchange.MsgRoundReply, tpm_exchange.EncodeTau(tau_b))
+			if err != nil {
+				return ExchangeResult{}, err
+			}
+			result.Iterations += 1
+			if tau_b == round.Tau {
+				party.learn(tau_b, round.Tau)
+				result.LearnIterations += 1
+			}
+		case tpm_exchange.MsgFinish:
+			var finish tpm_exchange.FinishMessage
+			err = json.Unmarshal(payload, &finish)
+			if err != nil {
+				conn.SendError(err)
+				return ExchangeResult{}, err
+			}
+			result.Key = party.keyData()
+			err = conn.Send(tpm_exchange.MsgFinishReply, []byte(result.Key.Fingerprint))
+			if err != nil {
+				return ExchangeResult{}, err
+			}
+			result.Key.KeysMatch = finish.Fingerprint == result.Key.Fingerprint
+			result.Status = finish.Status
+			result.HandshakeTime = time.Since(start)
+			result.WireMetrics = conn.Metrics
+			return result, nil
+		default:
+			err = fmt.Errorf("unexpected %s message", msgType)
+			conn.SendError(err)
+			return ExchangeResult{}, err
+		}
+	}
+}
+
+// Listen accepts exchanges until the listener fails, every connection gets its own seed derived from the given one
+func (e ExchangeController) Listen(listener net.Listener, seed int64, results chan ExchangeResult) error {
+	for connection := 0; ; connection++ {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func(netConn net.Conn, connectionSeed int64) {
+			result, err := e.ServeConn(netConn, connectionSeed)
+			if err != nil {
+				fmt.Println("Error during exchange with", netConn.RemoteAddr(), ":", err)
+				return
+			}
+			results <- result
+		}(netConn, deriveStreamSeed(seed, fmt.Sprintf("connection-%d", connection)))
+	}
+}
+
+// RunClient runs party A, it picks the stimulus seeds and decides when the exchange is over
+func (e ExchangeController) RunClient(netConn net.Conn, hello tpm_exchange.HelloMessage, seed int64) (ExchangeResult, error) {
+	conn := tpm_exchange.NewConn(netConn)
+	conn.Timeout = e.Timeout
+	defer conn.Close()
+	tpmSettings, err := e.SettingsFromHello(hello)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+
+	start := time.Now()
+	payload, err := json.Marshal(hello)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	err = conn.Send(tpm_exchange.MsgHello, payload)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	_, err = conn.Expect(tpm_exchange.MsgHelloAck)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+
+	localRand := rand.New(rand.NewSource(seed))
+	party := newExchangeParty(tpmSettings, localRand)
+	result := ExchangeResult{Role: "CLIENT", Status: "FINISHED"}
+	var totalRoundTrip time.Duration
+	progress := tpm_syncCriteria.SyncProgress{}
+	for !tpmSettings.syncCriterion.IsSynced(progress) {
+		if result.Iterations >= hello.MaxIterations && hello.MaxIterations != 0 {
+			result.Status = "LIMIT_REACHED"
+			break
+		}
+		stimulusSeed := localRand.Int63()
+		tau_a := party.stimulate(stimulusSeed)
+
+		roundStart := time.Now()
+		err = conn.Send(tpm_exchange.MsgRound, tpm_exchange.EncodeRound(tpm_exchange.RoundMessage{StimulusSeed: stimulusSeed, Tau: tau_a}))
+		if err != nil {
+			return ExchangeResult{}, err
+		}
+		payload, err := conn.Expect(tpm_exchange.MsgRoundReply)
+		if err != nil {
+			return ExchangeResult{}, err
+		}
+		roundTrip := time.Since(roundStart)
+		tau_b, err := tpm_exchange.DecodeTau(payload)
+		if err != nil {
+			conn.SendError(err)
+			return ExchangeResult{}, err
+		}
+
+		totalRoundTrip += roundTrip
+		if result.Iterations == 0 || roundTrip < result.MinRoundTrip {
+			result.MinRoundTrip = roundTrip
+		}
+		if roundTrip > result.MaxRoundTrip {
+			result.MaxRoundTrip = roundTrip
+		}
+		result.Iterations += 1
+
+		if tau_a == tau_b {
+			party.learn(tau_a, tau_b)
+			result.LearnIterations += 1
+			progress.ConsecutiveMatches += 1
+		} else {
+			progress.ConsecutiveMatches = 0
+		}
+	}
+
+	//Key confirmation, only the fingerprints are exchanged
+	result.Key = party.keyData()
+	payload, err = json.Marshal(tpm_exchange.FinishMessage{Status: result.Status, Fingerprint: result.Key.Fingerprint})
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	err = conn.Send(tpm_exchange.MsgFinish, payload)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	payload, err = conn.Expect(tpm_exchange.MsgFinishReply)
+	if err != nil {
+		return ExchangeResult{}, err
+	}
+	result.Key.KeysMatch = string(payload) == result.Key.Fingerprint
+	result.HandshakeTime = time.Since(start)
+	if result.Iterations > 0 {
+		result.AvgRoundTrip = totalRoundTrip / time.Duration(result.Iterations)
+	}
+	result.WireMetrics = conn.Metrics
+	return result, nil
+}
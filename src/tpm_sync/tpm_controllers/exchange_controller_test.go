@@ -0,0 +1,60 @@
+package tpm_controllers
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"tpm_sync/tpm_exchange"
+)
+
+func TestSettingsFromHello(t *testing.T) {
+	tests := []struct {
+		name      string
+		tpmType   string
+		generator string
+		field     string //Field the error has to name, empty when the HELLO is accepted
+	}{
+		{"fully connected", "FULLY_CONNECTED", "", ""},
+		{"uniform generator", "fully_connected", "uniform", ""},
+		{"adjacency", "ADJACENCY", "", "tpm_type"},
+		{"strided window", "strided_window", "", "tpm_type"},
+		{"random sparse", "RANDOM_SPARSE", "", "tpm_type"},
+		{"vector valued", "VECTOR_VALUED", "", "tpm_type"},
+		{"binary generator", "FULLY_CONNECTED", "BINARY", "stimulus_generator"},
+		{"gaussian generator", "FULLY_CONNECTED", "GAUSSIAN", "stimulus_generator"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hello := tpm_exchange.HelloMessage{K: []int{3}, N0: 4, L: 3, M: 1, TpmType: test.tpmType, LearnRule: "HEBBIAN", ConsecutiveOutputs: 10, StimulusGenerator: test.generator}
+			_, err := ExchangeController{}.SettingsFromHello(hello)
+			if test.field == "" && err != nil {
+				t.Errorf("SettingsFromHello rejected the HELLO: %v", err)
+			}
+			if test.field != "" && (err == nil || !strings.HasPrefix(err.Error(), test.field)) {
+				t.Errorf("SettingsFromHello returned %v, want an error naming %s", err, test.field)
+			}
+		})
+	}
+}
+
+// TestServeConnRejectsUnsupportedHello checks that the server answers an unsupported HELLO with an ERROR frame naming the field
+func TestServeConnRejectsUnsupportedHello(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go ExchangeController{}.ServeConn(server, 1)
+
+	conn := tpm_exchange.NewConn(client)
+	payload, err := json.Marshal(tpm_exchange.HelloMessage{K: []int{3}, N0: 4, L: 3, M: 1, TpmType: "ADJACENCY", LearnRule: "HEBBIAN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Send(tpm_exchange.MsgHello, payload); err != nil {
+		t.Fatalf("Send of HELLO failed: %v", err)
+	}
+	msgType, payload, err := conn.Receive()
+	if msgType != tpm_exchange.MsgError || !strings.HasPrefix(string(payload), "tpm_type") {
+		t.Errorf("received %s %q, %v, want an ERROR naming tpm_type", msgType, payload, err)
+	}
+}
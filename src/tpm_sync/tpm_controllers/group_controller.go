@@ -0,0 +1,197 @@
+package tpm_controllers
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_keyDerivation"
+	"tpm_sync/tpm_syncCriteria"
+)
+
+// GroupSettingsFactory sets how many parties take part in a session, more than two need a topology and don't support attackers or noisy channels.
+// The topology only sets how the outputs are collected, see groupMessages
+func (SyncController) GroupSettingsFactory(tpmSettings TPMmSettings, groupSettings GroupSettings) (TPMmSettings, error) {
+	if groupSettings.PartyCount == 0 || groupSettings.PartyCount == 2 {
+		tpmSettings.GroupSettings = GroupSettings{PartyCount: 2, GroupTopology: "PAIR"}
+		return tpmSettings, nil
+	}
+	if groupSettings.PartyCount < 2 {
+		return TPMmSettings{}, fmt.Errorf("party count must be at least 2: %d", groupSettings.PartyCount)
+	}
+
+	switch parsed_topology := strings.ToUpper(groupSettings.GroupTopology); parsed_topology {
+	case "STAR", "RING":
+		groupSettings.GroupTopology = parsed_topology
+	default:
+		return TPMmSettings{}, fmt.Errorf("group topology is invalid: %s", groupSettings.GroupTopology)
+	}
+	if tpmSettings.AttackType != "NONE" {
+		return TPMmSettings{}, fmt.Errorf("group sessions don't support the %s attack", tpmSettings.AttackType)
+	}
+	if tpmSettings.ChannelSettings != (ChannelSettings{}) {
+		return TPMmSettings{}, fmt.Errorf("group sessions don't support noisy channels")
+	}
+
+	tpmSettings.GroupSettings = groupSettings
+	return tpmSettings, nil
+}
+
+// stimulateNetwork runs one party on the stimulus, filling its layer stimulus and outputs, and returns its output
+func (SyncController) stimulateNetwork(tpmSettings TPMmSettings, stimulus [][]int, weights [][][]int, layer_stimulus [][][]int, outputs [][]int) int {
+	layer_stimulus[0] = stimulus
+	for layer := 0; layer < tpmSettings.H-1; layer++ {
+		outputs[layer] = tpmSettings.numerics.StimulateLayer(layer_stimulus[layer], weights[layer], tpmSettings.K[layer], tpmSettings.N[layer])
+		layer_stimulus[layer+1] = tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(outputs, layer+1, tpmSettings.K[layer+1], tpmSettings.N[layer+1])
+	}
+	outputs[tpmSettings.H-1] = tpmSettings.neuronHandler.StimulateLayer(tpmSettings.numerics, layer_stimulus[tpmSettings.H-1], weights[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1], tpmSettings.N[tpmSettings.H-1])
+	return tpmSettings.neuronHandler.Thau(outputs[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1])
+}
+
+// learnNetwork applies the learn rules to every layer that the layer selection lets learn
+func (SyncController) learnNetwork(tpmSettings TPMmSettings, weights [][][]int, layer_stimulus [][][]int, outputs [][]int, tau_self int, tau_other int) {
+	for layer := 0; layer < tpmSettings.H; layer++ {
+		if !tpmSettings.layerSelection.LearnsLayer(outputs, layer, tau_self) {
+			continue
+		}
+		tpmSettings.neuronHandler.LearnLayer(tpmSettings.learnRuleHandlers[layer], tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, weights[layer], layer_stimulus[layer], outputs[layer], tau_self, tau_other)
+	}
+}
+
+// groupParty is the network of a party of a group session, in the party order of the ring
+type groupParty struct {
+	weights        [][][]int
+	layer_stimulus [][][]int
+	outputs        [][]int
+}
+
+// groupMessages is how many messages the parties need per iteration to decide who learns
+func groupMessages(topology string, partyCount int) int {
+	switch topology {
+	case "STAR":
+		//Every party sends its output to A, and A sends back the verdict
+		return 2 * (partyCount - 1)
+	case "RING":
+		//Every party sends its output to the next one
+		return partyCount
+	}
+	return 0
+}
+
+// groupLearners marks the parties that learn this iteration. With STAR everyone learns when all the outputs agree,
+// with RING every party learns when its output agrees with the one it received from the party before it
+func groupLearners(topology string, taus []int) []bool {
+	learns := make([]bool, len(taus))
+	agree := allAgree(taus)
+	for party := range taus {
+		switch topology {
+		case "STAR":
+			learns[party] = agree
+		case "RING":
+			learns[party] = taus[party] == taus[(party+len(taus)-1)%len(taus)]
+		}
+	}
+	return learns
+}
+
+func allAgree(taus []int) bool {
+	for party := 1; party < len(taus); party++ {
+		if taus[party] != taus[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// startGroupSyncSession runs a session between PartyCount parties, A and B are the first two so the overlap and key columns still describe them
+func (s SyncController) startGroupSyncSession(tpmSettings TPMmSettings, tracking bool, sessionChannel chan SessionStateMessage, enableTracking chan bool, maxIterations int, sendIterThreshold int, sendIterStep int, seed int64, localRand *rand.Rand) SessionData {
+
+	//Setup simulation, the parties after A and B are created after the first stimulus
+	stimulusGenerator := s.createStimulusGenerator(tpmSettings, localRand)
+	sessionState := s.CreateSessionInstance(tpmSettings, stimulusGenerator, localRand)
+	for party := 2; party < tpmSettings.PartyCount; party++ {
+		weights := make([][][]int, tpmSettings.H)
+		for layer := 0; layer < tpmSettings.H; layer++ {
+			weights[layer] = tpm_core.CreateRandomLayerWeightsArray(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, localRand)
+		}
+		sessionState.Weights_Group = append(sessionState.Weights_Group, weights)
+		sessionState.Outputs_Group = append(sessionState.Outputs_Group, make([][]int, tpmSettings.H))
+		sessionState.layer_stimulus_group = append(sessionState.layer_stimulus_group, make([][][]int, tpmSettings.H))
+	}
+	queryRand := s.createQueryRand(tpmSettings, seed)
+	partyWeights := append([][][][]int{sessionState.Weights_A, sessionState.Weights_B}, sessionState.Weights_Group...)
+	s.queryStimulus(tpmSettings, sessionState.Stimulus, partyWeights, 0, queryRand)
+	initialState := copySessionState(sessionState)
+
+	parties := []groupParty{
+		{sessionState.Weights_A, sessionState.layer_stimulus_a, sessionState.Outputs_A},
+		{sessionState.Weights_B, sessionState.layer_stimulus_b, sessionState.Outputs_B},
+	}
+	for party := range sessionState.Weights_Group {
+		parties = append(parties, groupParty{sessionState.Weights_Group[party], sessionState.layer_stimulus_group[party], sessionState.Outputs_Group[party]})
+	}
+
+	group_messages := 0
+	taus := make([]int, tpmSettings.PartyCount)
+	progress := tpm_syncCriteria.SyncProgress{
+		H:             tpmSettings.H,
+		K:             tpmSettings.K,
+		N:             tpmSettings.N,
+		Weights_A:     sessionState.Weights_A,
+		Weights_B:     sessionState.Weights_B,
+		Weights_Group: sessionState.Weights_Group,
+	}
+	return s.runSession(sessionKernel{
+		isSynced: func(consecutiveMatches int) bool {
+			progress.ConsecutiveMatches = consecutiveMatches
+			return tpmSettings.syncCriterion.IsSynced(progress)
+		},
+		snapshot: func() TPMmSessionState {
+			snapshot := copySessionState(sessionState)
+			overlapState := s.overlapState(tpmSettings, sessionState)
+			snapshot.Overlap = &overlapState
+			return snapshot
+		},
+		iterate: func(iteration int) sessionStep {
+			tpmSettings.updateSkips.SetIteration(iteration)
+			for party := range parties {
+				taus[party] = s.stimulateNetwork(tpmSettings, sessionState.Stimulus, parties[party].weights, parties[party].layer_stimulus, parties[party].outputs)
+			}
+			group_messages += groupMessages(tpmSettings.GroupTopology, tpmSettings.PartyCount)
+
+			learns := groupLearners(tpmSettings.GroupTopology, taus)
+			step := sessionStep{learned: true}
+			for party, learn := range learns {
+				if !learn {
+					step.learned = false
+					continue
+				}
+				step.weightsChanged = true
+				tau_other := taus[(party+len(taus)-1)%len(taus)]
+				s.learnNetwork(tpmSettings, parties[party].weights, parties[party].layer_stimulus, parties[party].outputs, taus[party], tau_other)
+			}
+			sessionState.Stimulus = stimulusGenerator.CreateStimulus(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M)
+			s.queryStimulus(tpmSettings, sessionState.Stimulus, partyWeights, iteration, queryRand)
+			return step
+		},
+		overlap: func() float64 {
+			return tpm_core.NetworkOverlap(tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B)
+		},
+		finish: func(sessionData *SessionData) {
+			sessionData.FinalState = sessionState
+			sessionData.GroupMessages = group_messages
+			if sessionData.Status == "FINISHED" {
+				sessionData.Key = s.groupKeyData(tpmSettings, sessionState)
+			}
+		},
+	}, tracking, sessionChannel, enableTracking, maxIterations, sendIterThreshold, sendIterStep, seed, initialState)
+}
+
+// groupKeyData derives the key of A, the keys only match when every party derives the same one
+func (SyncController) groupKeyData(tpmSettings TPMmSettings, sessionState TPMmSessionState) tpm_keyDerivation.KeyData {
+	keyData := tpm_keyDerivation.DeriveKeyData(tpmSettings.kdfHandler, tpmSettings.KeyBits, tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B)
+	for _, weights := range sessionState.Weights_Group {
+		keyData.KeysMatch = keyData.KeysMatch && keyData.Fingerprint == tpm_keyDerivation.PartyKeyData(tpmSettings.kdfHandler, tpmSettings.KeyBits, tpmSettings.H, tpmSettings.K, tpmSettings.N, weights).Fingerprint
+	}
+	return keyData
+}
@@ -0,0 +1,84 @@
+package tpm_controllers
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"tpm_sync/tpm_core"
+)
+
+func groupSettings(t *testing.T, k []int, n_0 int, l int, topology string) TPMmSettings {
+	t.Helper()
+	base := BaseSettings{TpmType: "FULLY_CONNECTED", GroupSettings: GroupSettings{PartyCount: 3, GroupTopology: topology}}
+	tpmSettings, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: k, N0: n_0, L: l, M: 1, LearnRule: "HEBBIAN"}, base)
+	if err != nil {
+		t.Fatalf("SweepSettingsFactory rejected the %s group: %v", topology, err)
+	}
+	return tpmSettings
+}
+
+func TestGroupLearners(t *testing.T) {
+	tests := []struct {
+		name     string
+		topology string
+		taus     []int
+		want     []bool
+	}{
+		{"star agreeing", "STAR", []int{1, 1, 1, 1}, []bool{true, true, true, true}},
+		{"star with one disagreeing", "STAR", []int{1, 1, -1, 1}, []bool{false, false, false, false}},
+		{"ring agreeing", "RING", []int{1, 1, 1, 1}, []bool{true, true, true, true}},
+		{"ring with one disagreeing", "RING", []int{1, 1, -1, 1}, []bool{true, true, false, false}},
+		{"ring wraps around", "RING", []int{-1, 1, 1, -1}, []bool{true, false, true, false}},
+		{"ring alternating", "RING", []int{1, -1, 1, -1}, []bool{false, false, false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := groupLearners(test.topology, test.taus); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("groupLearners(%s, %v) = %v, want %v", test.topology, test.taus, got, test.want)
+			}
+		})
+	}
+}
+
+// TestGroupTopologies checks that STAR and RING sessions with the same seed learn differently, both synchronize
+// every party and send the messages of their topology
+func TestGroupTopologies(t *testing.T) {
+	s := SyncController{}
+	star, ring := groupSettings(t, []int{3}, 8, 2, "STAR"), groupSettings(t, []int{3}, 8, 2, "RING")
+	for seed := int64(1); seed <= 3; seed++ {
+		starData := s.StartSyncSession(star, false, nil, nil, 100000, 10, 100, seed, rand.New(rand.NewSource(seed)))
+		ringData := s.StartSyncSession(ring, false, nil, nil, 100000, 10, 100, seed, rand.New(rand.NewSource(seed)))
+		if starData.Status != "FINISHED" || ringData.Status != "FINISHED" {
+			t.Fatalf("seed %d: sessions ended with %s and %s", seed, starData.Status, ringData.Status)
+		}
+		if !starData.Key.KeysMatch || !ringData.Key.KeysMatch {
+			t.Errorf("seed %d: the keys of the STAR or RING parties differ", seed)
+		}
+		if starData.StimulateIterations == ringData.StimulateIterations && reflect.DeepEqual(starData.FinalState.Weights_Group, ringData.FinalState.Weights_Group) {
+			t.Errorf("seed %d: STAR and RING learned the same way", seed)
+		}
+		if want := starData.StimulateIterations * groupMessages("STAR", 3); starData.GroupMessages != want {
+			t.Errorf("seed %d: STAR sent %d messages, want %d", seed, starData.GroupMessages, want)
+		}
+		if want := ringData.StimulateIterations * groupMessages("RING", 3); ringData.GroupMessages != want {
+			t.Errorf("seed %d: RING sent %d messages, want %d", seed, ringData.GroupMessages, want)
+		}
+	}
+}
+
+// TestGroupOverlapAtTheStart checks that group sessions record the thresholds the initial weights already reach, like two party sessions
+func TestGroupOverlapAtTheStart(t *testing.T) {
+	s := SyncController{}
+	tpmSettings := groupSettings(t, []int{1}, 1, 1, "STAR")
+	for seed := int64(1); seed <= 20; seed++ {
+		sessionData := s.StartSyncSession(tpmSettings, false, nil, nil, 100000, 10, 100, seed, rand.New(rand.NewSource(seed)))
+		initial := sessionData.InitialState
+		overlap := tpm_core.NetworkOverlap(tpmSettings.H, tpmSettings.K, tpmSettings.N, initial.Weights_A, initial.Weights_B)
+		for i, threshold := range OverlapThresholds {
+			if reached := sessionData.OverlapIterations[i] == 0; reached != (overlap >= threshold) {
+				t.Errorf("seed %d: initial overlap %v, threshold %v recorded at iteration %d", seed, overlap, threshold, sessionData.OverlapIterations[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package tpm_controllers
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_keyDerivation"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_stimGenerators"
+	"tpm_sync/tpm_stimHandlers"
+	"tpm_sync/tpm_syncCriteria"
+)
+
+// KernelSettingsFactory sets which kernel runs the sessions. REFERENCE is the default, AUTO runs the packed kernel whenever
+// the settings allow it and the reference kernel otherwise, PACKED errors when they don't
+func (SyncController) KernelSettingsFactory(tpmSettings TPMmSettings, kernel string) (TPMmSettings, error) {
+	switch parsed_kernel := strings.ToUpper(kernel); parsed_kernel {
+	case "", "REFERENCE":
+		tpmSettings.Kernel = "REFERENCE"
+	case "AUTO":
+		tpmSettings.Kernel = parsed_kernel
+	case "PACKED":
+		if err := tpmSettings.packedKernelSupport(); err != nil {
+			return TPMmSettings{}, fmt.Errorf("the PACKED kernel can't run these settings: %v", err)
+		}
+		tpmSettings.Kernel = parsed_kernel
+	default:
+		return TPMmSettings{}, fmt.Errorf("kernel is invalid: %s", kernel)
+	}
+	return tpmSettings, nil
+}
+
+// packedKernelSupport says why the packed kernel can't run sessions with these settings, it is nil when it can.
+// The packed kernel covers two party sessions of sign units with ±1 stimuli and without attacks or queries, learning with
+// the fixed ±1 step clipped to [-L, L]
+func (tpmSettings TPMmSettings) packedKernelSupport() error {
+	if tpmSettings.PartyCount > 2 {
+		return fmt.Errorf("group sessions need the reference kernel")
+	}
+	if !tpmSettings.binaryOutputs() {
+		return fmt.Errorf("%s TPMs need the reference kernel", tpmSettings.LinkType)
+	}
+	if tpmSettings.AttackType != "NONE" {
+		return fmt.Errorf("the %s attack needs the reference kernel", tpmSettings.AttackType)
+	}
+	if tpmSettings.QueryField != 0 {
+		return fmt.Errorf("queries need the reference kernel")
+	}
+	switch tpmSettings.StimulusGenerator {
+	case "BINARY", "PACKED_BINARY":
+	case "UNIFORM":
+		if tpmSettings.M != 1 {
+			return fmt.Errorf("UNIFORM stimuli with M %d need the reference kernel, the packed kernel needs M 1", tpmSettings.M)
+		}
+	default:
+		return fmt.Errorf("%s stimuli need the reference kernel", tpmSettings.StimulusGenerator)
+	}
+	for layer, ruleHandler := range tpmSettings.learnRuleHandlers {
+		packedRule, isPacked := ruleHandler.(tpm_learnRules.TPMPackedLearnRule)
+		if !isPacked {
+			return fmt.Errorf("the learn rule of layer %d needs the reference kernel", layer)
+		}
+		if _, packable := packedRule.PackedDirection(1); !packable {
+			return fmt.Errorf("learn steps other than 1, learn probabilities below 1, learn units and boundary modes other than CLIP need the reference kernel")
+		}
+	}
+	switch tpmSettings.syncCriterion.(type) {
+	case tpm_syncCriteria.ExactWeightsCriterion, tpm_syncCriteria.OverlapCriterion, tpm_syncCriteria.ConsecutiveOutputsCriterion:
+	default:
+		return fmt.Errorf("the %s sync criterion needs the reference kernel", tpmSettings.SyncCriterion)
+	}
+	return nil
+}
+
+// packedNetwork is the network of a party in the packed kernel. Every buffer is allocated once per session:
+// the stimulus of every layer holds the packed rows of its units one after the other
+type packedNetwork struct {
+	layers   []tpm_core.PackedLayer
+	stimulus [][]uint64
+	outputs  [][]int
+	rules    []tpm_learnRules.TPMPackedLearnRule
+}
+
+func newPackedNetwork(tpmSettings TPMmSettings, weights [][][]int, firstStimulus []uint64) packedNetwork {
+	network := packedNetwork{
+		layers:   make([]tpm_core.PackedLayer, tpmSettings.H),
+		stimulus: make([][]uint64, tpmSettings.H),
+		outputs:  make([][]int, tpmSettings.H),
+		rules:    make([]tpm_learnRules.TPMPackedLearnRule, tpmSettings.H),
+	}
+	for layer := 0; layer < tpmSettings.H; layer++ {
+		network.layers[layer] = tpm_core.NewPackedLayer(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L)
+		network.layers[layer].Load(weights[layer])
+		network.stimulus[layer] = make([]uint64, tpmSettings.K[layer]*network.layers[layer].Words)
+		network.outputs[layer] = make([]int, tpmSettings.K[layer])
+		//packedKernelSupport already checked the rules
+		network.rules[layer] = tpmSettings.learnRuleHandlers[layer].(tpm_learnRules.TPMPackedLearnRule)
+	}
+	network.stimulus[0] = firstStimulus
+	return network
+}
+
+// stimulateLayer computes the outputs of a layer, the stimulus of the layers after the first is gathered from the outputs
+// of the layers before it as the connectivity says
+func (network packedNetwork) stimulateLayer(numerics tpm_core.Numerics, connectivity tpm_stimHandlers.Connectivity, layer int) {
+	if layer > 0 {
+		words := network.layers[layer].Words
+		stimulus := network.stimulus[layer]
+		for w := range stimulus {
+			stimulus[w] = 0
+		}
+		for i, inputs := range connectivity.Layers[layer-1] {
+			for j, input := range inputs {
+				if network.outputs[input[0]][input[1]] > 0 {
+					stimulus[i*words+j/64] |= 1 << (j % 64)
+				}
+			}
+		}
+	}
+	network.layers[layer].Stimulate(numerics, network.stimulus[layer], network.outputs[layer])
+}
+
+// learn is learnNetwork for a packed network, every agreeing unit of the layers that the layer selection lets learn takes a step
+// and is touched in the overlap
+func (network packedNetwork) learn(tpmSettings TPMmSettings, tau int, overlap tpm_core.PackedOverlap) {
+	for layer := 0; layer < tpmSettings.H; layer++ {
+		if !tpmSettings.layerSelection.LearnsLayer(network.outputs, layer, tau) {
+			continue
+		}
+		direction, _ := network.rules[layer].PackedDirection(tau)
+		words := network.layers[layer].Words
+		for i, output := range network.outputs[layer] {
+			if output == tau {
+				network.layers[layer].LearnUnit(i, network.stimulus[layer][i*words:(i+1)*words], direction)
+				overlap.Touch(layer, i)
+			}
+		}
+	}
+}
+
+// store unpacks the weights of the network into weights
+func (network packedNetwork) store(weights [][][]int) {
+	for layer := range network.layers {
+		network.layers[layer].Store(weights[layer])
+	}
+}
+
+func packedWeightsEqual(network_a packedNetwork, network_b packedNetwork) bool {
+	for layer := range network_a.layers {
+		if !network_a.layers[layer].Equal(network_b.layers[layer]) {
+			return false
+		}
+	}
+	return true
+}
+
+// packedIsSynced is the sync criterion of the session on packed networks
+func packedIsSynced(tpmSettings TPMmSettings, network_a packedNetwork, network_b packedNetwork, overlap tpm_core.PackedOverlap, consecutiveMatches int) bool {
+	switch criterion := tpmSettings.syncCriterion.(type) {
+	case tpm_syncCriteria.OverlapCriterion:
+		return overlap.Overlap() >= criterion.Threshold
+	case tpm_syncCriteria.ConsecutiveOutputsCriterion:
+		return consecutiveMatches >= criterion.Count
+	}
+	return packedWeightsEqual(network_a, network_b)
+}
+
+// startPackedSyncSession runs a session of A and B on packed weights and stimuli, with the same draws and in the same order
+// as StartSyncSession, so both kernels give the same session for the same seed. The weights are only unpacked for the tracked
+// snapshots and the final state
+func (s SyncController) startPackedSyncSession(tpmSettings TPMmSettings, tracking bool, sessionChannel chan SessionStateMessage, enableTracking chan bool, maxIterations int, sendIterThreshold int, sendIterStep int, seed int64, localRand *rand.Rand) SessionData {
+
+	//Setup simulation, the first stimulus is created unpacked like in the reference kernel
+	stimulusGenerator := s.createStimulusGenerator(tpmSettings, localRand)
+	packedGenerator := stimulusGenerator.(tpm_stimGenerators.TPMPackedStimulusGenerator)
+	sessionState := s.CreateSessionInstance(tpmSettings, stimulusGenerator, localRand)
+	initialState := copySessionState(sessionState)
+
+	//The handlers copy outputs, so tracing them can't fail for the registered TPM types
+	connectivity, _ := tpm_stimHandlers.TraceConnectivity(tpmSettings.stimulationHandlers, tpmSettings.K, tpmSettings.N)
+	words := tpm_core.PackedWords(tpmSettings.N[0])
+	stimulus := make([]uint64, tpmSettings.K[0]*words)
+	for i, row := range sessionState.Stimulus {
+		tpm_core.PackSigns(row, stimulus[i*words:(i+1)*words])
+	}
+	network_a := newPackedNetwork(tpmSettings, sessionState.Weights_A, stimulus)
+	network_b := newPackedNetwork(tpmSettings, sessionState.Weights_B, stimulus)
+	overlap := tpm_core.NewPackedOverlap(network_a.layers, network_b.layers)
+
+	//Each direction of the channel has its own noise
+	channel_ab := s.createChannel(tpmSettings, seed, "ab")
+	channel_ba := s.createChannel(tpmSettings, seed, "ba")
+
+	//unpack stores the packed weights and stimulus in the session state
+	unpack := func() {
+		network_a.store(sessionState.Weights_A)
+		network_b.store(sessionState.Weights_B)
+		for i, row := range sessionState.Stimulus {
+			tpm_core.UnpackSigns(stimulus[i*words:(i+1)*words], row)
+		}
+	}
+	lastLayer := tpmSettings.H - 1
+	return s.runSession(sessionKernel{
+		isSynced: func(consecutiveMatches int) bool {
+			return packedIsSynced(tpmSettings, network_a, network_b, overlap, consecutiveMatches)
+		},
+		snapshot: func() TPMmSessionState {
+			unpack()
+			snapshot := copySessionState(sessionState)
+			overlapState := s.overlapState(tpmSettings, sessionState)
+			snapshot.Overlap = &overlapState
+			return snapshot
+		},
+		iterate: func(iteration int) sessionStep {
+			//A and B take turns on every layer, so random zero field outputs are drawn in the same order as the reference kernel
+			for layer := 0; layer < tpmSettings.H; layer++ {
+				network_a.stimulateLayer(tpmSettings.numerics, connectivity, layer)
+				network_b.stimulateLayer(tpmSettings.numerics, connectivity, layer)
+			}
+			copy(sessionState.Outputs_A, network_a.outputs)
+			copy(sessionState.Outputs_B, network_b.outputs)
+			final_output_a := tpm_core.Thau(network_a.outputs[lastLayer], tpmSettings.K[lastLayer])
+			final_output_b := tpm_core.Thau(network_b.outputs[lastLayer], tpmSettings.K[lastLayer])
+
+			//Each party only knows the output it received, a dropped output means it can't learn this iteration
+			received_a, delivered_a := channel_ba.Transmit(final_output_b)
+			received_b, delivered_b := channel_ab.Transmit(final_output_a)
+			learn_a := delivered_a && final_output_a == received_a
+			learn_b := delivered_b && final_output_b == received_b
+			if learn_a {
+				network_a.learn(tpmSettings, final_output_a, overlap)
+			}
+			if learn_b {
+				network_b.learn(tpmSettings, final_output_b, overlap)
+			}
+			packedGenerator.CreatePackedStimulus(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M, stimulus)
+			return sessionStep{learned: learn_a && learn_b, weightsChanged: learn_a || learn_b}
+		},
+		overlap: overlap.Overlap,
+		finish: func(sessionData *SessionData) {
+			unpack()
+			sessionData.FinalState = sessionState
+			sessionData.ChannelErrors = channel_ab.Errors() + channel_ba.Errors()
+			if sessionData.Status == "FINISHED" {
+				sessionData.Key = tpm_keyDerivation.DeriveKeyData(tpmSettings.kdfHandler, tpmSettings.KeyBits, tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B)
+			}
+		},
+	}, tracking, sessionChannel, enableTracking, maxIterations, sendIterThreshold, sendIterStep, seed, initialState)
+}
@@ -0,0 +1,219 @@
+package tpm_controllers
+
+import (
+	"database/sql"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// trackedSession runs a session with tracking on and returns it with every snapshot it sent
+func trackedSession(tpmSettings TPMmSettings, seed int64) (SessionData, []TPMmSessionState) {
+	sessionChannel := make(chan SessionStateMessage)
+	snapshots := make(chan []TPMmSessionState)
+	go func() {
+		var received []TPMmSessionState
+		for message := range sessionChannel {
+			if message.CommandType == "finished" {
+				break
+			}
+			received = append(received, message.SessionState.([]TPMmSessionState)...)
+		}
+		snapshots <- received
+	}()
+	sessionData := SyncController{}.StartSyncSession(tpmSettings, true, sessionChannel, nil, 20000, 2, 7, seed, rand.New(rand.NewSource(seed)))
+	return sessionData, <-snapshots
+}
+
+// TestKernelsGiveTheSameSessions runs every setting the packed kernel supports on both kernels, they have to take the same
+// draws in the same order, so the sessions and everything that was tracked on the way have to match
+func TestKernelsGiveTheSameSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		k    []int
+		n_0  int
+		l    int
+		base BaseSettings
+	}{
+		{"single layer", []int{3}, 10, 3, BaseSettings{}},
+		{"two layers", []int{4, 2}, 6, 2, BaseSettings{}},
+		{"partially connected", []int{4, 2}, 5, 3, BaseSettings{TpmType: "PARTIALLY_CONNECTED"}},
+		{"wide rows", []int{2}, 70, 1, BaseSettings{}},
+		{"binary stimuli", []int{3}, 10, 3, BaseSettings{StimulusSettings: StimulusSettings{StimulusGenerator: "BINARY"}}},
+		{"packed binary stimuli", []int{3}, 10, 3, BaseSettings{StimulusSettings: StimulusSettings{StimulusGenerator: "PACKED_BINARY"}}},
+		{"overlap criterion", []int{3}, 10, 3, BaseSettings{SyncSettings: SyncSettings{SyncCriterion: "OVERLAP", SyncThreshold: 0.9}}},
+		{"consecutive outputs", []int{4, 2}, 6, 2, BaseSettings{SyncSettings: SyncSettings{SyncCriterion: "CONSECUTIVE_OUTPUTS", SyncConsecutiveOutputs: 30}}},
+		{"random zero fields", []int{3}, 10, 3, BaseSettings{NumericsSettings: NumericsSettings{FieldMode: "EXACT", ZeroField: "RANDOM"}}},
+		{"noisy channel", []int{3}, 10, 3, BaseSettings{ChannelSettings: ChannelSettings{ChannelFlipProbability: 0.02, ChannelDropProbability: 0.02}}},
+		{"anti hebbian", []int{3}, 10, 3, BaseSettings{LearnRules: []string{"ANTI-HEBBIAN"}}},
+		{"random walk", []int{4, 2}, 6, 2, BaseSettings{LearnRules: []string{"RANDOM-WALK"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.base.TpmType == "" {
+				test.base.TpmType = "FULLY_CONNECTED"
+			}
+			learnRule := "HEBBIAN"
+			if len(test.base.LearnRules) > 0 {
+				learnRule = test.base.LearnRules[0]
+			}
+			kernels := map[string]TPMmSettings{}
+			for _, kernel := range []string{"REFERENCE", "PACKED"} {
+				test.base.Kernel = kernel
+				tpmSettings, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: test.k, N0: test.n_0, L: test.l, M: 1, LearnRule: learnRule}, test.base)
+				if err != nil {
+					t.Fatalf("SweepSettingsFactory rejected the %s kernel: %v", kernel, err)
+				}
+				kernels[kernel] = tpmSettings
+			}
+			for seed := int64(1); seed <= 4; seed++ {
+				reference, referenceSnapshots := trackedSession(kernels["REFERENCE"], seed)
+				packed, packedSnapshots := trackedSession(kernels["PACKED"], seed)
+				if packed.Status != reference.Status || packed.StimulateIterations != reference.StimulateIterations || packed.LearnIterations != reference.LearnIterations {
+					t.Fatalf("seed %d: PACKED ended %s after %d/%d iterations, REFERENCE %s after %d/%d", seed, packed.Status, packed.StimulateIterations, packed.LearnIterations, reference.Status, reference.StimulateIterations, reference.LearnIterations)
+				}
+				if !reflect.DeepEqual(packed.FinalState.Weights_A, reference.FinalState.Weights_A) || !reflect.DeepEqual(packed.FinalState.Weights_B, reference.FinalState.Weights_B) {
+					t.Errorf("seed %d: the final weights differ", seed)
+				}
+				if !reflect.DeepEqual(packed.OverlapIterations, reference.OverlapIterations) || packed.ChannelErrors != reference.ChannelErrors || packed.Key != reference.Key {
+					t.Errorf("seed %d: PACKED reached the overlaps at %v with %d channel errors, REFERENCE at %v with %d", seed, packed.OverlapIterations, packed.ChannelErrors, reference.OverlapIterations, reference.ChannelErrors)
+				}
+				if len(packedSnapshots) != len(referenceSnapshots) {
+					t.Fatalf("seed %d: PACKED tracked %d snapshots, REFERENCE %d", seed, len(packedSnapshots), len(referenceSnapshots))
+				}
+				for i := range referenceSnapshots {
+					packedSnapshot, referenceSnapshot := packedSnapshots[i], referenceSnapshots[i]
+					if !reflect.DeepEqual(packedSnapshot.Overlap, referenceSnapshot.Overlap) || !reflect.DeepEqual(packedSnapshot.Weights_A, referenceSnapshot.Weights_A) || !reflect.DeepEqual(packedSnapshot.Stimulus, referenceSnapshot.Stimulus) {
+						t.Errorf("seed %d: snapshot %d differs, PACKED overlap %+v, REFERENCE %+v", seed, i, packedSnapshot.Overlap, referenceSnapshot.Overlap)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReferenceIsTheDefaultKernel(t *testing.T) {
+	tpmSettings, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: []int{3}, N0: 10, L: 3, M: 1, LearnRule: "HEBBIAN"}, BaseSettings{TpmType: "FULLY_CONNECTED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpmSettings.Kernel != "REFERENCE" {
+		t.Errorf("the default kernel is %s", tpmSettings.Kernel)
+	}
+	if _, err := (SyncController{}).KernelSettingsFactory(tpmSettings, "auto"); err != nil {
+		t.Errorf("KernelSettingsFactory rejected AUTO: %v", err)
+	}
+	tpmSettings.QueryField = 1
+	if _, err := (SyncController{}).KernelSettingsFactory(tpmSettings, "PACKED"); err == nil {
+		t.Errorf("KernelSettingsFactory accepted PACKED with queries")
+	}
+}
+
+// storedSweep runs two sessions of every instance of a sweep like SimulateInstance does and returns the stored rows, without
+// the id and the times
+func storedSweep(t *testing.T, baseSettings BaseSettings, settings string) [][]string {
+	t.Helper()
+	dbController, err := NewSQLiteDatabaseController(filepath.Join(t.TempDir(), "sessions.db"), "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbController.CloseDb()
+
+	s := &SimulationController{SyncController: SyncController{}, DatabaseController: dbController}
+	err = s.forEachSweepInstance(baseSettings, []byte(settings), func(tpmSettings TPMmSettings, err error) bool {
+		if err != nil {
+			t.Fatalf("instance %v failed: %v", tpmSettings.K, err)
+		}
+		for i := 0; i < 2; i++ {
+			seed, err := DeriveSessionSeed(baseSettings.MasterSeed, tpmSettings, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := s.SyncController.StartSyncSession(tpmSettings, false, nil, nil, baseSettings.MaxIterations, 10, 100, seed, rand.New(rand.NewSource(seed)))
+			session.MasterSeed = baseSettings.MasterSeed
+			session.SessionIndex = i
+			if err := dbController.InsertSession(tpmSettings, session, time.Time{}, time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := dbController.db.Query("SELECT * FROM sessions ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var stored [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatal(err)
+		}
+		var row []string
+		for i, column := range columns {
+			if column != "id" && column != "start_time" && column != "end_time" {
+				row = append(row, column+"="+values[i].String)
+			}
+		}
+		stored = append(stored, row)
+	}
+	return stored
+}
+
+// TestKernelsStoreTheSameSweeps checks that a sweep stores the same sessions, seeds included, with either kernel
+func TestKernelsStoreTheSameSweeps(t *testing.T) {
+	settings := `{"tpm_type": "FULLY_CONNECTED", "learn_rules": ["HEBBIAN", "ANTI-HEBBIAN"], "m_configs": [1], "l_configs": [2, 3],
+		"k_configs": [[3], [4, 2]], "n0_configs": [6], "stimulus_generator": "BINARY", "max_iterations": 20000, "master_seed": 7}`
+	baseSettings, err := UnmarshalSettings([]byte(settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference := storedSweep(t, baseSettings, settings)
+	baseSettings.Kernel = "PACKED"
+	packed := storedSweep(t, baseSettings, settings)
+	if len(reference) != 2*2*2*2 || !reflect.DeepEqual(packed, reference) {
+		t.Errorf("PACKED stored %d sessions and REFERENCE %d, or they differ", len(packed), len(reference))
+	}
+}
+
+// benchmarkKernel runs b.N iterations of a K 3, N 100, L 3 session for every stimulus generator of the packed kernel, the
+// sync criterion never holds so every op is one iteration
+func benchmarkKernel(b *testing.B, kernel string) {
+	for _, generator := range []string{"BINARY", "UNIFORM", "PACKED_BINARY"} {
+		b.Run(generator, func(b *testing.B) {
+			base := BaseSettings{
+				TpmType:          "FULLY_CONNECTED",
+				Kernel:           kernel,
+				StimulusSettings: StimulusSettings{StimulusGenerator: generator},
+				SyncSettings:     SyncSettings{SyncCriterion: "CONSECUTIVE_OUTPUTS", SyncConsecutiveOutputs: math.MaxInt32},
+			}
+			tpmSettings, err := SyncController{}.SweepSettingsFactory(SweepInstance{K: []int{3}, N0: 100, L: 3, M: 1, LearnRule: "HEBBIAN"}, base)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			SyncController{}.StartSyncSession(tpmSettings, false, nil, nil, b.N, 10, math.MaxInt32, 1, rand.New(rand.NewSource(1)))
+		})
+	}
+}
+
+func BenchmarkReferenceKernel(b *testing.B) {
+	benchmarkKernel(b, "REFERENCE")
+}
+
+func BenchmarkPackedKernel(b *testing.B) {
+	benchmarkKernel(b, "PACKED")
+}
@@ -2,12 +2,15 @@ package tpm_controllers
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
@@ -17,7 +20,7 @@ import (
 
 type SimulationController struct {
 	SyncController     SyncController
-	DatabaseController DatabaseController
+	DatabaseController SessionStorage
 	WorkerPool         *pool.Pool
 }
 
@@ -72,6 +75,7 @@ func (s *SimulationController) LoadSimulationSettings(filename string) (interfac
 }
 
 func (s *SimulationController) SimulateInstance(sessionMap *SessionMap, tpmSettings TPMmSettings, simSettings BaseSettings) string {
+	resolveMasterSeed(&simSettings)
 
 	startTime, ntpErr := s.getCurrentTimeFromNTP()
 	if ntpErr != nil {
@@ -102,7 +106,11 @@ func (s *SimulationController) SimulateInstance(sessionMap *SessionMap, tpmSetti
 			if ntpErr != nil {
 				startTime = time.Now()
 			}
-			seed := time.Now().UnixNano()
+			seed, err := DeriveSessionSeed(simSettings.MasterSeed, tpmSettings, i)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
 			localRand := rand.New(rand.NewSource(seed))
 			sendIterThreshold := 10
 			sendIterStep := 100
@@ -110,12 +118,16 @@ func (s *SimulationController) SimulateInstance(sessionMap *SessionMap, tpmSetti
 			tracking := sessionMap.Sessions[token].Tracking
 			sessionMap.Mutex.RUnlock()
 			session := s.SyncController.StartSyncSession(tpmSettings, tracking, sessionChannel, enableTrackingChannel, simSettings.MaxIterations, sendIterThreshold, sendIterStep, seed, localRand)
+			session.MasterSeed = simSettings.MasterSeed
+			session.SessionIndex = i
 
 			endTime, ntpErr := s.getCurrentTimeFromNTP()
 			if ntpErr != nil {
 				endTime = time.Now()
 			}
-			s.DatabaseController.insertIntoDB(tpmSettings, session, startTime, endTime)
+			if err := s.DatabaseController.InsertSession(tpmSettings, session, startTime, endTime); err != nil {
+				fmt.Println(err)
+			}
 			sessionMap.Mutex.Lock()
 			sessionMap.Sessions[token].CurrentSessionCount += 1
 			sessionMap.Mutex.Unlock()
@@ -142,52 +154,21 @@ func (s *SimulationController) SimulateOnStart(sessionMap *SessionMap) {
 		fmt.Println("Error unmarshalling base settings:", err)
 		return
 	}
+	resolveMasterSeed(&baseSettings)
 
 	fmt.Println("Settings loaded:")
 	fmt.Println(baseSettings)
 
-	for _, rule := range baseSettings.LearnRules {
-		for _, m := range baseSettings.MConfigs {
-			for _, l := range baseSettings.LConfigs {
-				switch strings.ToUpper(baseSettings.TpmType) {
-				case "NO_OVERLAP":
-					var noOverlapSettings NonOverlappedSettings
-
-					if err := json.Unmarshal(baseSettingsData, &noOverlapSettings); err != nil {
-						fmt.Println("Error unmarshalling noOverlap settings:", err)
-					}
-
-					for _, n := range noOverlapSettings.NConfigs {
-						for _, k_last := range noOverlapSettings.KlastConfigs {
-							tpmInstanceSettings, err := s.SyncController.SettingsFactory(n, k_last, l, m, noOverlapSettings.TpmType, rule)
-							if err != nil {
-								fmt.Println("Error while creating settings for an instance: ", err)
-								return
-							}
-							s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
-						}
-					}
-				default:
-					var overlapSettings OverlappedSettings
-
-					if err := json.Unmarshal(baseSettingsData, &overlapSettings); err != nil {
-						fmt.Println("Error unmarshalling overlapped settings:", err)
-					}
-
-					for _, k := range overlapSettings.KConfigs {
-						for _, n_0 := range overlapSettings.N0Configs {
-							tpmInstanceSettings, err := s.SyncController.SettingsFactory(k, n_0, l, m, overlapSettings.TpmType, rule)
-							if err != nil {
-								fmt.Println("Error while creating settings for an instance: ", err)
-								return
-							}
-							s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
-
-						}
-					}
-				}
-			}
+	err = s.forEachSweepInstance(baseSettings, baseSettingsData, func(tpmInstanceSettings TPMmSettings, err error) bool {
+		if err != nil {
+			fmt.Println("Error while creating settings for an instance: ", err)
+			return false
 		}
+		s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
+		return true
+	})
+	if err != nil {
+		fmt.Println("Error unmarshalling sweep settings:", err)
 	}
 	s.WorkerPool.Wait()
 	fmt.Println("-- All automatic configs finished --")
@@ -217,53 +198,21 @@ func (s *SimulationController) SimulateMultipleFiles(sessionMap *SessionMap, con
 			fmt.Printf("Error unmarshalling base settings for file %s: %s", file.Name(), err)
 			continue
 		}
+		resolveMasterSeed(&baseSettings)
 
 		fmt.Printf("%s Settings loaded: \n", file.Name())
 		fmt.Println(baseSettings)
 
-		for _, rule := range baseSettings.LearnRules {
-			for _, m := range baseSettings.MConfigs {
-				for _, l := range baseSettings.LConfigs {
-					switch strings.ToUpper(baseSettings.TpmType) {
-					case "NO_OVERLAP":
-						var noOverlapSettings NonOverlappedSettings
-
-						if err := json.Unmarshal(baseSettingsData, &noOverlapSettings); err != nil {
-							fmt.Printf("Error unmarshalling noOverlap settings for file %s: %s\n", file.Name(), err)
-							continue
-						}
-
-						for _, n := range noOverlapSettings.NConfigs {
-							for _, k_last := range noOverlapSettings.KlastConfigs {
-								tpmInstanceSettings, err := s.SyncController.SettingsFactory(n, k_last, l, m, noOverlapSettings.TpmType, rule)
-								if err != nil {
-									fmt.Printf("Error while creating settings for an instance for file %s: %s \n", file.Name(), err)
-									continue
-								}
-								s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
-							}
-						}
-					default:
-						var overlapSettings OverlappedSettings
-
-						if err := json.Unmarshal(baseSettingsData, &overlapSettings); err != nil {
-							fmt.Printf("Error unmarshalling overlapped settings for file %s: %s\n", file.Name(), err)
-						}
-
-						for _, k := range overlapSettings.KConfigs {
-							for _, n_0 := range overlapSettings.N0Configs {
-								tpmInstanceSettings, err := s.SyncController.SettingsFactory(k, n_0, l, m, overlapSettings.TpmType, rule)
-								if err != nil {
-									fmt.Printf("Error while creating settings for an instance for file %s: %s \n", file.Name(), err)
-									continue
-								}
-								s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
-
-							}
-						}
-					}
-				}
+		err = s.forEachSweepInstance(baseSettings, baseSettingsData, func(tpmInstanceSettings TPMmSettings, err error) bool {
+			if err != nil {
+				fmt.Printf("Error while creating settings for an instance for file %s: %s \n", file.Name(), err)
+				return true
 			}
+			s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
+			return true
+		})
+		if err != nil {
+			fmt.Printf("Error unmarshalling sweep settings for file %s: %s\n", file.Name(), err)
 		}
 		// fmt.Printf("-- All automatic configs finished for file %s --\n", file.Name())
 	}
@@ -272,10 +221,92 @@ func (s *SimulationController) SimulateMultipleFiles(sessionMap *SessionMap, con
 
 }
 
+// forEachSweepInstance builds the settings of every instance of a settings file and passes them to visit, which returns false
+// to stop the sweep. NO_OVERLAP sweeps read n_configs and klast_configs from the raw settings, the rest k_configs and n0_configs.
+// The error is only set when the raw settings can't be read
+func (s *SimulationController) forEachSweepInstance(baseSettings BaseSettings, baseSettingsData []byte, visit func(tpmInstanceSettings TPMmSettings, err error) bool) error {
+	var axes []sweepAxis
+	switch strings.ToUpper(baseSettings.TpmType) {
+	case "NO_OVERLAP":
+		var noOverlapSettings NonOverlappedSettings
+		if err := json.Unmarshal(baseSettingsData, &noOverlapSettings); err != nil {
+			return err
+		}
+		axes = baseSettings.sweepAxes(noOverlapSettings.NConfigs, noOverlapSettings.KlastConfigs)
+	default:
+		var overlapSettings OverlappedSettings
+		if err := json.Unmarshal(baseSettingsData, &overlapSettings); err != nil {
+			return err
+		}
+		axes = baseSettings.sweepAxes(overlapSettings.KConfigs, overlapSettings.N0Configs)
+	}
+
+	sweepInstances(axes, func(instance SweepInstance) bool {
+		return visit(s.SyncController.SweepSettingsFactory(instance, baseSettings))
+	})
+	return nil
+}
+
 func (s *SimulationController) SimulateOnDemand(sessionMap *SessionMap, tpmInstanceSettings TPMmSettings, baseSettings BaseSettings) string {
 	return s.SimulateInstance(sessionMap, tpmInstanceSettings, baseSettings)
 }
 
+// ErrInvalidStoredSettings is wrapped by the errors of ReplaySession when the stored settings can't be rebuilt
+var ErrInvalidStoredSettings = errors.New("settings of the stored session are invalid")
+
+// ReplaySession re-runs a stored session from its seed, the trajectory is sent through stateChannel and the channel is closed when done.
+// The last message has the "replay_result" CommandType and a ReplayResult comparing both runs.
+// A missing session gives an error wrapping sql.ErrNoRows.
+func (s *SimulationController) ReplaySession(tableName string, sessionId int, stateChannel chan SessionStateMessage) error {
+	storedSession, err := s.DatabaseController.GetSessionById(tableName, sessionId)
+	if err != nil {
+		close(stateChannel)
+		return err
+	}
+
+	tpmSettings, err := s.SyncController.SettingsFromStoredSession(*storedSession)
+	if err != nil {
+		close(stateChannel)
+		return fmt.Errorf("%w: %v", ErrInvalidStoredSettings, err)
+	}
+
+	//The iteration limit isn't stored, but a session that reached it stopped right after going over it
+	maxIterations := storedSession.StimulateIterations
+	if storedSession.Status == "LIMIT_REACHED" {
+		maxIterations = storedSession.StimulateIterations - 1
+	}
+
+	go func() {
+		defer close(stateChannel)
+		sendIterThreshold := 10
+		sendIterStep := 100
+		localRand := rand.New(rand.NewSource(storedSession.Seed))
+		session := s.SyncController.StartSyncSession(tpmSettings, true, stateChannel, nil, maxIterations, sendIterThreshold, sendIterStep, storedSession.Seed, localRand)
+
+		replayResult := ReplayResult{
+			SessionId:                   sessionId,
+			Seed:                        storedSession.Seed,
+			StoredStatus:                storedSession.Status,
+			ReplayedStatus:              session.Status,
+			StoredStimulateIterations:   storedSession.StimulateIterations,
+			ReplayedStimulateIterations: session.StimulateIterations,
+			StoredLearnIterations:       storedSession.LearnIterations,
+			ReplayedLearnIterations:     session.LearnIterations,
+			FinalStateMatches:           reflect.DeepEqual(copySessionState(session.FinalState), copySessionState(storedSession.FinalState)),
+		}
+		replayResult.Matches = replayResult.FinalStateMatches &&
+			replayResult.StoredStatus == replayResult.ReplayedStatus &&
+			replayResult.StoredStimulateIterations == replayResult.ReplayedStimulateIterations &&
+			replayResult.StoredLearnIterations == replayResult.ReplayedLearnIterations
+
+		stateChannel <- SessionStateMessage{
+			CommandType:  "replay_result",
+			SessionState: replayResult,
+		}
+	}()
+	return nil
+}
+
 func (s *SimulationController) getCurrentTimeFromNTP() (time.Time, error) {
 	// You can use a specific NTP server or use a pool
 	ntpServer := "ntp.shoa.cl"
@@ -295,6 +326,75 @@ func (s *SimulationController) generateToken(startTime time.Time, config TPMmSet
 	return token
 }
 
+// seedStampVersion versions the settings stamped into the session seeds. New swept values are stamped with omitempty and
+// their default at the zero value, so the seeds of sweeps that don't use them stay the same
+const seedStampVersion = 1
+
+// seedStamp lists the swept values of an instance. The rest of the settings, like the attack, the channel or the kernel,
+// don't change the seed, so A and B run the same sessions with or without them
+type seedStamp struct {
+	Version          int     `json:"version"`
+	K                []int   `json:"k"`
+	N                []int   `json:"n"`
+	L                int     `json:"l"`
+	M                int     `json:"m"`
+	LinkType         string  `json:"link_type"`
+	LearnRule        string  `json:"learn_rule"`
+	BoundaryMode     string  `json:"boundary_mode"`
+	QueryField       float64 `json:"query_field"`
+	FanIn            int     `json:"fan_in"`
+	WiringSeed       int64   `json:"wiring_seed"`
+	Window           int     `json:"window"`
+	Stride           int     `json:"stride"`
+	WindowWrap       bool    `json:"window_wrap"`
+	LearnStep        int     `json:"learn_step"`
+	LearnProbability float64 `json:"learn_probability"`
+	LearnUnits       int     `json:"learn_units"`
+}
+
+// DeriveSessionSeed builds the seed of a single session from the sweep master seed, the swept values of the instance and the
+// session index, so a whole sweep can be rerun and any session can be replayed on its own
+func DeriveSessionSeed(masterSeed int64, config TPMmSettings, sessionIndex int) (int64, error) {
+	configStamp, err := json.Marshal(seedStamp{
+		Version:          seedStampVersion,
+		K:                config.K,
+		N:                config.N,
+		L:                config.L,
+		M:                config.M,
+		LinkType:         strings.ToUpper(config.LinkType),
+		LearnRule:        strings.ToUpper(config.LearnRule),
+		BoundaryMode:     config.BoundaryMode,
+		QueryField:       config.QueryField,
+		FanIn:            config.FanIn,
+		WiringSeed:       config.WiringSeed,
+		Window:           config.Window,
+		Stride:           config.Stride,
+		WindowWrap:       config.WindowWrap,
+		LearnStep:        config.LearnStep,
+		LearnProbability: config.LearnProbability,
+		LearnUnits:       config.LearnUnits,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("settings can't be stamped into the seed: %v", err)
+	}
+	configHash := sha256.Sum256(configStamp)
+
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, masterSeed)
+	h.Write(configHash[:])
+	binary.Write(h, binary.BigEndian, int64(sessionIndex))
+	return int64(binary.BigEndian.Uint64(h.Sum(nil)[:8])), nil
+}
+
+// resolveMasterSeed picks a master seed from the clock when the settings don't define one, it's logged so the sweep can be rerun
+func resolveMasterSeed(settings *BaseSettings) {
+	if settings.MasterSeed != 0 {
+		return
+	}
+	settings.MasterSeed = time.Now().UnixNano()
+	fmt.Println("No master_seed in settings, using:", settings.MasterSeed)
+}
+
 func NewSessionMap() *SessionMap {
 	return &SessionMap{
 		Sessions: make(map[string]*OpenSession),
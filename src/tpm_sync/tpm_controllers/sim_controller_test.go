@@ -0,0 +1,210 @@
+package tpm_controllers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestDeriveSessionSeed checks that instances that differ in a single swept value get their own seeds, and that the settings
+// that aren't swept don't change the seed
+func TestDeriveSessionSeed(t *testing.T) {
+	type instance struct {
+		swept bool
+		SweepInstance
+		base BaseSettings
+	}
+	instances := map[string]instance{
+		"base":           {swept: true},
+		"learn rule":     {swept: true, SweepInstance: SweepInstance{LearnRule: "ANTI-HEBBIAN"}},
+		"boundary":       {swept: true, SweepInstance: SweepInstance{BoundaryMode: "REFLECT"}},
+		"query field":    {swept: true, SweepInstance: SweepInstance{QueryField: 1.5}},
+		"l":              {swept: true, SweepInstance: SweepInstance{L: 4}},
+		"m":              {swept: true, SweepInstance: SweepInstance{M: 2}},
+		"learn step":     {swept: true, SweepInstance: SweepInstance{LearnSettings: LearnSettings{LearnStep: 2}}},
+		"learn units":    {swept: true, SweepInstance: SweepInstance{LearnSettings: LearnSettings{LearnUnits: 1}}},
+		"sparse fan in":  {swept: true, SweepInstance: SweepInstance{SparseSettings: SparseSettings{FanIn: 2}}, base: BaseSettings{TpmType: "RANDOM_SPARSE"}},
+		"sparse wiring":  {swept: true, SweepInstance: SweepInstance{SparseSettings: SparseSettings{FanIn: 2, WiringSeed: 7}}, base: BaseSettings{TpmType: "RANDOM_SPARSE"}},
+		"strided window": {swept: true, SweepInstance: SweepInstance{WindowSettings: WindowSettings{Window: 2}}, base: BaseSettings{TpmType: "STRIDED_WINDOW"}},
+		"window wrap":    {swept: true, SweepInstance: SweepInstance{WindowSettings: WindowSettings{Window: 2, WindowWrap: true}}, base: BaseSettings{TpmType: "STRIDED_WINDOW"}},
+		"tpm type":       {swept: true, base: BaseSettings{TpmType: "PARTIALLY_CONNECTED"}},
+		"attack":         {base: BaseSettings{AttackSettings: AttackSettings{AttackType: "GEOMETRIC"}}},
+		"sync criterion": {base: BaseSettings{SyncSettings: SyncSettings{SyncCriterion: "OVERLAP", SyncThreshold: 0.9}}},
+		"key bits":       {base: BaseSettings{KeySettings: KeySettings{KeyBits: 128}}},
+		"channel":        {base: BaseSettings{ChannelSettings: ChannelSettings{ChannelFlipProbability: 0.01}}},
+		"stimulus":       {base: BaseSettings{StimulusSettings: StimulusSettings{StimulusGenerator: "BINARY"}}},
+		"numerics":       {base: BaseSettings{NumericsSettings: NumericsSettings{FieldMode: "EXACT"}}},
+		"learn layers":   {base: BaseSettings{LearnLayers: "LAST"}},
+		"kernel":         {base: BaseSettings{Kernel: "PACKED"}},
+	}
+
+	seeds := map[int64]string{}
+	var baseSeed int64
+	unswept := map[string]int64{}
+	for name, instance := range instances {
+		if instance.LearnRule == "" {
+			instance.LearnRule = "HEBBIAN"
+		}
+		if instance.base.TpmType == "" {
+			instance.base.TpmType = "FULLY_CONNECTED"
+		}
+		if instance.L == 0 {
+			instance.L = 3
+		}
+		if instance.M == 0 {
+			instance.M = 1
+		}
+		instance.K, instance.N0 = []int{3, 2}, 4
+		tpmSettings, err := SyncController{}.SweepSettingsFactory(instance.SweepInstance, instance.base)
+		if err != nil {
+			t.Fatalf("%s: SweepSettingsFactory failed: %v", name, err)
+		}
+		seed, err := DeriveSessionSeed(42, tpmSettings, 0)
+		if err != nil {
+			t.Fatalf("%s: DeriveSessionSeed failed: %v", name, err)
+		}
+		if !instance.swept {
+			unswept[name] = seed
+			continue
+		}
+		if name == "base" {
+			baseSeed = seed
+		}
+		if other, taken := seeds[seed]; taken {
+			t.Errorf("%s and %s get the same seed", name, other)
+		}
+		seeds[seed] = name
+		if again, _ := DeriveSessionSeed(42, tpmSettings, 0); again != seed {
+			t.Errorf("%s: the seed changed from %d to %d", name, seed, again)
+		}
+		other, _ := DeriveSessionSeed(42, tpmSettings, 1)
+		otherMaster, _ := DeriveSessionSeed(43, tpmSettings, 0)
+		if other == seed || otherMaster == seed {
+			t.Errorf("%s: the seed doesn't depend on the session index or the master seed", name)
+		}
+	}
+	for name, seed := range unswept {
+		if seed != baseSeed {
+			t.Errorf("%s changes the seed from %d to %d", name, baseSeed, seed)
+		}
+	}
+	//Seeds have to survive new settings, a change here means every stored sweep gets new seeds
+	const baseSessionSeed = -1351486187585157226
+	if baseSeed != baseSessionSeed {
+		t.Errorf("the base instance gets the seed %d, stamp version %d gave %d", baseSeed, seedStampVersion, baseSessionSeed)
+	}
+	if _, err := DeriveSessionSeed(42, TPMmSettings{QueryField: math.NaN()}, 0); err == nil {
+		t.Errorf("DeriveSessionSeed stamped a NaN query field")
+	}
+}
+
+// storedSessionController stores one session in a temporary SQLite database and returns it with the id of the session
+func storedSessionController(t *testing.T) (*SimulationController, int) {
+	t.Helper()
+	dbController, err := NewSQLiteDatabaseController(filepath.Join(t.TempDir(), "sessions.db"), "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbController.CloseDb() })
+
+	s := SyncController{}
+	tpmSettings, err := s.SweepSettingsFactory(SweepInstance{K: []int{3}, N0: 4, L: 2, M: 1, LearnRule: "HEBBIAN"}, BaseSettings{TpmType: "FULLY_CONNECTED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionData := s.StartSyncSession(tpmSettings, false, nil, nil, 100000, 10, 100, 5, rand.New(rand.NewSource(5)))
+	if err := dbController.InsertSession(tpmSettings, sessionData, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return &SimulationController{SyncController: s, DatabaseController: dbController}, 1
+}
+
+func TestReplaySession(t *testing.T) {
+	simController, sessionId := storedSessionController(t)
+	stateChannel := make(chan SessionStateMessage)
+	if err := simController.ReplaySession("sessions", sessionId, stateChannel); err != nil {
+		t.Fatalf("ReplaySession failed: %v", err)
+	}
+	var last SessionStateMessage
+	for message := range stateChannel {
+		last = message
+	}
+	if result, isResult := last.SessionState.(ReplayResult); last.CommandType != "replay_result" || !isResult || !result.Matches {
+		t.Errorf("the replay ended with %+v", last)
+	}
+}
+
+// TestReplaySessionErrors checks the errors the replay endpoint tells apart: a missing session and stored settings that can't be rebuilt
+func TestReplaySessionErrors(t *testing.T) {
+	simController, sessionId := storedSessionController(t)
+
+	err := simController.ReplaySession("sessions", sessionId+1, make(chan SessionStateMessage))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ReplaySession of a missing session returned %v, want sql.ErrNoRows", err)
+	}
+
+	db := simController.DatabaseController.(*SQLiteDatabaseController).db
+	if _, err := db.Exec("UPDATE sessions SET tpm_type = 'UNKNOWN' WHERE id = ?", sessionId); err != nil {
+		t.Fatal(err)
+	}
+	err = simController.ReplaySession("sessions", sessionId, make(chan SessionStateMessage))
+	if !errors.Is(err, ErrInvalidStoredSettings) || errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ReplaySession of invalid settings returned %v, want ErrInvalidStoredSettings", err)
+	}
+}
+
+// TestForEachSweepInstance checks that a sweep visits every combination of the swept values, with the structure changing fastest
+func TestForEachSweepInstance(t *testing.T) {
+	s := &SimulationController{}
+	tests := []struct {
+		name     string
+		settings string
+		want     int
+	}{
+		{"overlapped", `{"tpm_type": "FULLY_CONNECTED", "learn_rules": ["HEBBIAN", "RANDOM-WALK"], "boundary_modes": ["CLIP", "WRAP"],
+			"learn_steps": [1, 2], "m_configs": [1], "l_configs": [2, 3], "k_configs": [[3], [2, 1]], "n0_configs": [4, 5]}`, 2 * 2 * 2 * 2 * 2 * 2},
+		{"no overlap", `{"tpm_type": "NO_OVERLAP", "learn_rules": ["HEBBIAN"], "m_configs": [1, 2], "l_configs": [3],
+			"n_configs": [[4, 2], [6, 3]], "klast_configs": [1]}`, 2 * 2},
+		{"learn params", `{"tpm_type": "FULLY_CONNECTED", "learn_rules": ["HEBBIAN"], "m_configs": [1], "l_configs": [2],
+			"learn_probabilities": [0.5, 1], "learn_units": [0, 1, 2], "k_configs": [[3]], "n0_configs": [4, 5]}`, 2 * 3 * 2},
+		{"no learn rules", `{"tpm_type": "FULLY_CONNECTED", "m_configs": [1], "l_configs": [2], "k_configs": [[3]], "n0_configs": [4]}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseSettings, err := UnmarshalSettings([]byte(test.settings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var visited []TPMmSettings
+			err = s.forEachSweepInstance(baseSettings, []byte(test.settings), func(tpmInstanceSettings TPMmSettings, err error) bool {
+				if err != nil {
+					t.Errorf("instance %d failed: %v", len(visited), err)
+				}
+				visited = append(visited, tpmInstanceSettings)
+				return true
+			})
+			if err != nil || len(visited) != test.want {
+				t.Fatalf("visited %d instances with error %v, want %d", len(visited), err, test.want)
+			}
+			if len(visited) > 1 && reflect.DeepEqual(visited[0].K, visited[1].K) && visited[0].N[0] == visited[1].N[0] {
+				t.Errorf("the first two instances have the same structure, %v %v", visited[0].K, visited[0].N)
+			}
+		})
+	}
+
+	settings := `{"tpm_type": "FULLY_CONNECTED", "learn_rules": ["HEBBIAN"], "m_configs": [1], "l_configs": [2, 3], "k_configs": [[3]], "n0_configs": [4]}`
+	baseSettings, _ := UnmarshalSettings([]byte(settings))
+	visits := 0
+	s.forEachSweepInstance(baseSettings, []byte(settings), func(TPMmSettings, error) bool {
+		visits++
+		return false
+	})
+	if visits != 1 {
+		t.Errorf("the sweep went on for %d instances after visit returned false", visits)
+	}
+}
@@ -3,6 +3,7 @@ package tpm_controllers
 import (
 	"sync"
 	"time"
+	"tpm_sync/tpm_stimHandlers"
 )
 
 type OpenSession struct {
@@ -39,13 +40,201 @@ type SimulationSettings struct {
 }
 
 type BaseSettings struct {
-	TpmType         string   `json:"tpm_type"`
-	MaxSessionCount int      `json:"max_session_count"`
-	MaxIterations   int      `json:"max_iterations"`
-	MaxWorkerCount  int      `json:"max_worker_count"`
-	LearnRules      []string `json:"learn_rules"`
-	MConfigs        []int    `json:"m_configs"`
-	LConfigs        []int    `json:"l_configs"`
+	TpmType         string                         `json:"tpm_type"`
+	MaxSessionCount int                            `json:"max_session_count"`
+	MaxIterations   int                            `json:"max_iterations"`
+	MaxWorkerCount  int                            `json:"max_worker_count"`
+	MasterSeed      int64                          `json:"master_seed"` // 0 means a master seed is picked from the clock and logged
+	Connectivity    *tpm_stimHandlers.Connectivity `json:"connectivity"`
+	Kernel          string                         `json:"kernel"` // REFERENCE by default, every kernel gives the same sessions
+	AttackSettings
+	SyncSettings
+	KeySettings
+	ChannelSettings
+	GroupSettings
+	VariantSettings
+	StimulusSettings
+	NumericsSettings
+	//The lists are swept, an empty one sweeps only the default of its setting
+	LearnRules         []string  `json:"learn_rules"` // a rule for every layer or a comma separated list with one rule per layer
+	LearnLayers        string    `json:"learn_layers"`
+	LearnSteps         []int     `json:"learn_steps"`
+	LearnProbabilities []float64 `json:"learn_probabilities"`
+	LearnUnitConfigs   []int     `json:"learn_units"`
+	BoundaryModes      []string  `json:"boundary_modes"`
+	QueryFields        []float64 `json:"query_fields"`
+	FanInConfigs       []int     `json:"fan_in_configs"`
+	WiringSeeds        []int64   `json:"wiring_seeds"`
+	WindowConfigs      []int     `json:"window_configs"`
+	StrideConfigs      []int     `json:"stride_configs"`
+	WindowWrap         bool      `json:"window_wrap"`
+	MConfigs           []int     `json:"m_configs"`
+	LConfigs           []int     `json:"l_configs"`
+}
+
+// SweepInstance holds the swept values of one instance of a sweep, the rest of its settings come from the base settings.
+// NO_OVERLAP TPMs read K as the N of every layer and N0 as the last K
+type SweepInstance struct {
+	K            []int
+	N0           int
+	L            int
+	M            int
+	LearnRule    string
+	BoundaryMode string
+	QueryField   float64
+	SparseSettings
+	WindowSettings
+	LearnSettings
+}
+
+// sweepAxis is one swept value, set stores its value i in an instance
+type sweepAxis struct {
+	count int
+	set   func(instance *SweepInstance, i int)
+}
+
+func newSweepAxis[T any](values []T, set func(instance *SweepInstance, value T)) sweepAxis {
+	return sweepAxis{
+		count: len(values),
+		set: func(instance *SweepInstance, i int) {
+			set(instance, values[i])
+		},
+	}
+}
+
+// sweepValues lists the values to sweep, settings files without them only use the fallback
+func sweepValues[T any](values []T, fallback T) []T {
+	if len(values) == 0 {
+		return []T{fallback}
+	}
+	return values
+}
+
+// sweepAxes lists the swept values of the base settings, the structures come from k_configs and n0_configs or from n_configs
+// and klast_configs. The sweep changes the last axis fastest
+func (baseSettings BaseSettings) sweepAxes(ks [][]int, n0s []int) []sweepAxis {
+	return []sweepAxis{
+		newSweepAxis(baseSettings.LearnRules, func(instance *SweepInstance, rule string) { instance.LearnRule = rule }),
+		newSweepAxis(sweepValues(baseSettings.BoundaryModes, "CLIP"), func(instance *SweepInstance, mode string) { instance.BoundaryMode = mode }),
+		newSweepAxis(sweepValues(baseSettings.QueryFields, 0), func(instance *SweepInstance, field float64) { instance.QueryField = field }),
+		newSweepAxis(sweepValues(baseSettings.FanInConfigs, 0), func(instance *SweepInstance, fanIn int) { instance.FanIn = fanIn }),
+		newSweepAxis(sweepValues(baseSettings.WiringSeeds, 0), func(instance *SweepInstance, seed int64) { instance.WiringSeed = seed }),
+		newSweepAxis(sweepValues(baseSettings.WindowConfigs, 0), func(instance *SweepInstance, window int) { instance.Window = window }),
+		newSweepAxis(sweepValues(baseSettings.StrideConfigs, 1), func(instance *SweepInstance, stride int) { instance.Stride = stride }),
+		newSweepAxis([]bool{baseSettings.WindowWrap}, func(instance *SweepInstance, wrap bool) { instance.WindowWrap = wrap }),
+		newSweepAxis(sweepValues(baseSettings.LearnSteps, 1), func(instance *SweepInstance, step int) { instance.LearnStep = step }),
+		newSweepAxis(sweepValues(baseSettings.LearnProbabilities, 1), func(instance *SweepInstance, probability float64) { instance.LearnProbability = probability }),
+		newSweepAxis(sweepValues(baseSettings.LearnUnitConfigs, 0), func(instance *SweepInstance, units int) { instance.LearnUnits = units }),
+		newSweepAxis(baseSettings.MConfigs, func(instance *SweepInstance, m int) { instance.M = m }),
+		newSweepAxis(baseSettings.LConfigs, func(instance *SweepInstance, l int) { instance.L = l }),
+		newSweepAxis(ks, func(instance *SweepInstance, k []int) { instance.K = k }),
+		newSweepAxis(n0s, func(instance *SweepInstance, n_0 int) { instance.N0 = n_0 }),
+	}
+}
+
+// sweepInstances passes every combination of the values of the axes to visit, which returns false to stop
+func sweepInstances(axes []sweepAxis, visit func(instance SweepInstance) bool) {
+	for _, axis := range axes {
+		if axis.count == 0 {
+			return
+		}
+	}
+	indices := make([]int, len(axes))
+	for {
+		var instance SweepInstance
+		for i, axis := range axes {
+			axis.set(&instance, indices[i])
+		}
+		if !visit(instance) {
+			return
+		}
+		axis := len(axes) - 1
+		for ; axis >= 0; axis-- {
+			indices[axis]++
+			if indices[axis] < axes[axis].count {
+				break
+			}
+			indices[axis] = 0
+		}
+		if axis < 0 {
+			return
+		}
+	}
+}
+
+// AttackSettings configures the eavesdropper that runs alongside A and B
+type AttackSettings struct {
+	AttackType      string `json:"attack_type"`
+	AttackLearnRule string `json:"attack_learn_rule"` // empty means the same rule as A and B
+	AttackerCount   int    `json:"attacker_count"`
+	PopulationCap   int    `json:"population_cap"` // most networks the GENETIC attack can have before it starts pruning
+	MutationCount   int    `json:"mutation_count"` // variants spawned by each member of the GENETIC attack
+}
+
+// SyncSettings configures when a session stops
+type SyncSettings struct {
+	SyncCriterion          string  `json:"sync_criterion"`
+	SyncThreshold          float64 `json:"sync_threshold"`
+	SyncConsecutiveOutputs int     `json:"sync_consecutive_outputs"`
+	AbortOnAttackerSync    bool    `json:"abort_on_attacker_sync"`
+}
+
+// KeySettings configures how the key is derived from the synchronized weights
+type KeySettings struct {
+	Kdf     string `json:"kdf"`
+	KeyBits int    `json:"key_bits"`
+}
+
+// ChannelSettings configures the noise on the outputs exchanged by A and B, all zero means a perfect channel
+type ChannelSettings struct {
+	ChannelFlipProbability  float64 `json:"channel_flip_probability"`
+	ChannelBurstProbability float64 `json:"channel_burst_probability"`
+	ChannelBurstLength      int     `json:"channel_burst_length"`
+	ChannelDropProbability  float64 `json:"channel_drop_probability"`
+}
+
+// GroupSettings configures group key agreement between more than two parties
+type GroupSettings struct {
+	PartyCount    int    `json:"party_count"`    // 2 (default) runs the usual A and B session
+	GroupTopology string `json:"group_topology"` // STAR: everyone learns when all outputs agree, RING: every party learns from the party before it
+}
+
+// VariantSettings configures the VECTOR_VALUED and COMPLEX_VALUED TPM types
+type VariantSettings struct {
+	OutputClasses int `json:"output_classes"` // classes of every VECTOR_VALUED hidden unit, 3 by default
+}
+
+// SparseSettings configures the RANDOM_SPARSE TPM type, they are swept through fan_in_configs and wiring_seeds
+type SparseSettings struct {
+	FanIn      int   `json:"fan_in"`      // inputs of every hidden unit after the first layer, 0 means every output of the layer before
+	WiringSeed int64 `json:"wiring_seed"` // seed of the random wiring, 0 means it is derived from the session seed
+}
+
+// LearnSettings are the params of the learn rules, they are swept through learn_steps, learn_probabilities and learn_units
+type LearnSettings struct {
+	LearnStep        int     `json:"learn_step"`
+	LearnProbability float64 `json:"learn_probability"`
+	LearnUnits       int     `json:"learn_units"` // agreeing hidden units updated per layer, the ones with the smallest |local field|, 0 means all
+}
+
+// WindowSettings configures the STRIDED_WINDOW TPM type, they are swept through window_configs and stride_configs
+type WindowSettings struct {
+	Window     int  `json:"window"` // outputs of the layer before read by every hidden unit, 0 means the window that covers the layer exactly
+	Stride     int  `json:"stride"` // 0 means 1
+	WindowWrap bool `json:"window_wrap"`
+}
+
+// NumericsSettings configure how the hidden units compute their local fields and outputs
+type NumericsSettings struct {
+	FieldMode string `json:"field_mode"` // FAST normalises with FastInverseSqrt and EXACT takes the sign of the integer field, empty means FAST
+	ZeroField string `json:"zero_field"` // output of a zero local field, empty means NEGATIVE
+}
+
+// StimulusSettings configures how the public stimulus of every iteration is generated
+type StimulusSettings struct {
+	StimulusGenerator string  `json:"stimulus_generator"`
+	StimulusSigma     float64 `json:"stimulus_sigma"` // deviation of the GAUSSIAN generator, m/2 by default
+	StimulusBias      float64 `json:"stimulus_bias"`  // mean sign of the BIASED generator, in ]-1, 1[
 }
 
 type OverlappedSettings struct {
@@ -59,3 +248,17 @@ type NonOverlappedSettings struct {
 	KlastConfigs []int   `json:"klast_configs"`
 	NConfigs     [][]int `json:"n_configs"`
 }
+
+// ReplayResult compares a replayed session against the stored one
+type ReplayResult struct {
+	SessionId                   int
+	Seed                        int64
+	StoredStatus                string
+	ReplayedStatus              string
+	StoredStimulateIterations   int
+	ReplayedStimulateIterations int
+	StoredLearnIterations       int
+	ReplayedLearnIterations     int
+	FinalStateMatches           bool
+	Matches                     bool
+}
@@ -1,80 +1,761 @@
 package tpm_controllers
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"strings"
+	"tpm_sync/tpm_attacks"
+	"tpm_sync/tpm_channels"
 	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_keyDerivation"
 	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_registry"
+	"tpm_sync/tpm_stimGenerators"
 	"tpm_sync/tpm_stimHandlers"
+	"tpm_sync/tpm_syncCriteria"
+	"tpm_sync/tpm_variants"
 )
 
 // import "fmt"
 type SyncController struct {
 }
 
-func (SyncController) SettingsFactory(K []int, n_0 int, l int, m int, tpmType string, learnRule string) (TPMmSettings, error) {
-
-	var stimHandler tpm_stimHandlers.TPMStimulationHandlers
-	var ruleHandler tpm_learnRules.TPMLearnRuleHandler
-
-	reverseParameters := false // this is because the no overlap os defined by the stimulus, so K[] is actually N[] and n_0 is actually k_last
+// SettingsFactory creates the settings of a TPM, connectivity is only used by ADJACENCY TPMs and can be nil for the rest,
+// and windowSettings is only used by STRIDED_WINDOW TPMs
+func (SyncController) SettingsFactory(K []int, n_0 int, l int, m int, tpmType string, learnRule string, connectivity *tpm_stimHandlers.Connectivity, windowSettings WindowSettings) (TPMmSettings, error) {
 
 	K = copySlice(K)
 
-	switch parsed_tpmType := strings.ToUpper(tpmType); parsed_tpmType {
-	case "PARTIALLY_CONNECTED":
-		stimHandler = tpm_stimHandlers.PartialConnectionTPM{}
-	case "FULLY_CONNECTED":
-		stimHandler = tpm_stimHandlers.FullConnectionTPM{}
-	case "NO_OVERLAP":
-		stimHandler = tpm_stimHandlers.NoOverlapTPM{}
-		reverseParameters = true
-	}
-	if stimHandler == nil {
+	registeredType, isRegistered := tpm_stimHandlers.Lookup(tpmType)
+	if !isRegistered {
 		return TPMmSettings{}, fmt.Errorf("TPM type is invalid: %s", tpmType)
 	}
-
-	switch parsed_learnRule := strings.ToUpper(learnRule); parsed_learnRule {
-	case "HEBBIAN":
-		ruleHandler = tpm_learnRules.HebbianLearnRule{}
-	case "ANTI-HEBBIAN":
-		ruleHandler = tpm_learnRules.AntiHebbianLearnRule{}
-	case "RANDOM-WALK":
-		ruleHandler = tpm_learnRules.RandomWalkLearnRule{}
+	stimHandler, err := registeredType.Factory(tpm_stimHandlers.HandlerConfig{
+		Connectivity: connectivity,
+		Window:       windowSettings.Window,
+		Stride:       windowSettings.Stride,
+		Wrap:         windowSettings.WindowWrap,
+	})
+	if err != nil {
+		return TPMmSettings{}, err
 	}
-	if ruleHandler == nil {
-		return TPMmSettings{}, fmt.Errorf("TPM rule is invalid: %s", learnRule)
+	if windowHandler, isWindow := stimHandler.(tpm_stimHandlers.StridedWindowTPM); isWindow {
+		windowSettings = WindowSettings{Window: windowHandler.Window, Stride: windowHandler.Stride, WindowWrap: windowHandler.Wrap}
+	} else {
+		windowSettings = WindowSettings{}
 	}
 
-	N := stimHandler.CreateStimulationStructure(K, n_0)
-	if reverseParameters {
+	neuronHandler, isVariant := tpm_variants.Neurons(registeredType.Name)
+	if isVariant {
+		//The variants only have one hidden layer, so the stimulation handler is never used to link layers
+		if len(K) != 1 {
+			return TPMmSettings{}, fmt.Errorf("%s TPMs have a single hidden layer: %v", registeredType.Name, K)
+		}
+		n_0 *= neuronHandler.InputWidth()
+	}
+
+	N, err := stimHandler.CreateStimulationStructure(K, n_0)
+	if err != nil {
+		return TPMmSettings{}, fmt.Errorf("TPM structure is invalid for %s %v: %v", tpmType, K, err)
+	}
+	if registeredType.ReverseParameters {
+		// the structure is defined by the stimulus, so K[] is actually N[] and n_0 is actually k_last
 		aux := N
 		N = K
 		K = aux
 	}
 
+	ruleHandlers, err := learnRulesFactory(learnRule, len(K), tpm_core.BoundaryClip, tpm_learnRules.DefaultParams)
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+
 	return TPMmSettings{
 		K:                   K,
 		N:                   N,
 		L:                   l,
 		M:                   m,
 		H:                   len(K),
-		LearnRule:           learnRule,
-		LinkType:            tpmType,
-		learnRuleHandler:    ruleHandler,
+		LearnRule:           tpm_learnRules.NormalizeLayerRules(learnRule),
+		LinkType:            registeredType.Name,
+		Connectivity:        connectivity,
+		WindowSettings:      windowSettings,
+		BoundaryMode:        "CLIP",
+		LearnLayers:         "ALL",
+		LearnSettings:       LearnSettings{LearnStep: tpm_learnRules.DefaultParams.Step, LearnProbability: tpm_learnRules.DefaultParams.Probability},
+		AttackSettings:      AttackSettings{AttackType: "NONE"},
+		SyncSettings:        SyncSettings{SyncCriterion: "EXACT_WEIGHTS"},
+		syncCriterion:       tpm_syncCriteria.ExactWeightsCriterion{},
+		KeySettings:         KeySettings{Kdf: "HKDF-SHA256", KeyBits: 256},
+		GroupSettings:       GroupSettings{PartyCount: 2, GroupTopology: "PAIR"},
+		StimulusSettings:    StimulusSettings{StimulusGenerator: "UNIFORM"},
+		NumericsSettings:    NumericsSettings{FieldMode: "FAST", ZeroField: "NEGATIVE"},
+		kdfHandler:          tpm_keyDerivation.HKDFHandler{Hash: sha256.New, Info: []byte(kdfInfo)},
+		learnRuleHandlers:   ruleHandlers,
+		layerSelection:      tpm_learnRules.AllLayers{},
 		stimulationHandlers: stimHandler,
+		neuronHandler:       neuronHandler,
 	}, nil
 }
 
-func (s SyncController) CreateSessionInstance(tpmSettings TPMmSettings, localRand *rand.Rand) TPMmSessionState {
+func learnRuleFactory(learnRule string, boundary tpm_core.WeightBoundary, params tpm_learnRules.Params) (tpm_learnRules.TPMLearnRuleHandler, error) {
+	ruleHandler, isRegistered := tpm_learnRules.New(learnRule, boundary, params)
+	if !isRegistered {
+		return nil, fmt.Errorf("TPM rule is invalid: %s", learnRule)
+	}
+	return ruleHandler, nil
+}
+
+// learnRulesFactory creates the learn rule of every layer, learnRule is either a single rule for all of them
+// or a comma separated list with one rule per layer, like "HEBBIAN,RANDOM-WALK"
+func learnRulesFactory(learnRule string, h int, boundary tpm_core.WeightBoundary, params tpm_learnRules.Params) ([]tpm_learnRules.TPMLearnRuleHandler, error) {
+	layerRules := tpm_learnRules.ParseLayerRules(learnRule)
+	if len(layerRules) != 1 && len(layerRules) != h {
+		return nil, fmt.Errorf("learn rule lists %d rules and the TPM has %d layers, it needs one rule or one per layer: %s", len(layerRules), h, learnRule)
+	}
+	ruleHandlers := make([]tpm_learnRules.TPMLearnRuleHandler, h)
+	for layer := range ruleHandlers {
+		params.Layer = layer
+		ruleHandler, err := learnRuleFactory(layerRules[layer%len(layerRules)], boundary, params)
+		if err != nil {
+			return nil, err
+		}
+		ruleHandlers[layer] = ruleHandler
+	}
+	return ruleHandlers, nil
+}
+
+func layerSelectionFactory(learnLayers string) (tpm_learnRules.TPMLayerSelection, error) {
+	switch parsed_learnLayers := strings.ToUpper(learnLayers); parsed_learnLayers {
+	case "", "ALL":
+		return tpm_learnRules.AllLayers{}, nil
+	case "LAST":
+		return tpm_learnRules.LastLayer{}, nil
+	case "AGREEING":
+		return tpm_learnRules.AgreeingLayers{}, nil
+	}
+	return nil, fmt.Errorf("learn layers is invalid: %s", learnLayers)
+}
+
+// LearnLayersSettingsFactory sets which layers learn on every iteration, an empty value means ALL
+func (SyncController) LearnLayersSettingsFactory(tpmSettings TPMmSettings, learnLayers string) (TPMmSettings, error) {
+	layerSelection, err := layerSelectionFactory(learnLayers)
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	if learnLayers == "" {
+		learnLayers = "ALL"
+	}
+	tpmSettings.LearnLayers = strings.ToUpper(learnLayers)
+	tpmSettings.layerSelection = layerSelection
+	return tpmSettings, nil
+}
+
+func boundaryFactory(boundaryMode string) (tpm_core.WeightBoundary, error) {
+	switch parsed_boundary := strings.ToUpper(boundaryMode); parsed_boundary {
+	case "", "CLIP":
+		return tpm_core.BoundaryClip, nil
+	case "REFLECT":
+		return tpm_core.BoundaryReflect, nil
+	case "WRAP":
+		return tpm_core.BoundaryWrap, nil
+	case "RESET":
+		return tpm_core.BoundaryReset, nil
+	}
+	return 0, fmt.Errorf("boundary mode is invalid: %s", boundaryMode)
+}
+
+// BoundarySettingsFactory sets what happens to weights pushed out of [-L, L], an empty mode means CLIP.
+// L has to be positive, with an L of 0 there's nothing to bound the weights to
+func (SyncController) BoundarySettingsFactory(tpmSettings TPMmSettings, boundaryMode string) (TPMmSettings, error) {
+	if tpmSettings.L < 1 {
+		return TPMmSettings{}, fmt.Errorf("L must be positive: %d", tpmSettings.L)
+	}
+	boundary, err := boundaryFactory(boundaryMode)
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	ruleHandlers, err := learnRulesFactory(tpmSettings.LearnRule, tpmSettings.H, boundary, tpmSettings.learnParams())
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	if boundaryMode == "" {
+		boundaryMode = "CLIP"
+	}
+	tpmSettings.BoundaryMode = strings.ToUpper(boundaryMode)
+	tpmSettings.weightBoundary = boundary
+	tpmSettings.learnRuleHandlers = ruleHandlers
+	return tpmSettings, nil
+}
+
+// LearnSettingsFactory sets the step, probability and units of the learn rule updates, zero values mean the fixed ±1 step
+// applied to every agreeing unit
+func (SyncController) LearnSettingsFactory(tpmSettings TPMmSettings, learnSettings LearnSettings) (TPMmSettings, error) {
+	if learnSettings.LearnStep == 0 {
+		learnSettings.LearnStep = tpm_learnRules.DefaultParams.Step
+	}
+	if learnSettings.LearnProbability == 0 {
+		learnSettings.LearnProbability = tpm_learnRules.DefaultParams.Probability
+	}
+	if learnSettings.LearnStep < 0 {
+		return TPMmSettings{}, fmt.Errorf("learn step must be positive: %d", learnSettings.LearnStep)
+	}
+	if learnSettings.LearnProbability < 0 || learnSettings.LearnProbability > 1 {
+		return TPMmSettings{}, fmt.Errorf("learn probability must be in ]0, 1]: %v", learnSettings.LearnProbability)
+	}
+	if learnSettings.LearnUnits < 0 {
+		return TPMmSettings{}, fmt.Errorf("learn units can't be negative: %d", learnSettings.LearnUnits)
+	}
+	tpmSettings.LearnSettings = learnSettings
+	ruleHandlers, err := learnRulesFactory(tpmSettings.LearnRule, tpmSettings.H, tpmSettings.weightBoundary, tpmSettings.learnParams())
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	tpmSettings.learnRuleHandlers = ruleHandlers
+	return tpmSettings, nil
+}
+
+// learnParams are the params of the learn rules, without the update skips that seedLearnRules adds per session
+func (tpmSettings TPMmSettings) learnParams() tpm_learnRules.Params {
+	return tpm_learnRules.Params{Step: tpmSettings.LearnStep, Probability: tpmSettings.LearnProbability, Units: tpmSettings.LearnUnits}
+}
+
+// seedLearnRules gives stochastic learn rules the update skips of a session. The skips are public like the stimulus, every party
+// and every attacker network read the same ones. The settings are shared by the sessions of an instance, so the rules are rebuilt instead of changed
+func (SyncController) seedLearnRules(tpmSettings TPMmSettings, seed int64) TPMmSettings {
+	params := tpmSettings.learnParams()
+	if !params.IsStochastic() {
+		return tpmSettings
+	}
+	params.Skips = tpm_learnRules.NewUpdateSkips(deriveStreamSeed(seed, "learn"))
+	tpmSettings.updateSkips = params.Skips
+	//The rules were already built from the same settings, so they can't fail here
+	tpmSettings.learnRuleHandlers, _ = learnRulesFactory(tpmSettings.LearnRule, tpmSettings.H, tpmSettings.weightBoundary, params)
+	if tpmSettings.attackLearnRuleHandlers != nil {
+		tpmSettings.attackLearnRuleHandlers, _ = learnRulesFactory(tpmSettings.AttackLearnRule, tpmSettings.H, tpmSettings.weightBoundary, params)
+	}
+	return tpmSettings
+}
+
+// SparseSettingsFactory sets the fan-in and wiring seed of RANDOM_SPARSE TPMs, the other types ignore them
+func (SyncController) SparseSettingsFactory(tpmSettings TPMmSettings, sparseSettings SparseSettings) (TPMmSettings, error) {
+	sparseHandler, isSparse := tpmSettings.stimulationHandlers.(tpm_stimHandlers.RandomSparseTPM)
+	if !isSparse {
+		tpmSettings.SparseSettings = SparseSettings{}
+		return tpmSettings, nil
+	}
+	sparseHandler.FanIn = sparseSettings.FanIn
+	N, err := sparseHandler.CreateStimulationStructure(tpmSettings.K, tpmSettings.N[0])
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	tpmSettings.N = N
+	tpmSettings.stimulationHandlers = sparseHandler
+	tpmSettings.SparseSettings = sparseSettings
+	return tpmSettings, nil
+}
+
+// wireSession draws the wiring of RANDOM_SPARSE TPMs, every party of the session and the attacker share it.
+// A zero WiringSeed means the wiring comes from the session seed, so every session gets its own
+func (SyncController) wireSession(tpmSettings TPMmSettings, seed int64) TPMmSettings {
+	sparseHandler, isSparse := tpmSettings.stimulationHandlers.(tpm_stimHandlers.RandomSparseTPM)
+	if !isSparse {
+		return tpmSettings
+	}
+	wiringSeed := tpmSettings.WiringSeed
+	if wiringSeed == 0 {
+		wiringSeed = deriveStreamSeed(seed, "wiring")
+	}
+	tpmSettings.stimulationHandlers = sparseHandler.Wire(tpmSettings.K, rand.New(rand.NewSource(wiringSeed)))
+	return tpmSettings
+}
+
+// QuerySettingsFactory sets the local field the queries aim for, 0 means A and B use random stimuli
+func (SyncController) QuerySettingsFactory(tpmSettings TPMmSettings, queryField float64) (TPMmSettings, error) {
+	if queryField < 0 {
+		return TPMmSettings{}, fmt.Errorf("query field can't be negative: %v", queryField)
+	}
+	if queryField > 0 && !tpmSettings.binaryOutputs() {
+		return TPMmSettings{}, fmt.Errorf("queries need binary outputs, %s TPMs don't have them", tpmSettings.LinkType)
+	}
+	tpmSettings.QueryField = queryField
+	return tpmSettings, nil
+}
+
+// queryStimulus makes the stimulus a query of the party whose turn it is, the parties take turns in order every iteration.
+// queryRand is nil when the session doesn't use queries
+func (SyncController) queryStimulus(tpmSettings TPMmSettings, stimulus [][]int, partyWeights [][][][]int, iteration int, queryRand *rand.Rand) {
+	if queryRand == nil {
+		return
+	}
+	weights := partyWeights[iteration%len(partyWeights)]
+	tpm_stimGenerators.QueryStimulus(stimulus, weights[0], tpmSettings.K[0], tpmSettings.N[0], tpmSettings.QueryField, queryRand)
+}
+
+// createQueryRand creates the random stream used by the queries, it is derived from the session seed so the stimulus stream doesn't change
+func (SyncController) createQueryRand(tpmSettings TPMmSettings, seed int64) *rand.Rand {
+	if tpmSettings.QueryField == 0 {
+		return nil
+	}
+	return rand.New(rand.NewSource(deriveStreamSeed(seed, "query")))
+}
+
+// AttackSettingsFactory adds an eavesdropper to the settings, an empty AttackLearnRule means the attacker uses the same rule as A and B
+func (SyncController) AttackSettingsFactory(tpmSettings TPMmSettings, attackSettings AttackSettings) (TPMmSettings, error) {
+	parsed_attackType := strings.ToUpper(attackSettings.AttackType)
+	if parsed_attackType == "" || parsed_attackType == "NONE" {
+		tpmSettings.AttackSettings = AttackSettings{AttackType: "NONE"}
+		tpmSettings.attackLearnRuleHandlers = nil
+		return tpmSettings, nil
+	}
+	if !tpmSettings.binaryOutputs() {
+		return TPMmSettings{}, fmt.Errorf("the %s attack needs binary outputs, %s TPMs don't have them", parsed_attackType, tpmSettings.LinkType)
+	}
+
+	switch parsed_attackType {
+	case "SIMPLE", "GEOMETRIC":
+		attackSettings = AttackSettings{AttackType: parsed_attackType, AttackLearnRule: attackSettings.AttackLearnRule, AttackerCount: 1}
+	case "MAJORITY":
+		if attackSettings.AttackerCount < 1 {
+			return TPMmSettings{}, fmt.Errorf("attacker count must be positive for the %s attack: %d", parsed_attackType, attackSettings.AttackerCount)
+		}
+		attackSettings = AttackSettings{AttackType: parsed_attackType, AttackLearnRule: attackSettings.AttackLearnRule, AttackerCount: attackSettings.AttackerCount}
+	case "GENETIC":
+		if attackSettings.PopulationCap < 1 || attackSettings.MutationCount < 1 {
+			return TPMmSettings{}, fmt.Errorf("population cap and mutation count must be positive for the %s attack: %d, %d", parsed_attackType, attackSettings.PopulationCap, attackSettings.MutationCount)
+		}
+		attackSettings.AttackType = parsed_attackType
+		attackSettings.AttackerCount = 1
+	default:
+		return TPMmSettings{}, fmt.Errorf("attack type is invalid: %s", attackSettings.AttackType)
+	}
+
+	if attackSettings.AttackLearnRule == "" {
+		attackSettings.AttackLearnRule = tpmSettings.LearnRule
+	}
+	attackSettings.AttackLearnRule = tpm_learnRules.NormalizeLayerRules(attackSettings.AttackLearnRule)
+	ruleHandlers, err := learnRulesFactory(attackSettings.AttackLearnRule, tpmSettings.H, tpmSettings.weightBoundary, tpmSettings.learnParams())
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	tpmSettings.AttackSettings = attackSettings
+	tpmSettings.attackLearnRuleHandlers = ruleHandlers
+	return tpmSettings, nil
+}
+
+// SyncCriterionSettingsFactory sets when A and B are considered synchronized, an empty criterion means exact weight equality
+func (SyncController) SyncCriterionSettingsFactory(tpmSettings TPMmSettings, syncSettings SyncSettings) (TPMmSettings, error) {
+	var criterion tpm_syncCriteria.TPMSyncCriterion
+
+	switch parsed_criterion := strings.ToUpper(syncSettings.SyncCriterion); parsed_criterion {
+	case "", "EXACT_WEIGHTS":
+		criterion = tpm_syncCriteria.ExactWeightsCriterion{}
+		syncSettings = SyncSettings{SyncCriterion: "EXACT_WEIGHTS", AbortOnAttackerSync: syncSettings.AbortOnAttackerSync}
+	case "OVERLAP":
+		if syncSettings.SyncThreshold <= 0 || syncSettings.SyncThreshold > 1 {
+			return TPMmSettings{}, fmt.Errorf("sync threshold must be in ]0, 1] for the %s criterion: %v", parsed_criterion, syncSettings.SyncThreshold)
+		}
+		criterion = tpm_syncCriteria.OverlapCriterion{Threshold: syncSettings.SyncThreshold}
+		syncSettings = SyncSettings{SyncCriterion: parsed_criterion, SyncThreshold: syncSettings.SyncThreshold, AbortOnAttackerSync: syncSettings.AbortOnAttackerSync}
+	case "CONSECUTIVE_OUTPUTS":
+		if syncSettings.SyncConsecutiveOutputs < 1 {
+			return TPMmSettings{}, fmt.Errorf("consecutive outputs must be positive for the %s criterion: %d", parsed_criterion, syncSettings.SyncConsecutiveOutputs)
+		}
+		criterion = tpm_syncCriteria.ConsecutiveOutputsCriterion{Count: syncSettings.SyncConsecutiveOutputs}
+		syncSettings = SyncSettings{SyncCriterion: parsed_criterion, SyncConsecutiveOutputs: syncSettings.SyncConsecutiveOutputs, AbortOnAttackerSync: syncSettings.AbortOnAttackerSync}
+	default:
+		return TPMmSettings{}, fmt.Errorf("sync criterion is invalid: %s", syncSettings.SyncCriterion)
+	}
+
+	if syncSettings.AbortOnAttackerSync && tpmSettings.AttackType == "NONE" {
+		return TPMmSettings{}, fmt.Errorf("abort on attacker sync needs an attack type")
+	}
+
+	tpmSettings.SyncSettings = syncSettings
+	tpmSettings.syncCriterion = criterion
+	return tpmSettings, nil
+}
+
+// VariantSettingsFactory sets the options of the TPM variants, OutputClasses is only used by VECTOR_VALUED TPMs and 0 means the default
+func (SyncController) VariantSettingsFactory(tpmSettings TPMmSettings, variantSettings VariantSettings) (TPMmSettings, error) {
+	vectorNeurons, isVector := tpmSettings.neuronHandler.(tpm_variants.VectorNeurons)
+	if !isVector {
+		tpmSettings.VariantSettings = VariantSettings{}
+		return tpmSettings, nil
+	}
+	if variantSettings.OutputClasses == 0 {
+		variantSettings.OutputClasses = tpm_variants.DefaultOutputClasses
+	}
+	if variantSettings.OutputClasses < 2 {
+		return TPMmSettings{}, fmt.Errorf("output classes must be at least 2: %d", variantSettings.OutputClasses)
+	}
+
+	//The rows hold one weight per class, so they have to be resized
+	inputs := tpmSettings.N[0] / vectorNeurons.Classes
+	tpmSettings.N = []int{inputs * variantSettings.OutputClasses}
+	tpmSettings.neuronHandler = tpm_variants.VectorNeurons{Classes: variantSettings.OutputClasses}
+	tpmSettings.VariantSettings = variantSettings
+	return tpmSettings, nil
+}
+
+// InputsPerUnit is the amount of inputs of every hidden unit of the first layer, which for the variants is less than the row length
+func (tpmSettings TPMmSettings) InputsPerUnit() int {
+	return tpmSettings.N[0] / tpmSettings.neuronHandler.InputWidth()
+}
+
+// binaryOutputs is false for the variants, whose outputs can't be negated or sent as a single bit
+func (tpmSettings TPMmSettings) binaryOutputs() bool {
+	_, isBinary := tpmSettings.neuronHandler.(tpm_variants.BinaryNeurons)
+	return isBinary
+}
+
+// kdfInfo binds the derived keys to this application
+const kdfInfo = "tpm_sync key"
+
+// KeySettingsFactory sets the KDF used on the synchronized weights, an empty Kdf means HKDF-SHA256 and a zero KeyBits means 256
+func (SyncController) KeySettingsFactory(tpmSettings TPMmSettings, keySettings KeySettings) (TPMmSettings, error) {
+	var kdf tpm_keyDerivation.HKDFHandler
+
+	switch parsed_kdf := strings.ToUpper(keySettings.Kdf); parsed_kdf {
+	case "", "HKDF-SHA256":
+		kdf = tpm_keyDerivation.HKDFHandler{Hash: sha256.New, Info: []byte(kdfInfo)}
+		keySettings.Kdf = "HKDF-SHA256"
+	case "HKDF-SHA512":
+		kdf = tpm_keyDerivation.HKDFHandler{Hash: sha512.New, Info: []byte(kdfInfo)}
+		keySettings.Kdf = parsed_kdf
+	default:
+		return TPMmSettings{}, fmt.Errorf("KDF is invalid: %s", keySettings.Kdf)
+	}
+
+	if keySettings.KeyBits == 0 {
+		keySettings.KeyBits = 256
+	}
+	if keySettings.KeyBits < 0 || keySettings.KeyBits%8 != 0 || keySettings.KeyBits/8 > kdf.MaxKeyLength() {
+		return TPMmSettings{}, fmt.Errorf("key bits must be a positive multiple of 8 up to %d for %s: %d", kdf.MaxKeyLength()*8, keySettings.Kdf, keySettings.KeyBits)
+	}
+
+	tpmSettings.KeySettings = keySettings
+	tpmSettings.kdfHandler = kdf
+	return tpmSettings, nil
+}
+
+// ChannelSettingsFactory validates the noise of the channel between A and B
+func (SyncController) ChannelSettingsFactory(tpmSettings TPMmSettings, channelSettings ChannelSettings) (TPMmSettings, error) {
+	for _, probability := range []float64{channelSettings.ChannelFlipProbability, channelSettings.ChannelBurstProbability, channelSettings.ChannelDropProbability} {
+		if probability < 0 || probability > 1 {
+			return TPMmSettings{}, fmt.Errorf("channel probabilities must be in [0, 1]: %v", probability)
+		}
+	}
+	if channelSettings != (ChannelSettings{}) && !tpmSettings.binaryOutputs() {
+		return TPMmSettings{}, fmt.Errorf("noisy channels flip binary outputs, %s TPMs don't have them", tpmSettings.LinkType)
+	}
+	if channelSettings.ChannelBurstProbability == 0 {
+		channelSettings.ChannelBurstLength = 0
+	} else if channelSettings.ChannelBurstLength < 1 {
+		return TPMmSettings{}, fmt.Errorf("channel burst length must be positive when bursts are enabled: %d", channelSettings.ChannelBurstLength)
+	}
+	tpmSettings.ChannelSettings = channelSettings
+	return tpmSettings, nil
+}
+
+// createChannel creates one direction of the channel between A and B, it gets its own random stream derived from the session seed
+func (SyncController) createChannel(tpmSettings TPMmSettings, seed int64, direction string) tpm_channels.TPMChannel {
+	if tpmSettings.ChannelSettings == (ChannelSettings{}) {
+		return tpm_channels.PerfectChannel{}
+	}
+	return tpm_channels.NewNoisyChannel(tpmSettings.ChannelFlipProbability, tpmSettings.ChannelBurstProbability, tpmSettings.ChannelBurstLength, tpmSettings.ChannelDropProbability, rand.New(rand.NewSource(deriveStreamSeed(seed, "channel-"+direction))))
+}
+
+// StimulusSettingsFactory sets how the stimulus is generated, an empty generator means UNIFORM and a zero sigma means m/2
+func (SyncController) StimulusSettingsFactory(tpmSettings TPMmSettings, stimulusSettings StimulusSettings) (TPMmSettings, error) {
+	switch parsed_generator := strings.ToUpper(stimulusSettings.StimulusGenerator); parsed_generator {
+	case "", "UNIFORM":
+		stimulusSettings = StimulusSettings{StimulusGenerator: "UNIFORM"}
+	case "BINARY", "PACKED_BINARY", "LOGISTIC", "LORENZ":
+		stimulusSettings = StimulusSettings{StimulusGenerator: parsed_generator}
+	case "GAUSSIAN":
+		if stimulusSettings.StimulusSigma == 0 {
+			stimulusSettings.StimulusSigma = float64(tpmSettings.M) / 2
+		}
+		if stimulusSettings.StimulusSigma < 0 {
+			return TPMmSettings{}, fmt.Errorf("stimulus sigma must be positive for the %s generator: %v", parsed_generator, stimulusSettings.StimulusSigma)
+		}
+		stimulusSettings = StimulusSettings{StimulusGenerator: parsed_generator, StimulusSigma: stimulusSettings.StimulusSigma}
+	case "BIASED":
+		if stimulusSettings.StimulusBias <= -1 || stimulusSettings.StimulusBias >= 1 {
+			return TPMmSettings{}, fmt.Errorf("stimulus bias must be in ]-1, 1[ for the %s generator: %v", parsed_generator, stimulusSettings.StimulusBias)
+		}
+		stimulusSettings = StimulusSettings{StimulusGenerator: parsed_generator, StimulusBias: stimulusSettings.StimulusBias}
+	default:
+		return TPMmSettings{}, fmt.Errorf("stimulus generator is invalid: %s", stimulusSettings.StimulusGenerator)
+	}
+	tpmSettings.StimulusSettings = stimulusSettings
+	return tpmSettings, nil
+}
+
+// NumericsSettingsFactory sets how the local fields and outputs are computed, empty values mean FAST fields with zero fields giving -1
+func (SyncController) NumericsSettingsFactory(tpmSettings TPMmSettings, numericsSettings NumericsSettings) (TPMmSettings, error) {
+	var numerics tpm_core.Numerics
+
+	switch parsed_fieldMode := strings.ToUpper(numericsSettings.FieldMode); parsed_fieldMode {
+	case "", "FAST":
+		numerics.Fields = tpm_core.FieldFast
+		numericsSettings.FieldMode = "FAST"
+	case "EXACT":
+		numerics.Fields = tpm_core.FieldExact
+		numericsSettings.FieldMode = parsed_fieldMode
+	default:
+		return TPMmSettings{}, fmt.Errorf("field mode is invalid: %s", numericsSettings.FieldMode)
+	}
+
+	switch parsed_zeroField := strings.ToUpper(numericsSettings.ZeroField); parsed_zeroField {
+	case "", "NEGATIVE":
+		numerics.ZeroField = tpm_core.ZeroFieldNegative
+		numericsSettings.ZeroField = "NEGATIVE"
+	case "POSITIVE":
+		numerics.ZeroField = tpm_core.ZeroFieldPositive
+		numericsSettings.ZeroField = parsed_zeroField
+	case "RANDOM":
+		numerics.ZeroField = tpm_core.ZeroFieldRandom
+		numericsSettings.ZeroField = parsed_zeroField
+	default:
+		return TPMmSettings{}, fmt.Errorf("zero field output is invalid: %s", numericsSettings.ZeroField)
+	}
+
+	tpmSettings.NumericsSettings = numericsSettings
+	tpmSettings.numerics = numerics
+	return tpmSettings, nil
+}
+
+// seedNumerics gives random zero field outputs the stream of a session, derived from the session seed so the stimulus doesn't change.
+// The parties share it, the attacker gets its own in createAttacker
+func (SyncController) seedNumerics(tpmSettings TPMmSettings, seed int64) TPMmSettings {
+	if tpmSettings.numerics.ZeroField != tpm_core.ZeroFieldRandom {
+		return tpmSettings
+	}
+	tpmSettings.numerics.Rand = rand.New(rand.NewSource(deriveStreamSeed(seed, "zero-field")))
+	return tpmSettings
+}
+
+// createStimulusGenerator creates the stimulus generator of a session, it draws from the main random stream so UNIFORM sessions
+// produce the same stimuli as before generators existed
+func (SyncController) createStimulusGenerator(tpmSettings TPMmSettings, localRand *rand.Rand) tpm_stimGenerators.TPMStimulusGenerator {
+	switch tpmSettings.StimulusGenerator {
+	case "BINARY":
+		return tpm_stimGenerators.NewBinaryGenerator(localRand)
+	case "PACKED_BINARY":
+		return tpm_stimGenerators.NewPackedBinaryGenerator(localRand)
+	case "GAUSSIAN":
+		return tpm_stimGenerators.NewGaussianGenerator(tpmSettings.StimulusSigma, localRand)
+	case "BIASED":
+		return tpm_stimGenerators.NewBiasedGenerator(tpmSettings.StimulusBias, localRand)
+	case "LOGISTIC":
+		return tpm_stimGenerators.NewLogisticGenerator(localRand)
+	case "LORENZ":
+		return tpm_stimGenerators.NewLorenzGenerator(localRand)
+	}
+	return tpm_stimGenerators.NewUniformGenerator(localRand)
+}
+
+// Capabilities are the learn rules and TPM types the settings can pick, as they were registered
+type Capabilities struct {
+	LearnRules []tpm_registry.Capability `json:"learn_rules"`
+	TpmTypes   []tpm_registry.Capability `json:"tpm_types"`
+}
+
+// ListCapabilities reads the capabilities from the registries of tpm_learnRules and tpm_stimHandlers
+func (SyncController) ListCapabilities() Capabilities {
+	return Capabilities{
+		LearnRules: tpm_learnRules.Capabilities(),
+		TpmTypes:   tpm_stimHandlers.Capabilities(),
+	}
+}
+
+// instanceOptions are the values read by the factories that run after SettingsFactory, from a sweep instance or a stored session
+type instanceOptions struct {
+	BoundaryMode     string
+	LearnLayers      string
+	LearnSettings    LearnSettings
+	SparseSettings   SparseSettings
+	VariantSettings  VariantSettings
+	QueryField       float64
+	AttackSettings   AttackSettings
+	SyncSettings     SyncSettings
+	KeySettings      KeySettings
+	ChannelSettings  ChannelSettings
+	StimulusSettings StimulusSettings
+	NumericsSettings NumericsSettings
+	GroupSettings    GroupSettings
+	Kernel           string
+}
+
+// settingsSteps are the factories that complete the settings of SettingsFactory, in the order they run. The boundary and
+// learn params go before AttackSettingsFactory, which builds the attacker rules from them, attacks and channels before
+// GroupSettingsFactory, which rejects them for groups, and the kernel last, since it checks every other setting
+var settingsSteps = []func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error){
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.BoundarySettingsFactory(tpmSettings, options.BoundaryMode)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.LearnLayersSettingsFactory(tpmSettings, options.LearnLayers)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.LearnSettingsFactory(tpmSettings, options.LearnSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.SparseSettingsFactory(tpmSettings, options.SparseSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.VariantSettingsFactory(tpmSettings, options.VariantSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.QuerySettingsFactory(tpmSettings, options.QueryField)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.AttackSettingsFactory(tpmSettings, options.AttackSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.SyncCriterionSettingsFactory(tpmSettings, options.SyncSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.KeySettingsFactory(tpmSettings, options.KeySettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.ChannelSettingsFactory(tpmSettings, options.ChannelSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.StimulusSettingsFactory(tpmSettings, options.StimulusSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.NumericsSettingsFactory(tpmSettings, options.NumericsSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.GroupSettingsFactory(tpmSettings, options.GroupSettings)
+	},
+	func(s SyncController, tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+		return s.KernelSettingsFactory(tpmSettings, options.Kernel)
+	},
+}
+
+// applySettingsSteps runs every one of the settingsSteps on the settings of SettingsFactory
+func (s SyncController) applySettingsSteps(tpmSettings TPMmSettings, options instanceOptions) (TPMmSettings, error) {
+	for _, step := range settingsSteps {
+		var err error
+		tpmSettings, err = step(s, tpmSettings, options)
+		if err != nil {
+			return TPMmSettings{}, err
+		}
+	}
+	return tpmSettings, nil
+}
+
+// SweepSettingsFactory creates the settings of one instance of a sweep, applying the sweep wide options from the base settings
+func (s SyncController) SweepSettingsFactory(instance SweepInstance, baseSettings BaseSettings) (TPMmSettings, error) {
+	tpmSettings, err := s.SettingsFactory(instance.K, instance.N0, instance.L, instance.M, baseSettings.TpmType, instance.LearnRule, baseSettings.Connectivity, instance.WindowSettings)
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	return s.applySettingsSteps(tpmSettings, instanceOptions{
+		BoundaryMode:     instance.BoundaryMode,
+		LearnLayers:      baseSettings.LearnLayers,
+		LearnSettings:    instance.LearnSettings,
+		SparseSettings:   instance.SparseSettings,
+		VariantSettings:  baseSettings.VariantSettings,
+		QueryField:       instance.QueryField,
+		AttackSettings:   baseSettings.AttackSettings,
+		SyncSettings:     baseSettings.SyncSettings,
+		KeySettings:      baseSettings.KeySettings,
+		ChannelSettings:  baseSettings.ChannelSettings,
+		StimulusSettings: baseSettings.StimulusSettings,
+		NumericsSettings: baseSettings.NumericsSettings,
+		GroupSettings:    baseSettings.GroupSettings,
+		Kernel:           baseSettings.Kernel,
+	})
+}
+
+// createAttacker creates the attacker of a session, every attacker network gets its own random stream derived from the session seed
+func (SyncController) createAttacker(tpmSettings TPMmSettings, seed int64) tpm_attacks.TPMAttackHandler {
+	numerics := tpmSettings.numerics
+	if numerics.ZeroField == tpm_core.ZeroFieldRandom {
+		numerics.Rand = rand.New(rand.NewSource(deriveStreamSeed(seed, "attack-zero-field")))
+	}
+	network := tpm_attacks.TPMNetwork{
+		H:                  tpmSettings.H,
+		K:                  tpmSettings.K,
+		N:                  tpmSettings.N,
+		L:                  tpmSettings.L,
+		StimulationHandler: tpmSettings.stimulationHandlers,
+		LearnRuleHandlers:  tpmSettings.attackLearnRuleHandlers,
+		LayerSelection:     tpmSettings.layerSelection,
+		Numerics:           numerics,
+	}
+	switch tpmSettings.AttackType {
+	case "SIMPLE":
+		return tpm_attacks.NewSimpleAttack(network, rand.New(rand.NewSource(deriveStreamSeed(seed, "attack"))))
+	case "GEOMETRIC":
+		return tpm_attacks.NewGeometricAttack(network, rand.New(rand.NewSource(deriveStreamSeed(seed, "attack"))))
+	case "MAJORITY":
+		localRands := make([]*rand.Rand, tpmSettings.AttackerCount)
+		for i := range localRands {
+			localRands[i] = rand.New(rand.NewSource(deriveStreamSeed(seed, fmt.Sprintf("attack-%d", i))))
+		}
+		return tpm_attacks.NewMajorityAttack(network, localRands)
+	case "GENETIC":
+		return tpm_attacks.NewGeneticAttack(network, tpmSettings.PopulationCap, tpmSettings.MutationCount, rand.New(rand.NewSource(deriveStreamSeed(seed, "attack"))))
+	}
+	return nil
+}
+
+// SettingsFromStoredSession rebuilds the settings of a stored session, the no overlap K has to be turned back into the N[] it was created from
+func (s SyncController) SettingsFromStoredSession(storedSession StoredSession) (TPMmSettings, error) {
+	if len(storedSession.K) == 0 {
+		return TPMmSettings{}, fmt.Errorf("stored session %d has no K", storedSession.Id)
+	}
+	var tpmSettings TPMmSettings
+	var err error
+	if strings.ToUpper(storedSession.TPMType) != "NO_OVERLAP" {
+		tpmSettings, err = s.SettingsFactory(storedSession.K, storedSession.N0, storedSession.L, storedSession.M, storedSession.TPMType, storedSession.LearnRule, storedSession.Connectivity, storedSession.WindowSettings)
+	} else {
+		h := len(storedSession.K)
+		n := make([]int, h)
+		n[0] = storedSession.N0
+		for layer := 1; layer < h; layer++ {
+			n[layer] = storedSession.K[layer-1] / storedSession.K[layer]
+		}
+		tpmSettings, err = s.SettingsFactory(n, storedSession.K[h-1], storedSession.L, storedSession.M, storedSession.TPMType, storedSession.LearnRule, storedSession.Connectivity, storedSession.WindowSettings)
+	}
+	if err != nil {
+		return TPMmSettings{}, err
+	}
+	//Both kernels give the same sessions, so the kernel isn't stored
+	return s.applySettingsSteps(tpmSettings, instanceOptions{
+		BoundaryMode:     storedSession.BoundaryMode,
+		LearnLayers:      storedSession.LearnLayers,
+		LearnSettings:    storedSession.LearnSettings,
+		SparseSettings:   storedSession.SparseSettings,
+		VariantSettings:  storedSession.VariantSettings,
+		QueryField:       storedSession.QueryField,
+		AttackSettings:   storedSession.AttackSettings,
+		SyncSettings:     storedSession.SyncSettings,
+		KeySettings:      storedSession.KeySettings,
+		ChannelSettings:  storedSession.ChannelSettings,
+		StimulusSettings: storedSession.StimulusSettings,
+		NumericsSettings: storedSession.NumericsSettings,
+		GroupSettings:    storedSession.GroupSettings,
+	})
+}
+
+func (s SyncController) CreateSessionInstance(tpmSettings TPMmSettings, stimulusGenerator tpm_stimGenerators.TPMStimulusGenerator, localRand *rand.Rand) TPMmSessionState {
 	weights_a := make([][][]int, tpmSettings.H)
 	weights_b := make([][][]int, tpmSettings.H)
 	for layer := 0; layer < tpmSettings.H; layer++ {
 		weights_a[layer] = tpm_core.CreateRandomLayerWeightsArray(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, localRand)
 		weights_b[layer] = tpm_core.CreateRandomLayerWeightsArray(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, localRand)
 	}
-	stim := tpm_core.CreateRandomStimulusArray(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M, localRand)
+	stim := stimulusGenerator.CreateStimulus(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M)
 	layer_stim_a := make([][][]int, tpmSettings.H)
 	layer_stim_b := make([][][]int, tpmSettings.H)
 	outputs_a := make([][]int, tpmSettings.H)
@@ -91,100 +772,97 @@ func (s SyncController) CreateSessionInstance(tpmSettings TPMmSettings, localRan
 	}
 }
 
-func (s SyncController) StartSyncSession(tpmSettings TPMmSettings, tracking bool, sessionChannel chan SessionStateMessage, enableTracking chan bool, maxIterations int, sendIterThreshold int, sendIterStep int, seed int64, localRand *rand.Rand) SessionData {
+// sessionStep is what an iteration tells the session loop
+type sessionStep struct {
+	learned        bool   //Every party learned, so the outputs matched
+	weightsChanged bool   //Some party learned, so the overlap may have changed
+	status         string //Ends the session with this status when set
+}
 
-	//Setup simulation
-	sessionState := s.CreateSessionInstance(tpmSettings, localRand)
+// sessionKernel holds the steps of a session that depend on how the networks are stored and how many parties there are,
+// runSession does everything else
+type sessionKernel struct {
+	isSynced func(consecutiveMatches int) bool
+	snapshot func() TPMmSessionState //A copy of the state, with the overlap
+	iterate  func(iteration int) sessionStep
+	overlap  func() float64 //Network overlap of A and B
+	finish   func(sessionData *SessionData)
+}
+
+// runSession runs the iterations of a kernel until it is synced, it reaches the limit or an iteration ends it. It keeps the
+// counters and the overlap iterations, tracks every sendIterStep iterations and sends the session data at the end when tracking
+func (SyncController) runSession(kernel sessionKernel, tracking bool, sessionChannel chan SessionStateMessage, enableTracking chan bool, maxIterations int, sendIterThreshold int, sendIterStep int, seed int64, initialState TPMmSessionState) SessionData {
 	var stateBuffer []TPMmSessionState
-	initialState := sessionState
+	overlap_iterations := make([]int, len(OverlapThresholds))
+	for i := range overlap_iterations {
+		overlap_iterations[i] = -1
+	}
+	updateOverlapIterations(kernel.overlap, overlap_iterations, 0)
 
 	//Start simulation
 	total_iterations := 0
 	learn_iterations := 0
+	consecutive_matches := 0
 	send_iter_countdown := 0
-	for !tpm_core.CompareWeights(tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B) {
+	status := "FINISHED"
+	for !kernel.isSynced(consecutive_matches) {
 
 		select {
 		case state := <-enableTracking:
-			// fmt.Println("Enabled state:", state)
 			tracking = state
 		default:
-			// fmt.Println("Default case")
 		}
 		if len(stateBuffer) >= sendIterThreshold {
-
 			if tracking {
 				sessionChannel <- SessionStateMessage{
 					CommandType:  "progress",
 					SessionState: stateBuffer,
 				}
-
 			}
 			stateBuffer = nil
 		}
 
 		if send_iter_countdown == 0 {
-			stateBuffer = append(stateBuffer, sessionState)
+			stateBuffer = append(stateBuffer, kernel.snapshot())
 			send_iter_countdown = sendIterStep //We wont add every single iteration, we just append one every sendIterStep iterations
 		}
 		//Health Check: has the simulation has been running for too long?
 		if total_iterations > maxIterations && maxIterations != 0 {
-			sessionData := SessionData{
-				Seed:                seed,
-				StimulateIterations: total_iterations,
-				LearnIterations:     learn_iterations,
-				InitialState:        initialState,
-				FinalState:          sessionState,
-				Status:              "LIMIT_REACHED",
-			}
-			if tracking {
-
-				sessionChannel <- SessionStateMessage{
-					CommandType:  "finished",
-					SessionState: sessionData,
-				}
-			}
-			return sessionData
+			status = "LIMIT_REACHED"
+			break
 		}
 
-		//Setup first layer, next layers will be calculated on the stimulation process
-		sessionState.layer_stimulus_a[0] = sessionState.Stimulus
-		sessionState.layer_stimulus_b[0] = sessionState.Stimulus
-
-		//Stimulate layers, stimulate the last layer separate from the rest to avoid creating unnecesary stimulus arrays
-		for layer := 0; layer < tpmSettings.H-1; layer++ {
-			sessionState.Outputs_A[layer] = tpm_core.StimulateLayer(sessionState.layer_stimulus_a[layer], sessionState.Weights_A[layer], tpmSettings.K[layer], tpmSettings.N[layer])
-			sessionState.Outputs_B[layer] = tpm_core.StimulateLayer(sessionState.layer_stimulus_b[layer], sessionState.Weights_B[layer], tpmSettings.K[layer], tpmSettings.N[layer])
-			sessionState.layer_stimulus_a[layer+1] = tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(sessionState.Outputs_A[layer], tpmSettings.K[layer+1], tpmSettings.N[layer+1])
-			sessionState.layer_stimulus_b[layer+1] = tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(sessionState.Outputs_B[layer], tpmSettings.K[layer+1], tpmSettings.N[layer+1])
-		}
-		sessionState.Outputs_A[tpmSettings.H-1] = tpm_core.StimulateLayer(sessionState.layer_stimulus_a[tpmSettings.H-1], sessionState.Weights_A[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1], tpmSettings.N[tpmSettings.H-1])
-		sessionState.Outputs_B[tpmSettings.H-1] = tpm_core.StimulateLayer(sessionState.layer_stimulus_b[tpmSettings.H-1], sessionState.Weights_B[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1], tpmSettings.N[tpmSettings.H-1])
-		final_output_a := tpm_core.Thau(sessionState.Outputs_A[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1])
-		final_output_b := tpm_core.Thau(sessionState.Outputs_B[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1])
 		total_iterations += 1
+		step := kernel.iterate(total_iterations)
 
-		//Check if we need to learn in this iteration
-		if final_output_a == final_output_b {
-			for layer := 0; layer < tpmSettings.H; layer++ {
-				tpmSettings.learnRuleHandler.TPMLearnLayer(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, sessionState.Weights_A[layer], sessionState.layer_stimulus_a[layer], sessionState.Outputs_A[layer], final_output_a, final_output_b)
-				tpmSettings.learnRuleHandler.TPMLearnLayer(tpmSettings.K[layer], tpmSettings.N[layer], tpmSettings.L, sessionState.Weights_B[layer], sessionState.layer_stimulus_b[layer], sessionState.Outputs_B[layer], final_output_b, final_output_a)
-			}
+		//The overlap only changes when the weights do
+		if step.weightsChanged {
+			updateOverlapIterations(kernel.overlap, overlap_iterations, total_iterations)
+		}
+		if step.learned {
 			learn_iterations += 1
+			consecutive_matches += 1
+		} else {
+			consecutive_matches = 0
+		}
+		if step.status != "" {
+			status = step.status
+			break
 		}
-		sessionState.Stimulus = tpm_core.CreateRandomStimulusArray(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M, localRand)
 
 		send_iter_countdown--
 	}
 
 	sessionData := SessionData{
-		Seed:                seed,
-		StimulateIterations: total_iterations,
-		LearnIterations:     learn_iterations,
-		InitialState:        initialState,
-		FinalState:          sessionState,
-		Status:              "FINISHED",
+		Seed:                  seed,
+		StimulateIterations:   total_iterations,
+		LearnIterations:       learn_iterations,
+		InitialState:          initialState,
+		Status:                status,
+		AttackerSyncIteration: -1,
+		OverlapIterations:     overlap_iterations,
 	}
+	kernel.finish(&sessionData)
 	if tracking {
 		sessionChannel <- SessionStateMessage{
 			CommandType:  "finished",
@@ -194,6 +872,120 @@ func (s SyncController) StartSyncSession(tpmSettings TPMmSettings, tracking bool
 	return sessionData
 }
 
+func (s SyncController) StartSyncSession(tpmSettings TPMmSettings, tracking bool, sessionChannel chan SessionStateMessage, enableTracking chan bool, maxIterations int, sendIterThreshold int, sendIterStep int, seed int64, localRand *rand.Rand) SessionData {
+
+	tpmSettings = s.wireSession(tpmSettings, seed)
+	tpmSettings = s.seedLearnRules(tpmSettings, seed)
+	tpmSettings = s.seedNumerics(tpmSettings, seed)
+	if tpmSettings.PartyCount > 2 {
+		return s.startGroupSyncSession(tpmSettings, tracking, sessionChannel, enableTracking, maxIterations, sendIterThreshold, sendIterStep, seed, localRand)
+	}
+	if tpmSettings.Kernel != "REFERENCE" && tpmSettings.packedKernelSupport() == nil {
+		return s.startPackedSyncSession(tpmSettings, tracking, sessionChannel, enableTracking, maxIterations, sendIterThreshold, sendIterStep, seed, localRand)
+	}
+
+	//Setup simulation
+	stimulusGenerator := s.createStimulusGenerator(tpmSettings, localRand)
+	sessionState := s.CreateSessionInstance(tpmSettings, stimulusGenerator, localRand)
+	queryRand := s.createQueryRand(tpmSettings, seed)
+	partyWeights := [][][][]int{sessionState.Weights_A, sessionState.Weights_B}
+	s.queryStimulus(tpmSettings, sessionState.Stimulus, partyWeights, 0, queryRand)
+	initialState := copySessionState(sessionState)
+
+	//The attacker gets its own random streams, so A and B run the same with or without it
+	attacker := s.createAttacker(tpmSettings, seed)
+	attacker_sync_iteration := -1
+
+	//Each direction of the channel has its own noise
+	channel_ab := s.createChannel(tpmSettings, seed, "ab")
+	channel_ba := s.createChannel(tpmSettings, seed, "ba")
+
+	progress := tpm_syncCriteria.SyncProgress{
+		H:         tpmSettings.H,
+		K:         tpmSettings.K,
+		N:         tpmSettings.N,
+		Weights_A: sessionState.Weights_A,
+		Weights_B: sessionState.Weights_B,
+	}
+	return s.runSession(sessionKernel{
+		isSynced: func(consecutiveMatches int) bool {
+			progress.ConsecutiveMatches = consecutiveMatches
+			return tpmSettings.syncCriterion.IsSynced(progress)
+		},
+		snapshot: func() TPMmSessionState {
+			//Weights are learned in place, so the snapshot needs its own copy
+			snapshot := copySessionState(sessionState)
+			if attacker != nil {
+				attackState := attacker.AttackState(sessionState.Weights_A)
+				snapshot.AttackState = &attackState
+			}
+			overlapState := s.overlapState(tpmSettings, sessionState)
+			snapshot.Overlap = &overlapState
+			return snapshot
+		},
+		iterate: func(iteration int) sessionStep {
+			tpmSettings.updateSkips.SetIteration(iteration)
+
+			//Setup first layer, next layers will be calculated on the stimulation process
+			sessionState.layer_stimulus_a[0] = sessionState.Stimulus
+			sessionState.layer_stimulus_b[0] = sessionState.Stimulus
+
+			//Stimulate layers, stimulate the last layer separate from the rest to avoid creating unnecesary stimulus arrays
+			for layer := 0; layer < tpmSettings.H-1; layer++ {
+				sessionState.Outputs_A[layer] = tpmSettings.numerics.StimulateLayer(sessionState.layer_stimulus_a[layer], sessionState.Weights_A[layer], tpmSettings.K[layer], tpmSettings.N[layer])
+				sessionState.Outputs_B[layer] = tpmSettings.numerics.StimulateLayer(sessionState.layer_stimulus_b[layer], sessionState.Weights_B[layer], tpmSettings.K[layer], tpmSettings.N[layer])
+				sessionState.layer_stimulus_a[layer+1] = tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(sessionState.Outputs_A, layer+1, tpmSettings.K[layer+1], tpmSettings.N[layer+1])
+				sessionState.layer_stimulus_b[layer+1] = tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(sessionState.Outputs_B, layer+1, tpmSettings.K[layer+1], tpmSettings.N[layer+1])
+			}
+			sessionState.Outputs_A[tpmSettings.H-1] = tpmSettings.neuronHandler.StimulateLayer(tpmSettings.numerics, sessionState.layer_stimulus_a[tpmSettings.H-1], sessionState.Weights_A[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1], tpmSettings.N[tpmSettings.H-1])
+			sessionState.Outputs_B[tpmSettings.H-1] = tpmSettings.neuronHandler.StimulateLayer(tpmSettings.numerics, sessionState.layer_stimulus_b[tpmSettings.H-1], sessionState.Weights_B[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1], tpmSettings.N[tpmSettings.H-1])
+			final_output_a := tpmSettings.neuronHandler.Thau(sessionState.Outputs_A[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1])
+			final_output_b := tpmSettings.neuronHandler.Thau(sessionState.Outputs_B[tpmSettings.H-1], tpmSettings.K[tpmSettings.H-1])
+
+			//Each party only knows the output it received, a dropped output means it can't learn this iteration
+			received_a, delivered_a := channel_ba.Transmit(final_output_b)
+			received_b, delivered_b := channel_ab.Transmit(final_output_a)
+			learn_a := delivered_a && final_output_a == received_a
+			learn_b := delivered_b && final_output_b == received_b
+			if learn_a {
+				s.learnNetwork(tpmSettings, sessionState.Weights_A, sessionState.layer_stimulus_a, sessionState.Outputs_A, final_output_a, received_a)
+			}
+			if learn_b {
+				s.learnNetwork(tpmSettings, sessionState.Weights_B, sessionState.layer_stimulus_b, sessionState.Outputs_B, final_output_b, received_b)
+			}
+			step := sessionStep{learned: learn_a && learn_b, weightsChanged: learn_a || learn_b}
+
+			//The attacker sees the same stimulus and the outputs as they were sent
+			if attacker != nil {
+				attacker.AttackIteration(sessionState.Stimulus, final_output_a, final_output_b)
+				if attacker_sync_iteration == -1 && attacker.CompareWeights(sessionState.Weights_A) {
+					attacker_sync_iteration = iteration
+					if tpmSettings.AbortOnAttackerSync {
+						step.status = "ATTACKER_SYNCED"
+						return step
+					}
+				}
+			}
+			sessionState.Stimulus = stimulusGenerator.CreateStimulus(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M)
+			s.queryStimulus(tpmSettings, sessionState.Stimulus, partyWeights, iteration, queryRand)
+			return step
+		},
+		overlap: func() float64 {
+			return tpm_core.NetworkOverlap(tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B)
+		},
+		finish: func(sessionData *SessionData) {
+			sessionData.FinalState = sessionState
+			sessionData.AttackerSynced = attacker != nil && attacker.CompareWeights(sessionState.Weights_A)
+			sessionData.AttackerSyncIteration = attacker_sync_iteration
+			sessionData.AttackerPeakPopulation = attackerPeakPopulation(attacker, sessionState.Weights_A)
+			sessionData.ChannelErrors = channel_ab.Errors() + channel_ba.Errors()
+			if sessionData.Status == "FINISHED" {
+				sessionData.Key = tpm_keyDerivation.DeriveKeyData(tpmSettings.kdfHandler, tpmSettings.KeyBits, tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B)
+			}
+		},
+	}, tracking, sessionChannel, enableTracking, maxIterations, sendIterThreshold, sendIterStep, seed, initialState)
+}
+
 func (SyncController) GetDataSizeFromConfig(config TPMmSettings) int {
 	//Count the amount of weights
 	//So, count each stimulus, for every neuron, for every layer
@@ -204,6 +996,85 @@ func (SyncController) GetDataSizeFromConfig(config TPMmSettings) int {
 	return totalDataSize
 }
 
+// copySessionState deep copies the exported part of a session state, which is what gets tracked and stored
+func copySessionState(state TPMmSessionState) TPMmSessionState {
+	copied := TPMmSessionState{
+		Stimulus:  copyMatrix(state.Stimulus),
+		Weights_A: copyLayers(state.Weights_A),
+		Weights_B: copyLayers(state.Weights_B),
+		Outputs_A: copyMatrix(state.Outputs_A),
+		Outputs_B: copyMatrix(state.Outputs_B),
+	}
+	for party := range state.Weights_Group {
+		copied.Weights_Group = append(copied.Weights_Group, copyLayers(state.Weights_Group[party]))
+		copied.Outputs_Group = append(copied.Outputs_Group, copyMatrix(state.Outputs_Group[party]))
+	}
+	return copied
+}
+
+func copyLayers(input [][][]int) [][][]int {
+	copied := make([][][]int, len(input))
+	for i := range input {
+		copied[i] = copyMatrix(input[i])
+	}
+	return copied
+}
+
+func copyMatrix(input [][]int) [][]int {
+	copied := make([][]int, len(input))
+	for i := range input {
+		if input[i] != nil {
+			copied[i] = copySlice(input[i])
+		}
+	}
+	return copied
+}
+
+func (SyncController) overlapState(tpmSettings TPMmSettings, sessionState TPMmSessionState) OverlapState {
+	overlap := OverlapState{
+		Network: tpm_core.NetworkOverlap(tpmSettings.H, tpmSettings.K, tpmSettings.N, sessionState.Weights_A, sessionState.Weights_B),
+		Layers:  make([]float64, tpmSettings.H),
+		Units:   make([][]float64, tpmSettings.H),
+	}
+	for layer := 0; layer < tpmSettings.H; layer++ {
+		overlap.Layers[layer] = tpm_core.LayerOverlap(tpmSettings.K[layer], tpmSettings.N[layer], sessionState.Weights_A[layer], sessionState.Weights_B[layer])
+		overlap.Units[layer] = make([]float64, tpmSettings.K[layer])
+		for i := 0; i < tpmSettings.K[layer]; i++ {
+			overlap.Units[layer][i] = tpm_core.NeuronOverlap(tpmSettings.N[layer], sessionState.Weights_A[layer][i], sessionState.Weights_B[layer][i])
+		}
+	}
+	return overlap
+}
+
+// updateOverlapIterations stores the current iteration for every threshold that the overlap of A and B reached for the first time,
+// the overlap is only computed while some threshold is left
+func updateOverlapIterations(overlap func() float64, overlap_iterations []int, iteration int) {
+	if overlap_iterations[len(overlap_iterations)-1] != -1 {
+		return
+	}
+	networkOverlap := overlap()
+	for i, threshold := range OverlapThresholds {
+		if overlap_iterations[i] == -1 && networkOverlap >= threshold {
+			overlap_iterations[i] = iteration
+		}
+	}
+}
+
+func attackerPeakPopulation(attacker tpm_attacks.TPMAttackHandler, weights_a [][][]int) int {
+	if attacker == nil {
+		return 0
+	}
+	return attacker.AttackState(weights_a).PeakPopulation
+}
+
+// deriveStreamSeed derives the seed of an extra random stream of a session, so new consumers don't shift the main one
+func deriveStreamSeed(seed int64, stream string) int64 {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, seed)
+	h.Write([]byte(stream))
+	return int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
+}
+
 func copySlice(input []int) []int {
 	copied := make([]int, len(input))
 	copy(copied, input)
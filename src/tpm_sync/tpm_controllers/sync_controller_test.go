@@ -0,0 +1,112 @@
+package tpm_controllers
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"tpm_sync/tpm_syncCriteria"
+)
+
+// TestStochasticSkipsSurviveDroppedOutputs learns with stochastic rules, AGREEING layers and a channel that drops outputs.
+// A learns every iteration, B starts each iteration from A's weights and only learns when its output arrives, so B misses
+// layers and iterations that A learned. When B learns it has to skip the same updates as A
+func TestStochasticSkipsSurviveDroppedOutputs(t *testing.T) {
+	s := SyncController{}
+	base := BaseSettings{
+		TpmType:         "FULLY_CONNECTED",
+		LearnLayers:     "AGREEING",
+		ChannelSettings: ChannelSettings{ChannelDropProbability: 0.3},
+	}
+	instance := SweepInstance{K: []int{4, 2}, N0: 6, L: 3, M: 1, LearnRule: "HEBBIAN", LearnSettings: LearnSettings{LearnProbability: 0.5}}
+	tpmSettings, err := s.SweepSettingsFactory(instance, base)
+	if err != nil {
+		t.Fatalf("SweepSettingsFactory rejected the settings: %v", err)
+	}
+	const seed = 11
+	tpmSettings = s.seedLearnRules(tpmSettings, seed)
+	channel := s.createChannel(tpmSettings, seed, "ab")
+	localRand := rand.New(rand.NewSource(seed))
+	stimulusGenerator := s.createStimulusGenerator(tpmSettings, localRand)
+	state := s.CreateSessionInstance(tpmSettings, stimulusGenerator, localRand)
+
+	drops, learnedLayers := 0, 0
+	for iteration := 0; iteration < 500; iteration++ {
+		tpmSettings.updateSkips.SetIteration(iteration)
+		tau := s.stimulateNetwork(tpmSettings, state.Stimulus, state.Weights_A, state.layer_stimulus_a, state.Outputs_A)
+		weights_b := copyLayers(state.Weights_A)
+		for layer := 0; layer < tpmSettings.H; layer++ {
+			if tpmSettings.layerSelection.LearnsLayer(state.Outputs_A, layer, tau) {
+				learnedLayers++
+			}
+		}
+		s.learnNetwork(tpmSettings, state.Weights_A, state.layer_stimulus_a, state.Outputs_A, tau, tau)
+		if _, delivered := channel.Transmit(tau); !delivered {
+			drops++
+		} else {
+			s.learnNetwork(tpmSettings, weights_b, state.layer_stimulus_a, state.Outputs_A, tau, tau)
+			if !reflect.DeepEqual(weights_b, state.Weights_A) {
+				t.Fatalf("iteration %d: B skipped other updates than A after %d drops", iteration, drops)
+			}
+		}
+		state.Stimulus = stimulusGenerator.CreateStimulus(tpmSettings.K[0], tpmSettings.N[0], tpmSettings.M)
+	}
+	if drops == 0 || learnedLayers == 500*tpmSettings.H {
+		t.Errorf("B never missed an iteration or A learned every layer, %d drops and %d learned layers", drops, learnedLayers)
+	}
+}
+
+// TestWireSession checks that a wiring seed gives every session the same wiring, and that a wiring seed of 0 gives
+// every session seed its own
+func TestWireSession(t *testing.T) {
+	s := SyncController{}
+	k := []int{8, 4}
+	outputs := [][]int{{0, 1, 2, 3, 4, 5, 6, 7}, {}}
+	wiring := func(wiringSeed int64, seed int64) [][]int {
+		instance := SweepInstance{K: k, N0: 5, L: 2, M: 1, LearnRule: "HEBBIAN", SparseSettings: SparseSettings{FanIn: 3, WiringSeed: wiringSeed}}
+		tpmSettings, err := s.SweepSettingsFactory(instance, BaseSettings{TpmType: "RANDOM_SPARSE"})
+		if err != nil {
+			t.Fatalf("SweepSettingsFactory rejected the settings: %v", err)
+		}
+		tpmSettings = s.wireSession(tpmSettings, seed)
+		return tpmSettings.stimulationHandlers.CreateStimulusFromLayerOutput(outputs, 1, k[1], tpmSettings.N[1])
+	}
+	if !reflect.DeepEqual(wiring(7, 1), wiring(7, 2)) {
+		t.Errorf("wiring seed 7 wired sessions 1 and 2 differently")
+	}
+	if reflect.DeepEqual(wiring(7, 1), wiring(8, 1)) {
+		t.Errorf("wiring seeds 7 and 8 gave the same wiring")
+	}
+	if !reflect.DeepEqual(wiring(0, 1), wiring(0, 1)) {
+		t.Errorf("wiring seed 0 wired the same session differently")
+	}
+	if reflect.DeepEqual(wiring(0, 1), wiring(0, 2)) {
+		t.Errorf("wiring seed 0 wired sessions 1 and 2 the same")
+	}
+}
+
+// TestRunSessionCountsConsecutiveMatches checks that a CONSECUTIVE_OUTPUTS session only ends after Count iterations in a row
+// where every party learned, an iteration where they didn't starts the count again
+func TestRunSessionCountsConsecutiveMatches(t *testing.T) {
+	criterion := tpm_syncCriteria.ConsecutiveOutputsCriterion{Count: 3}
+	learned := []bool{true, true, false, true, false, true, true, true, true}
+	var seen []int
+	kernel := sessionKernel{
+		isSynced: func(consecutiveMatches int) bool {
+			seen = append(seen, consecutiveMatches)
+			return criterion.IsSynced(tpm_syncCriteria.SyncProgress{ConsecutiveMatches: consecutiveMatches})
+		},
+		snapshot: func() TPMmSessionState { return TPMmSessionState{} },
+		iterate: func(iteration int) sessionStep {
+			return sessionStep{learned: learned[iteration-1], weightsChanged: learned[iteration-1]}
+		},
+		overlap: func() float64 { return 0 },
+		finish:  func(sessionData *SessionData) {},
+	}
+	sessionData := SyncController{}.runSession(kernel, false, nil, nil, 100, 10, 1, 1, TPMmSessionState{})
+	if sessionData.Status != "FINISHED" || sessionData.StimulateIterations != 8 || sessionData.LearnIterations != 6 {
+		t.Errorf("session ended %s after %d iterations with %d learned, want FINISHED after 8 with 6", sessionData.Status, sessionData.StimulateIterations, sessionData.LearnIterations)
+	}
+	if want := []int{0, 1, 2, 0, 1, 0, 1, 2, 3}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("the criterion saw %v consecutive matches, want %v", seen, want)
+	}
+}
@@ -1,8 +1,13 @@
 package tpm_controllers
 
 import (
+	"tpm_sync/tpm_attacks"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_keyDerivation"
 	"tpm_sync/tpm_learnRules"
 	"tpm_sync/tpm_stimHandlers"
+	"tpm_sync/tpm_syncCriteria"
+	"tpm_sync/tpm_variants"
 )
 
 type TPMmSessionState struct {
@@ -13,25 +18,74 @@ type TPMmSessionState struct {
 	Weights_B        [][][]int
 	Outputs_A        [][]int
 	Outputs_B        [][]int
+	//Parties after A and B, only in group sessions
+	layer_stimulus_group [][][][]int
+	Weights_Group        [][][][]int              `json:",omitempty"`
+	Outputs_Group        [][][]int                `json:",omitempty"`
+	AttackState          *tpm_attacks.AttackState `json:",omitempty"` //Only set on tracked snapshots
+	Overlap              *OverlapState            `json:",omitempty"` //Only set on tracked snapshots
 }
 
+// OverlapState is the normalized overlap of the weights of A and B for the whole network, each layer and each hidden unit
+type OverlapState struct {
+	Network float64
+	Layers  []float64
+	Units   [][]float64
+}
+
+// OverlapThresholds are the overlaps of A and B whose first iteration is stored with every session, in the overlap_*_iteration columns
+var OverlapThresholds = []float64{0.5, 0.9, 0.99}
+
 type TPMmSettings struct {
-	K                   []int
-	N                   []int
-	L                   int
-	M                   int
-	H                   int
-	LearnRule           string
-	LinkType            string
-	stimulationHandlers tpm_stimHandlers.TPMStimulationHandlers
-	learnRuleHandler    tpm_learnRules.TPMLearnRuleHandler
+	K            []int
+	N            []int
+	L            int
+	M            int
+	H            int
+	LearnRule    string
+	LinkType     string
+	BoundaryMode string
+	LearnLayers  string
+	QueryField   float64 //Local field the queries aim for, 0 means random stimuli
+	Kernel       string
+	Connectivity *tpm_stimHandlers.Connectivity `json:",omitempty"` //Only set for ADJACENCY TPMs
+	AttackSettings
+	SyncSettings
+	KeySettings
+	ChannelSettings
+	GroupSettings
+	VariantSettings
+	StimulusSettings
+	NumericsSettings
+	SparseSettings
+	WindowSettings
+	LearnSettings
+	stimulationHandlers     tpm_stimHandlers.TPMStimulationHandlers
+	learnRuleHandlers       []tpm_learnRules.TPMLearnRuleHandler
+	numerics                tpm_core.Numerics
+	layerSelection          tpm_learnRules.TPMLayerSelection
+	weightBoundary          tpm_core.WeightBoundary
+	neuronHandler           tpm_variants.TPMNeuronHandler
+	attackLearnRuleHandlers []tpm_learnRules.TPMLearnRuleHandler
+	updateSkips             *tpm_learnRules.UpdateSkips //Only set during a session with stochastic learn rules
+	syncCriterion           tpm_syncCriteria.TPMSyncCriterion
+	kdfHandler              tpm_keyDerivation.TPMKeyDerivationHandler
 }
 
 type SessionData struct {
-	Seed                int64
-	StimulateIterations int
-	LearnIterations     int
-	InitialState        TPMmSessionState
-	FinalState          TPMmSessionState
-	Status              string
+	Seed                   int64
+	MasterSeed             int64
+	SessionIndex           int
+	StimulateIterations    int
+	LearnIterations        int
+	InitialState           TPMmSessionState
+	FinalState             TPMmSessionState
+	Status                 string //FINISHED, LIMIT_REACHED or ATTACKER_SYNCED
+	AttackerSynced         bool
+	AttackerSyncIteration  int //-1 when the attacker never matched A
+	AttackerPeakPopulation int
+	OverlapIterations      []int                     //First iteration where the overlap of A and B reached each of the OverlapThresholds, -1 if it never did
+	Key                    tpm_keyDerivation.KeyData //Only set when the session FINISHED
+	ChannelErrors          int                       //Outputs flipped or dropped in both directions
+	GroupMessages          int                       //Messages needed to agree on the outputs, only in group sessions
 }
@@ -0,0 +1,256 @@
+package tpm_core
+
+import "math/bits"
+
+// PackedWords is the number of 64 bit words that hold n packed signs
+func PackedWords(n int) int {
+	return (n + 63) / 64
+}
+
+// PackSigns packs the ±1 values of a row into words, bit j%64 of word j/64 is set when values[j] is +1
+func PackSigns(values []int, words []uint64) {
+	for w := range words {
+		words[w] = 0
+	}
+	for j, value := range values {
+		if value > 0 {
+			words[j/64] |= 1 << (j % 64)
+		}
+	}
+}
+
+// UnpackSigns is the inverse of PackSigns, it fills values with ±1
+func UnpackSigns(words []uint64, values []int) {
+	for j := range values {
+		values[j] = int(words[j/64]>>(j%64)&1)*2 - 1
+	}
+}
+
+// PackedLayer holds the weights of a layer as bit planes of w+L, which is in [0, 2L]. Plane p of a unit has bit j set when
+// bit p of w_j+L is, so the dot product with packed ±1 stimuli and the ±1 learn steps are done a word at a time.
+// The rows of a layer are kept in one flat buffer, unit i takes Planes words per plane from (i*Planes+p)*Words
+type PackedLayer struct {
+	K      int
+	N      int
+	L      int
+	Words  int
+	Planes int
+	bits   []uint64
+	valid  uint64 //Bits of the last word of a row that hold weights
+}
+
+func NewPackedLayer(k int, n int, l int) PackedLayer {
+	layer := PackedLayer{
+		K:      k,
+		N:      n,
+		L:      l,
+		Words:  PackedWords(n),
+		Planes: bits.Len(uint(2 * l)),
+		valid:  ^uint64(0),
+	}
+	if n%64 != 0 {
+		layer.valid = 1<<(n%64) - 1
+	}
+	layer.bits = make([]uint64, k*layer.Planes*layer.Words)
+	return layer
+}
+
+// unit is the flat buffer of the planes of unit i, plane p of it starts at p*Words
+func (layer PackedLayer) unit(i int) []uint64 {
+	size := layer.Planes * layer.Words
+	return layer.bits[i*size : (i+1)*size]
+}
+
+// rowMask is the mask of the weights held by word w of a row
+func (layer PackedLayer) rowMask(w int) uint64 {
+	if w == layer.Words-1 {
+		return layer.valid
+	}
+	return ^uint64(0)
+}
+
+// Load packs the weights of a layer, which have to be in [-L, L]
+func (layer PackedLayer) Load(weights [][]int) {
+	for index := range layer.bits {
+		layer.bits[index] = 0
+	}
+	for i := 0; i < layer.K; i++ {
+		unit := layer.unit(i)
+		for j := 0; j < layer.N; j++ {
+			offset := weights[i][j] + layer.L
+			for p := 0; p < layer.Planes; p++ {
+				unit[p*layer.Words+j/64] |= uint64(offset>>p&1) << (j % 64)
+			}
+		}
+	}
+}
+
+// Store unpacks the weights of a layer into weights, which has to be k by n
+func (layer PackedLayer) Store(weights [][]int) {
+	for i := 0; i < layer.K; i++ {
+		unit := layer.unit(i)
+		for w := 0; w < layer.Words; w++ {
+			row := weights[i][w*64 : min(w*64+64, layer.N)]
+			for bit := range row {
+				offset := 0
+				for p := 0; p < layer.Planes; p++ {
+					offset |= int(unit[p*layer.Words+w]>>bit&1) << p
+				}
+				row[bit] = offset - layer.L
+			}
+		}
+	}
+}
+
+// DotProduct is NeuronDotProduct of unit i with the packed ±1 stimulus of its row. With s_j = 2x_j-1, the sum of (w_j+L)*s_j
+// is counted plane by plane and the L*s_j part is taken off again
+func (layer PackedLayer) DotProduct(i int, stimulus []uint64) int {
+	unit := layer.unit(i)
+	offsetDot, positives := 0, 0
+	for w := 0; w < layer.Words; w++ {
+		x := stimulus[w] & layer.rowMask(w)
+		positives += bits.OnesCount64(x)
+		for p := 0; p < layer.Planes; p++ {
+			plane := unit[p*layer.Words+w]
+			offsetDot += (2*bits.OnesCount64(plane&x) - bits.OnesCount64(plane)) << p
+		}
+	}
+	return offsetDot - layer.L*(2*positives-layer.N)
+}
+
+// Stimulate is Numerics.StimulateLayer on packed stimuli, stimulus holds the Words of every unit one after the other.
+// The units are stimulated in order, so zero fields draw the same random outputs
+func (layer PackedLayer) Stimulate(numerics Numerics, stimulus []uint64, outputs []int) {
+	for i := 0; i < layer.K; i++ {
+		outputs[i] = numerics.Sign(layer.DotProduct(i, stimulus[i*layer.Words:(i+1)*layer.Words]))
+	}
+}
+
+// equalsOffset masks the weights of a unit whose w+L is offset in word w
+func (layer PackedLayer) equalsOffset(unit []uint64, w int, offset int) uint64 {
+	equal := layer.rowMask(w)
+	for p := 0; p < layer.Planes; p++ {
+		if offset>>p&1 == 1 {
+			equal &= unit[p*layer.Words+w]
+		} else {
+			equal &^= unit[p*layer.Words+w]
+		}
+	}
+	return equal
+}
+
+// LearnUnit moves every weight of unit i one step towards direction times its ±1 input and clips it to [-L, L],
+// like a learn rule with the default params and BoundaryClip. The weights that go up and down are added to and taken
+// from all at once, carrying through the planes
+func (layer PackedLayer) LearnUnit(i int, stimulus []uint64, direction int) {
+	unit := layer.unit(i)
+	for w := 0; w < layer.Words; w++ {
+		up := stimulus[w]
+		if direction < 0 {
+			up = ^up
+		}
+		up &= layer.rowMask(w)
+		down := ^up & layer.rowMask(w)
+		up &^= layer.equalsOffset(unit, w, 2*layer.L)
+		down &^= layer.equalsOffset(unit, w, 0)
+		carry, borrow := up, down
+		for p := 0; p < layer.Planes && carry|borrow != 0; p++ {
+			plane := unit[p*layer.Words+w]
+			unit[p*layer.Words+w] = plane ^ (carry | borrow)
+			carry, borrow = plane&carry, ^plane&borrow
+		}
+	}
+}
+
+// Equal is CompareWeights for two packed layers of the same shape
+func (layer PackedLayer) Equal(other PackedLayer) bool {
+	for index := range layer.bits {
+		if layer.bits[index] != other.bits[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// offsetSums are the sums of w_j+L of unit i, of their squares, and of their products with the w_j+L of the same unit of other.
+// The squares only count every pair of planes once, since the products of a plane with itself are the plane
+func (layer PackedLayer) offsetSums(other PackedLayer, i int) (int, int, int, int, int) {
+	unit_a, unit_b := layer.unit(i), other.unit(i)
+	product, square, otherSquare, sum, otherSum := 0, 0, 0, 0, 0
+	for w := 0; w < layer.Words; w++ {
+		for p := 0; p < layer.Planes; p++ {
+			a := unit_a[p*layer.Words+w]
+			b := unit_b[p*layer.Words+w]
+			sum += bits.OnesCount64(a) << p
+			otherSum += bits.OnesCount64(b) << p
+			square += bits.OnesCount64(a) << (2 * p)
+			otherSquare += bits.OnesCount64(b) << (2 * p)
+			for q := 0; q < layer.Planes; q++ {
+				product += bits.OnesCount64(a&unit_b[q*layer.Words+w]) << (p + q)
+			}
+			for q := p + 1; q < layer.Planes; q++ {
+				square += bits.OnesCount64(a&unit_a[q*layer.Words+w]) << (p + q + 1)
+				otherSquare += bits.OnesCount64(b&unit_b[q*layer.Words+w]) << (p + q + 1)
+			}
+		}
+	}
+	return product, square, otherSquare, sum, otherSum
+}
+
+// overlapDotProducts returns w_a·w_b, w_a·w_a and w_b·w_b of unit i, expanding (w_a+L)(w_b+L) to take L off the offset sums
+func (layer PackedLayer) overlapDotProducts(other PackedLayer, i int) (int, int, int) {
+	product, square, otherSquare, sum, otherSum := layer.offsetSums(other, i)
+	shift := layer.N * layer.L * layer.L
+	dot_ab := product - layer.L*(sum+otherSum) + shift
+	dot_aa := square - 2*layer.L*sum + shift
+	dot_bb := otherSquare - 2*layer.L*otherSum + shift
+	return dot_ab, dot_aa, dot_bb
+}
+
+// PackedOverlap is NetworkOverlap of two packed networks. It keeps the dot products of every pair of units, so only the units
+// that learned since the last Overlap are counted again, and the sums are the same integers as NetworkOverlap so the overlap is too
+type PackedOverlap struct {
+	layers_a []PackedLayer
+	layers_b []PackedLayer
+	dots     [][][3]int
+	stale    [][]bool
+}
+
+func NewPackedOverlap(layers_a []PackedLayer, layers_b []PackedLayer) PackedOverlap {
+	overlap := PackedOverlap{
+		layers_a: layers_a,
+		layers_b: layers_b,
+		dots:     make([][][3]int, len(layers_a)),
+		stale:    make([][]bool, len(layers_a)),
+	}
+	for layer := range layers_a {
+		overlap.dots[layer] = make([][3]int, layers_a[layer].K)
+		overlap.stale[layer] = make([]bool, layers_a[layer].K)
+		for i := range overlap.stale[layer] {
+			overlap.stale[layer][i] = true
+		}
+	}
+	return overlap
+}
+
+// Touch marks unit i of a layer as changed in either network
+func (overlap PackedOverlap) Touch(layer int, i int) {
+	overlap.stale[layer][i] = true
+}
+
+func (overlap PackedOverlap) Overlap() float64 {
+	dot_ab, dot_aa, dot_bb := 0, 0, 0
+	for layer := range overlap.dots {
+		for i := range overlap.dots[layer] {
+			if overlap.stale[layer][i] {
+				ab, aa, bb := overlap.layers_a[layer].overlapDotProducts(overlap.layers_b[layer], i)
+				overlap.dots[layer][i] = [3]int{ab, aa, bb}
+				overlap.stale[layer][i] = false
+			}
+			dot_ab += overlap.dots[layer][i][0]
+			dot_aa += overlap.dots[layer][i][1]
+			dot_bb += overlap.dots[layer][i][2]
+		}
+	}
+	return normalizedOverlap(dot_ab, dot_aa, dot_bb)
+}
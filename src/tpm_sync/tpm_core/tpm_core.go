@@ -5,24 +5,108 @@ import (
 	"math/rand"
 )
 
+// FieldMode is how the hidden units compute their local field
+type FieldMode int
+
+const (
+	FieldFast  FieldMode = iota // normalised with FastInverseSqrt, the output is the sign of the float field
+	FieldExact                  // normalised with math.Sqrt, the output is the sign of the integer dot product
+)
+
+// ZeroFieldOutput is the output of a hidden unit whose local field is exactly zero
+type ZeroFieldOutput int
+
+const (
+	ZeroFieldNegative ZeroFieldOutput = iota // -1, like OutputSigma
+	ZeroFieldPositive                        // +1
+	ZeroFieldRandom                          // drawn from the Rand of the Numerics
+)
+
+// Numerics is how the hidden units turn their inputs into a local field and an output. The zero value is FieldFast with
+// zero fields giving -1, which is what StimulateLayer does. Rand is only needed with ZeroFieldRandom, and every stream
+// of outputs that has to be reproducible needs its own
+type Numerics struct {
+	Fields    FieldMode
+	ZeroField ZeroFieldOutput
+	Rand      *rand.Rand
+}
+
 func StimulateLayer(stimu [][]int, weights [][]int, k int, n int) []int {
+	return Numerics{}.StimulateLayer(stimu, weights, k, n)
+}
+
+// StimulateLayerWithFields is StimulateLayer but it also returns the local field of every neuron
+func StimulateLayerWithFields(stimu [][]int, weights [][]int, k int, n int) ([]int, []float64) {
+	return Numerics{}.StimulateLayerWithFields(stimu, weights, k, n)
+}
+
+func (numerics Numerics) StimulateLayer(stimu [][]int, weights [][]int, k int, n int) []int {
+	layerOutputs, _ := numerics.StimulateLayerWithFields(stimu, weights, k, n)
+	return layerOutputs
+}
+
+// StimulateLayerWithFields is StimulateLayer but it also returns the local field of every neuron
+func (numerics Numerics) StimulateLayerWithFields(stimu [][]int, weights [][]int, k int, n int) ([]int, []float64) {
 
 	layerOutputs := make([]int, k)
+	layerFields := make([]float64, k)
 	for i := 0; i < k; i++ {
-		localField := NeuronLocalField(n, weights[i], stimu[i])
-		localOutput := OutputSigma(localField)
-		layerOutputs[i] = localOutput
+		dot_prod := NeuronDotProduct(n, weights[i], stimu[i])
+		if numerics.Fields == FieldExact {
+			layerFields[i] = float64(dot_prod) / math.Sqrt(float64(n))
+			layerOutputs[i] = numerics.Sign(dot_prod)
+		} else {
+			layerFields[i] = float64(dot_prod) * FastInverseSqrt(float64(n))
+			layerOutputs[i] = numerics.FieldSign(layerFields[i])
+		}
 	}
 
-	return layerOutputs
+	return layerOutputs, layerFields
 }
 
-func NeuronLocalField(n int, w_k []int, stim_k []int) float64 {
+// Sign is the output of an integer local field, a zero field is broken as ZeroField says
+func (numerics Numerics) Sign(field int) int {
+	switch {
+	case field > 0:
+		return 1
+	case field < 0:
+		return -1
+	}
+	return numerics.zeroFieldOutput()
+}
+
+// FieldSign is Sign for a float local field
+func (numerics Numerics) FieldSign(field float64) int {
+	switch {
+	case field > 0:
+		return 1
+	case field < 0:
+		return -1
+	}
+	return numerics.zeroFieldOutput()
+}
+
+func (numerics Numerics) zeroFieldOutput() int {
+	switch numerics.ZeroField {
+	case ZeroFieldPositive:
+		return 1
+	case ZeroFieldRandom:
+		return 2*numerics.Rand.Intn(2) - 1
+	}
+	return -1
+}
+
+// NeuronDotProduct is the local field of a neuron before it is normalised
+func NeuronDotProduct(n int, w_k []int, stim_k []int) int {
 	dot_prod := 0
 	for i := 0; i < n; i++ {
 		dot_prod += w_k[i] * stim_k[i]
 	}
-	return float64(dot_prod) * FastInverseSqrt(float64(n))
+	return dot_prod
+}
+
+func NeuronLocalField(n int, w_k []int, stim_k []int) float64 {
+	return float64(NeuronDotProduct(n, w_k, stim_k)) * FastInverseSqrt(float64(n))
 }
 
 func OutputSigma(x float64) int {
@@ -59,6 +143,43 @@ func GFunction(w int, l int) int {
 	return w
 }
 
+// WeightBoundary is what happens to a weight that a learn step pushed out of [-L, L]
+type WeightBoundary int
+
+const (
+	BoundaryClip    WeightBoundary = iota // stays at the bound, like GFunction
+	BoundaryReflect                       // bounces back from the bound by the amount it went over
+	BoundaryWrap                          // comes back from the other bound, the 2L+1 values are periodic
+	BoundaryReset                         // goes back to zero
+)
+
+// BoundWeight brings a weight back into [-L, L] the way boundary says. An L below 1 only holds 0, so every mode gives 0
+func BoundWeight(w int, l int, boundary WeightBoundary) int {
+	if w >= -l && w <= l {
+		return w
+	}
+	if l < 1 {
+		return 0
+	}
+	switch boundary {
+	case BoundaryReflect:
+		for w > l || w < -l {
+			if w > l {
+				w = 2*l - w
+			} else {
+				w = -2*l - w
+			}
+		}
+		return w
+	case BoundaryWrap:
+		period := 2*l + 1
+		return ((w+l)%period+period)%period - l
+	case BoundaryReset:
+		return 0
+	}
+	return GFunction(w, l)
+}
+
 func FastInverseSqrt(x float64) float64 {
 	i := math.Float64bits(x)
 	i = 0x5fe6eb50c7b537a9 - (i >> 1)
@@ -82,6 +203,59 @@ func CompareWeights(h int, k []int, n []int, weights_a [][][]int, weights_b [][]
 	return true
 }
 
+// NeuronOverlap is the normalized overlap rho = wa·wb / sqrt(wa·wa * wb·wb) of one hidden unit, 1 means the weights are the same
+func NeuronOverlap(n int, w_a []int, w_b []int) float64 {
+	dot_ab, dot_aa, dot_bb := overlapDotProducts(n, w_a, w_b)
+	return normalizedOverlap(dot_ab, dot_aa, dot_bb)
+}
+
+// LayerOverlap is the normalized overlap of all the weights of a layer
+func LayerOverlap(k int, n int, weights_a [][]int, weights_b [][]int) float64 {
+	dot_ab, dot_aa, dot_bb := 0, 0, 0
+	for i := 0; i < k; i++ {
+		ab, aa, bb := overlapDotProducts(n, weights_a[i], weights_b[i])
+		dot_ab += ab
+		dot_aa += aa
+		dot_bb += bb
+	}
+	return normalizedOverlap(dot_ab, dot_aa, dot_bb)
+}
+
+// NetworkOverlap is the normalized overlap of all the weights of two networks
+func NetworkOverlap(h int, k []int, n []int, weights_a [][][]int, weights_b [][][]int) float64 {
+	dot_ab, dot_aa, dot_bb := 0, 0, 0
+	for layer := 0; layer < h; layer++ {
+		for i := 0; i < k[layer]; i++ {
+			ab, aa, bb := overlapDotProducts(n[layer], weights_a[layer][i], weights_b[layer][i])
+			dot_ab += ab
+			dot_aa += aa
+			dot_bb += bb
+		}
+	}
+	return normalizedOverlap(dot_ab, dot_aa, dot_bb)
+}
+
+func overlapDotProducts(n int, w_a []int, w_b []int) (int, int, int) {
+	dot_ab, dot_aa, dot_bb := 0, 0, 0
+	for j := 0; j < n; j++ {
+		dot_ab += w_a[j] * w_b[j]
+		dot_aa += w_a[j] * w_a[j]
+		dot_bb += w_b[j] * w_b[j]
+	}
+	return dot_ab, dot_aa, dot_bb
+}
+
+func normalizedOverlap(dot_ab int, dot_aa int, dot_bb int) float64 {
+	//A zero vector has no direction, only two of them are considered the same
+	if dot_aa == 0 || dot_bb == 0 {
+		if dot_aa == dot_bb {
+			return 1
+		}
+		return 0
+	}
+	return float64(dot_ab) / math.Sqrt(float64(dot_aa)*float64(dot_bb))
+}
+
 func CreateRandomStimulusArray(k int, n int, m int, localRand *rand.Rand) [][]int {
 	stim := make([][]int, k)
 	for i := 0; i < k; i++ {
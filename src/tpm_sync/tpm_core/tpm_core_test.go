@@ -0,0 +1,167 @@
+package tpm_core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBoundWeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		w        int
+		l        int
+		boundary WeightBoundary
+		want     int
+	}{
+		{"clip inside", 2, 3, BoundaryClip, 2},
+		{"clip on the bound", -3, 3, BoundaryClip, -3},
+		{"clip above", 4, 3, BoundaryClip, 3},
+		{"clip below", -5, 3, BoundaryClip, -3},
+		{"reflect inside", -1, 3, BoundaryReflect, -1},
+		{"reflect above", 4, 3, BoundaryReflect, 2},
+		{"reflect below", -5, 3, BoundaryReflect, -1},
+		{"reflect past the other bound", 10, 3, BoundaryReflect, -2},
+		{"reflect L 1", 2, 1, BoundaryReflect, 0},
+		{"wrap inside", 3, 3, BoundaryWrap, 3},
+		{"wrap above", 4, 3, BoundaryWrap, -3},
+		{"wrap below", -5, 3, BoundaryWrap, 2},
+		{"wrap a full period", 9, 3, BoundaryWrap, 2},
+		{"reset inside", 1, 3, BoundaryReset, 1},
+		{"reset above", 4, 3, BoundaryReset, 0},
+		{"reset below", -4, 3, BoundaryReset, 0},
+		{"clip L 0", 1, 0, BoundaryClip, 0},
+		{"reflect L 0", 1, 0, BoundaryReflect, 0},
+		{"reflect L 0 below", -2, 0, BoundaryReflect, 0},
+		{"wrap L 0", 1, 0, BoundaryWrap, 0},
+		{"reset L 0", -1, 0, BoundaryReset, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := BoundWeight(test.w, test.l, test.boundary); got != test.want {
+				t.Errorf("BoundWeight(%d, %d, %d) = %d, want %d", test.w, test.l, test.boundary, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBoundWeightStaysInRange(t *testing.T) {
+	for _, boundary := range []WeightBoundary{BoundaryClip, BoundaryReflect, BoundaryWrap, BoundaryReset} {
+		for l := 1; l <= 4; l++ {
+			for w := -6 * l; w <= 6*l; w++ {
+				got := BoundWeight(w, l, boundary)
+				if got < -l || got > l {
+					t.Errorf("BoundWeight(%d, %d, %d) = %d, out of [-%d, %d]", w, l, boundary, got, l, l)
+				}
+				if w >= -l && w <= l && got != w {
+					t.Errorf("BoundWeight(%d, %d, %d) = %d, weights inside the bounds have to stay", w, l, boundary, got)
+				}
+			}
+		}
+	}
+}
+
+func TestNeuronOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		w_a  []int
+		w_b  []int
+		want float64
+	}{
+		{"same weights", []int{1, -2, 3}, []int{1, -2, 3}, 1},
+		{"negated weights", []int{1, -2, 3}, []int{-1, 2, -3}, -1},
+		{"orthogonal weights", []int{1, 0, 1}, []int{0, 2, 0}, 0},
+		{"scaled weights", []int{1, -1, 2}, []int{2, -2, 4}, 1},
+		{"partial overlap", []int{1, 1, 0}, []int{1, 0, 1}, 0.5},
+		{"both zero", []int{0, 0, 0}, []int{0, 0, 0}, 1},
+		{"one zero", []int{0, 0, 0}, []int{1, 0, 0}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NeuronOverlap(len(test.w_a), test.w_a, test.w_b); math.Abs(got-test.want) > 1e-12 {
+				t.Errorf("NeuronOverlap(%v, %v) = %v, want %v", test.w_a, test.w_b, got, test.want)
+			}
+		})
+	}
+}
+
+// TestLayerAndNetworkOverlap checks that the layer and network overlaps are the overlap of all their weights put in one vector,
+// not an average of the overlaps of the units
+func TestLayerAndNetworkOverlap(t *testing.T) {
+	k, n := []int{3, 2}, []int{4, 3}
+	localRand := rand.New(rand.NewSource(1))
+	weights_a, weights_b := make([][][]int, len(k)), make([][][]int, len(k))
+	var flat_a, flat_b []int
+	for layer := range k {
+		weights_a[layer] = CreateRandomLayerWeightsArray(k[layer], n[layer], 3, localRand)
+		weights_b[layer] = CreateRandomLayerWeightsArray(k[layer], n[layer], 3, localRand)
+		var layer_a, layer_b []int
+		for i := 0; i < k[layer]; i++ {
+			layer_a = append(layer_a, weights_a[layer][i]...)
+			layer_b = append(layer_b, weights_b[layer][i]...)
+		}
+		if got, want := LayerOverlap(k[layer], n[layer], weights_a[layer], weights_b[layer]), NeuronOverlap(len(layer_a), layer_a, layer_b); math.Abs(got-want) > 1e-12 {
+			t.Errorf("LayerOverlap of layer %d = %v, want %v", layer, got, want)
+		}
+		flat_a = append(flat_a, layer_a...)
+		flat_b = append(flat_b, layer_b...)
+	}
+	if got, want := NetworkOverlap(len(k), k, n, weights_a, weights_b), NeuronOverlap(len(flat_a), flat_a, flat_b); math.Abs(got-want) > 1e-12 {
+		t.Errorf("NetworkOverlap = %v, want %v", got, want)
+	}
+	if got := NetworkOverlap(len(k), k, n, weights_a, weights_a); got != 1 {
+		t.Errorf("NetworkOverlap of a network with itself = %v, want 1", got)
+	}
+}
+
+// TestFieldModesGiveTheSameOutputs checks that FieldExact and FieldFast only differ in the fields they report, FastInverseSqrt
+// is always positive so both take the sign of the same dot product
+func TestFieldModesGiveTheSameOutputs(t *testing.T) {
+	localRand := rand.New(rand.NewSource(7))
+	for _, zeroField := range []ZeroFieldOutput{ZeroFieldNegative, ZeroFieldPositive, ZeroFieldRandom} {
+		for _, n := range []int{1, 2, 3, 10, 100, 1000} {
+			for _, m := range []int{1, 3} {
+				k := 5
+				weights := CreateRandomLayerWeightsArray(k, n, 2, localRand)
+				stimulus := CreateRandomStimulusArray(k, n, m, localRand)
+				//A zero row always has a zero field, so the tie-breaking is exercised too
+				weights[0] = make([]int, n)
+
+				fast := Numerics{Fields: FieldFast, ZeroField: zeroField, Rand: rand.New(rand.NewSource(int64(n)))}
+				exact := Numerics{Fields: FieldExact, ZeroField: zeroField, Rand: rand.New(rand.NewSource(int64(n)))}
+				fastOutputs, fastFields := fast.StimulateLayerWithFields(stimulus, weights, k, n)
+				exactOutputs, exactFields := exact.StimulateLayerWithFields(stimulus, weights, k, n)
+				for i := 0; i < k; i++ {
+					if fastOutputs[i] != exactOutputs[i] {
+						t.Errorf("zero field %d, n %d, m %d: unit %d outputs %d with FieldFast and %d with FieldExact", zeroField, n, m, i, fastOutputs[i], exactOutputs[i])
+					}
+					if math.Abs(fastFields[i]-exactFields[i]) > 2e-3*math.Abs(exactFields[i]) {
+						t.Errorf("zero field %d, n %d, m %d: unit %d has field %v with FieldFast and %v with FieldExact", zeroField, n, m, i, fastFields[i], exactFields[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestZeroFieldOutput(t *testing.T) {
+	if got := (Numerics{ZeroField: ZeroFieldNegative}).Sign(0); got != -1 {
+		t.Errorf("ZeroFieldNegative gives %d", got)
+	}
+	if got := (Numerics{ZeroField: ZeroFieldPositive}).Sign(0); got != 1 {
+		t.Errorf("ZeroFieldPositive gives %d", got)
+	}
+	random := Numerics{ZeroField: ZeroFieldRandom, Rand: rand.New(rand.NewSource(1))}
+	seen := map[int]bool{}
+	for i := 0; i < 64; i++ {
+		seen[random.Sign(0)] = true
+	}
+	if len(seen) != 2 || !seen[-1] || !seen[1] {
+		t.Errorf("ZeroFieldRandom gives %v", seen)
+	}
+	for _, numerics := range []Numerics{{}, {Fields: FieldExact, ZeroField: ZeroFieldPositive}} {
+		if numerics.Sign(3) != 1 || numerics.Sign(-3) != -1 || numerics.FieldSign(0.5) != 1 || numerics.FieldSign(-0.5) != -1 {
+			t.Errorf("numerics %+v don't keep the sign of non zero fields", numerics)
+		}
+	}
+}
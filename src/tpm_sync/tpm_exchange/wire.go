@@ -0,0 +1,215 @@
+package tpm_exchange
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Every frame on the wire is: 1 byte message type, 4 bytes big endian payload length, payload
+const frameHeaderSize = 5
+
+// maxPayloadSize protects the receiver from a corrupted length
+const maxPayloadSize = 1 << 20
+
+type MessageType byte
+
+const (
+	MsgHello       MessageType = iota + 1 //Client -> server, JSON HelloMessage
+	MsgHelloAck                           //Server -> client, empty
+	MsgRound                              //Client -> server, RoundMessage
+	MsgRoundReply                         //Server -> client, 1 byte tau of B
+	MsgFinish                             //Client -> server, JSON FinishMessage
+	MsgFinishReply                        //Server -> client, key fingerprint of B
+	MsgError                              //Either way, error text, the connection is closed afterwards
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgHello:
+		return "HELLO"
+	case MsgHelloAck:
+		return "HELLO_ACK"
+	case MsgRound:
+		return "ROUND"
+	case MsgRoundReply:
+		return "ROUND_REPLY"
+	case MsgFinish:
+		return "FINISH"
+	case MsgFinishReply:
+		return "FINISH_REPLY"
+	case MsgError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", byte(t))
+}
+
+// HelloMessage is the TPM configuration proposed by the client, K and N0 are the arguments of SettingsFactory
+type HelloMessage struct {
+	K                  []int  `json:"k"`
+	N0                 int    `json:"n0"`
+	L                  int    `json:"l"`
+	M                  int    `json:"m"`
+	TpmType            string `json:"tpm_type"`
+	LearnRule          string `json:"learn_rule"`
+	ConsecutiveOutputs int    `json:"consecutive_outputs"`
+	MaxIterations      int    `json:"max_iterations"`
+	Kdf                string `json:"kdf"`
+	KeyBits            int    `json:"key_bits"`
+	StimulusGenerator  string `json:"stimulus_generator,omitempty"` //Only UNIFORM, the default, can be drawn from the seed of a round
+}
+
+// FinishMessage ends the exchange, the server answers with its own fingerprint so both sides can confirm the key
+type FinishMessage struct {
+	Status      string `json:"status"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// RoundMessage carries the public seed of the stimulus of this round and the output of A, 9 bytes on the wire
+type RoundMessage struct {
+	StimulusSeed int64
+	Tau          int
+}
+
+func EncodeRound(round RoundMessage) []byte {
+	payload := make([]byte, 9)
+	binary.BigEndian.PutUint64(payload, uint64(round.StimulusSeed))
+	payload[8] = encodeTau(round.Tau)
+	return payload
+}
+
+func DecodeRound(payload []byte) (RoundMessage, error) {
+	if len(payload) != 9 {
+		return RoundMessage{}, fmt.Errorf("round message must be 9 bytes long: %d", len(payload))
+	}
+	tau, err := decodeTau(payload[8])
+	if err != nil {
+		return RoundMessage{}, err
+	}
+	return RoundMessage{StimulusSeed: int64(binary.BigEndian.Uint64(payload)), Tau: tau}, nil
+}
+
+func EncodeTau(tau int) []byte {
+	return []byte{encodeTau(tau)}
+}
+
+func DecodeTau(payload []byte) (int, error) {
+	if len(payload) != 1 {
+		return 0, fmt.Errorf("tau message must be 1 byte long: %d", len(payload))
+	}
+	return decodeTau(payload[0])
+}
+
+func encodeTau(tau int) byte {
+	if tau > 0 {
+		return 1
+	}
+	return 0
+}
+
+func decodeTau(b byte) (int, error) {
+	switch b {
+	case 0:
+		return -1, nil
+	case 1:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("tau byte is invalid: %d", b)
+}
+
+// WireMetrics counts what went through a connection
+type WireMetrics struct {
+	MessagesSent     int
+	MessagesReceived int
+	BytesSent        int
+	BytesReceived    int
+}
+
+// Conn frames messages over a stream connection and keeps its WireMetrics
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	Metrics WireMetrics
+	Timeout time.Duration //Deadline of every send and receive, 0 means none
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+func (c *Conn) Send(msgType MessageType, payload []byte) error {
+	if c.Timeout != 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	}
+	header := make([]byte, frameHeaderSize)
+	header[0] = byte(msgType)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := c.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(payload); err != nil {
+		return err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	c.Metrics.MessagesSent++
+	c.Metrics.BytesSent += frameHeaderSize + len(payload)
+	return nil
+}
+
+// Receive reads the next frame, an MsgError frame is returned as an error
+func (c *Conn) Receive() (MessageType, []byte, error) {
+	if c.Timeout != 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.Timeout))
+	}
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxPayloadSize {
+		return 0, nil, fmt.Errorf("payload of %d bytes is over the limit", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	c.Metrics.MessagesReceived++
+	c.Metrics.BytesReceived += frameHeaderSize + len(payload)
+
+	msgType := MessageType(header[0])
+	if msgType == MsgError {
+		return msgType, payload, fmt.Errorf("remote error: %s", payload)
+	}
+	return msgType, payload, nil
+}
+
+// Expect receives the next frame and fails if it is not of the given type
+func (c *Conn) Expect(msgType MessageType) ([]byte, error) {
+	received, payload, err := c.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if received != msgType {
+		return nil, fmt.Errorf("expected %s message, got %s", msgType, received)
+	}
+	return payload, nil
+}
+
+// SendError tells the other side why the exchange is aborted, it's best effort since the connection is closed afterwards
+func (c *Conn) SendError(err error) {
+	c.Send(MsgError, []byte(err.Error()))
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,138 @@
+package tpm_exchange
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// connPair is both ends of an in-memory connection, net.Pipe is unbuffered so every Send needs a Receive running on the other end
+func connPair() (*Conn, *Conn) {
+	client, server := net.Pipe()
+	return NewConn(client), NewConn(server)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []struct {
+		msgType MessageType
+		payload []byte
+	}{
+		{MsgHello, []byte(`{"k":[3],"n0":100,"l":3,"m":1}`)},
+		{MsgHelloAck, []byte{}},
+		{MsgRound, EncodeRound(RoundMessage{StimulusSeed: -42, Tau: 1})},
+		{MsgRoundReply, EncodeTau(-1)},
+		{MsgFinish, []byte(`{"status":"FINISHED"}`)},
+		{MsgFinishReply, bytes.Repeat([]byte{0xab}, 64)},
+	}
+	client, server := connPair()
+	defer client.Close()
+	defer server.Close()
+
+	sendErrors := make(chan error, len(frames))
+	go func() {
+		for _, frame := range frames {
+			sendErrors <- client.Send(frame.msgType, frame.payload)
+		}
+	}()
+	for _, frame := range frames {
+		msgType, payload, err := server.Receive()
+		if err != nil {
+			t.Fatalf("Receive of %s failed: %v", frame.msgType, err)
+		}
+		if msgType != frame.msgType || !bytes.Equal(payload, frame.payload) {
+			t.Errorf("received %s %x, want %s %x", msgType, payload, frame.msgType, frame.payload)
+		}
+		if err := <-sendErrors; err != nil {
+			t.Fatalf("Send of %s failed: %v", frame.msgType, err)
+		}
+	}
+
+	bytesOnWire := 0
+	for _, frame := range frames {
+		bytesOnWire += frameHeaderSize + len(frame.payload)
+	}
+	if client.Metrics != (WireMetrics{MessagesSent: len(frames), BytesSent: bytesOnWire}) {
+		t.Errorf("client metrics are %+v", client.Metrics)
+	}
+	if server.Metrics != (WireMetrics{MessagesReceived: len(frames), BytesReceived: bytesOnWire}) {
+		t.Errorf("server metrics are %+v", server.Metrics)
+	}
+}
+
+func TestErrorFrame(t *testing.T) {
+	client, server := connPair()
+	defer client.Close()
+	defer server.Close()
+
+	go client.SendError(errTest("tpm type is unsupported"))
+	msgType, payload, err := server.Receive()
+	if msgType != MsgError || err == nil {
+		t.Fatalf("received %s with error %v, want an ERROR frame returned as an error", msgType, err)
+	}
+	if string(payload) != "tpm type is unsupported" {
+		t.Errorf("error payload is %q", payload)
+	}
+}
+
+func TestExpectRejectsOtherTypes(t *testing.T) {
+	client, server := connPair()
+	defer client.Close()
+	defer server.Close()
+
+	go client.Send(MsgRound, EncodeRound(RoundMessage{StimulusSeed: 1, Tau: 1}))
+	if _, err := server.Expect(MsgFinish); err == nil {
+		t.Errorf("Expect of FINISH accepted a ROUND frame")
+	}
+}
+
+func TestReceiveRejectsOversizedPayloads(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	header := make([]byte, frameHeaderSize)
+	header[0] = byte(MsgRound)
+	binary.BigEndian.PutUint32(header[1:], maxPayloadSize+1)
+	go client.Write(header)
+	if _, _, err := NewConn(server).Receive(); err == nil {
+		t.Errorf("Receive accepted a payload over the limit")
+	}
+}
+
+func TestRoundEncoding(t *testing.T) {
+	for _, round := range []RoundMessage{{StimulusSeed: 0, Tau: -1}, {StimulusSeed: 1 << 62, Tau: 1}, {StimulusSeed: -1, Tau: -1}} {
+		payload := EncodeRound(round)
+		if len(payload) != 9 {
+			t.Fatalf("round %+v encodes to %d bytes, want 9", round, len(payload))
+		}
+		decoded, err := DecodeRound(payload)
+		if err != nil || decoded != round {
+			t.Errorf("round %+v decodes to %+v, %v", round, decoded, err)
+		}
+	}
+	if _, err := DecodeRound(make([]byte, 8)); err == nil {
+		t.Errorf("DecodeRound accepted 8 bytes")
+	}
+	if _, err := DecodeRound(append(make([]byte, 8), 2)); err == nil {
+		t.Errorf("DecodeRound accepted a tau byte of 2")
+	}
+}
+
+func TestTauEncoding(t *testing.T) {
+	for _, tau := range []int{-1, 1} {
+		decoded, err := DecodeTau(EncodeTau(tau))
+		if err != nil || decoded != tau {
+			t.Errorf("tau %d decodes to %d, %v", tau, decoded, err)
+		}
+	}
+	if _, err := DecodeTau([]byte{0, 1}); err == nil {
+		t.Errorf("DecodeTau accepted 2 bytes")
+	}
+}
+
+type errTest string
+
+func (err errTest) Error() string {
+	return string(err)
+}
@@ -0,0 +1,72 @@
+package tpm_keyDerivation
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// TPMKeyDerivationHandler turns the serialized weights of a synchronized TPM into keyLength bytes of key material
+type TPMKeyDerivationHandler interface {
+	DeriveKey(material []byte, keyLength int) []byte
+}
+
+// KeyData describes the key of a session, the key itself is never kept
+type KeyData struct {
+	Fingerprint     string //Hex SHA-256 of the derived key
+	KeyBits         int
+	DistinctWeights int  //Amount of different weight values in the network
+	KeysMatch       bool //Whether B derives the same key as A
+}
+
+// SerializeWeights writes the network in a canonical form: H, then K and N of every layer, then every weight
+// layer by layer, hidden unit by hidden unit, all as varints
+func SerializeWeights(h int, k []int, n []int, weights [][][]int) []byte {
+	serialized := binary.AppendUvarint(nil, uint64(h))
+	for layer := 0; layer < h; layer++ {
+		serialized = binary.AppendUvarint(serialized, uint64(k[layer]))
+		serialized = binary.AppendUvarint(serialized, uint64(n[layer]))
+	}
+	for layer := 0; layer < h; layer++ {
+		for i := 0; i < k[layer]; i++ {
+			for j := 0; j < n[layer]; j++ {
+				serialized = binary.AppendVarint(serialized, int64(weights[layer][i][j]))
+			}
+		}
+	}
+	return serialized
+}
+
+func DistinctWeights(h int, k []int, n []int, weights [][][]int) int {
+	values := make(map[int]struct{})
+	for layer := 0; layer < h; layer++ {
+		for i := 0; i < k[layer]; i++ {
+			for j := 0; j < n[layer]; j++ {
+				values[weights[layer][i][j]] = struct{}{}
+			}
+		}
+	}
+	return len(values)
+}
+
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// PartyKeyData derives the key of one party and reports it by its fingerprint
+func PartyKeyData(kdf TPMKeyDerivationHandler, keyBits int, h int, k []int, n []int, weights [][][]int) KeyData {
+	key := kdf.DeriveKey(SerializeWeights(h, k, n, weights), keyBits/8)
+	return KeyData{
+		Fingerprint:     Fingerprint(key),
+		KeyBits:         keyBits,
+		DistinctWeights: DistinctWeights(h, k, n, weights),
+	}
+}
+
+// DeriveKeyData derives the key of A and checks it against the one of B
+func DeriveKeyData(kdf TPMKeyDerivationHandler, keyBits int, h int, k []int, n []int, weights_a [][][]int, weights_b [][][]int) KeyData {
+	keyData := PartyKeyData(kdf, keyBits, h, k, n, weights_a)
+	keyData.KeysMatch = keyData.Fingerprint == PartyKeyData(kdf, keyBits, h, k, n, weights_b).Fingerprint
+	return keyData
+}
@@ -0,0 +1,43 @@
+package tpm_keyDerivation
+
+import (
+	"crypto/hmac"
+	"hash"
+)
+
+// HKDFHandler implements HKDF (RFC 5869) on top of the given hash
+type HKDFHandler struct {
+	Hash func() hash.Hash
+	Salt []byte
+	Info []byte
+}
+
+// MaxKeyLength is the longest key HKDF can expand to with this hash, in bytes
+func (kdf HKDFHandler) MaxKeyLength() int {
+	return 255 * kdf.Hash().Size()
+}
+
+func (kdf HKDFHandler) DeriveKey(material []byte, keyLength int) []byte {
+	//Extract, an empty salt is replaced by a string of zeros as the RFC says
+	salt := kdf.Salt
+	if len(salt) == 0 {
+		salt = make([]byte, kdf.Hash().Size())
+	}
+	extractor := hmac.New(kdf.Hash, salt)
+	extractor.Write(material)
+	prk := extractor.Sum(nil)
+
+	//Expand
+	expander := hmac.New(kdf.Hash, prk)
+	key := make([]byte, 0, keyLength)
+	var block []byte
+	for counter := byte(1); len(key) < keyLength; counter++ {
+		expander.Reset()
+		expander.Write(block)
+		expander.Write(kdf.Info)
+		expander.Write([]byte{counter})
+		block = expander.Sum(nil)
+		key = append(key, block...)
+	}
+	return key[:keyLength]
+}
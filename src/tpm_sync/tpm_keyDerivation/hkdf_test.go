@@ -0,0 +1,82 @@
+package tpm_keyDerivation
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func byteRange(from int, to int) []byte {
+	values := make([]byte, 0, to-from)
+	for value := from; value < to; value++ {
+		values = append(values, byte(value))
+	}
+	return values
+}
+
+func repeatedByte(value byte, count int) []byte {
+	values := make([]byte, count)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+// TestHKDFVectors checks DeriveKey against the test vectors of RFC 5869, appendix A
+func TestHKDFVectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		hash   func() hash.Hash
+		ikm    []byte
+		salt   []byte
+		info   []byte
+		length int
+		okm    string
+	}{
+		{
+			name: "A.1 SHA-256", hash: sha256.New,
+			ikm: repeatedByte(0x0b, 22), salt: byteRange(0x00, 0x0d), info: byteRange(0xf0, 0xfa), length: 42,
+			okm: "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			name: "A.2 SHA-256 with longer inputs", hash: sha256.New,
+			ikm: byteRange(0x00, 0x50), salt: byteRange(0x60, 0xb0), info: byteRange(0xb0, 0x100), length: 82,
+			okm: "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71cc30c58179ec3e87c14c01d5c1f3434f1d87",
+		},
+		{
+			name: "A.3 SHA-256 with zero-length salt and info", hash: sha256.New,
+			ikm: repeatedByte(0x0b, 22), length: 42,
+			okm: "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+		{
+			name: "A.4 SHA-1", hash: sha1.New,
+			ikm: repeatedByte(0x0b, 11), salt: byteRange(0x00, 0x0d), info: byteRange(0xf0, 0xfa), length: 42,
+			okm: "085a01ea1b10f36933068b56efa5ad81a4f14b822f5b091568a9cdd4f155fda2c22e422478d305f3f896",
+		},
+		{
+			name: "A.7 SHA-1 with the salt not provided", hash: sha1.New,
+			ikm: repeatedByte(0x0c, 22), length: 42,
+			okm: "2c91117204d745f3500d636a62f64f0ab3bae548aa53d423b0d1f27ebba6f5e5673a081d70cce7acfc48",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kdf := HKDFHandler{Hash: test.hash, Salt: test.salt, Info: test.info}
+			if got := hex.EncodeToString(kdf.DeriveKey(test.ikm, test.length)); got != test.okm {
+				t.Errorf("DeriveKey = %s, want %s", got, test.okm)
+			}
+		})
+	}
+}
+
+func TestHKDFMaxKeyLength(t *testing.T) {
+	kdf := HKDFHandler{Hash: sha256.New}
+	if got := kdf.MaxKeyLength(); got != 255*32 {
+		t.Errorf("MaxKeyLength = %d, want %d", got, 255*32)
+	}
+	if got := len(kdf.DeriveKey([]byte("material"), kdf.MaxKeyLength())); got != kdf.MaxKeyLength() {
+		t.Errorf("DeriveKey returned %d bytes, want %d", got, kdf.MaxKeyLength())
+	}
+}
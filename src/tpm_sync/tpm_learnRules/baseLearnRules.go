@@ -1,38 +1,91 @@
 package tpm_learnRules
 
-import "tpm_sync/tpm_core"
+import (
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	Register(tpm_registry.Capability{Name: "HEBBIAN", Description: "Moves the weights of the units that agree with the output towards their input times the output", Parameters: paramCapabilities},
+		func(boundary tpm_core.WeightBoundary, params Params) TPMLearnRuleHandler {
+			return HebbianLearnRule{Boundary: boundary, Params: params}
+		})
+	Register(tpm_registry.Capability{Name: "ANTI-HEBBIAN", Description: "Moves the weights of the units that agree with the output against their input times the output", Parameters: paramCapabilities},
+		func(boundary tpm_core.WeightBoundary, params Params) TPMLearnRuleHandler {
+			return AntiHebbianLearnRule{Boundary: boundary, Params: params}
+		})
+	Register(tpm_registry.Capability{Name: "RANDOM-WALK", Description: "Moves the weights of the units that agree with the output towards their input", Parameters: paramCapabilities},
+		func(boundary tpm_core.WeightBoundary, params Params) TPMLearnRuleHandler {
+			return RandomWalkLearnRule{Boundary: boundary, Params: params}
+		})
+}
 
 type TPMLearnRuleHandler interface {
 	TPMLearnLayer(k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int)
 }
 
-type HebbianLearnRule struct{}
-type AntiHebbianLearnRule struct{}
-type RandomWalkLearnRule struct{}
+// The learn rules keep the weights in [-L, L] with their Boundary, the zero value clips them. Their Params set the size,
+// probability and units of the updates, DefaultParams gives the fixed ±1 step
+type HebbianLearnRule struct {
+	Boundary tpm_core.WeightBoundary
+	Params   Params
+}
+type AntiHebbianLearnRule struct {
+	Boundary tpm_core.WeightBoundary
+	Params   Params
+}
+type RandomWalkLearnRule struct {
+	Boundary tpm_core.WeightBoundary
+	Params   Params
+}
 
 func (learnRule HebbianLearnRule) TPMLearnLayer(k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	learns := learnRule.Params.learningUnits(k, n, weights, stimulus, outputs, output_a, output_b)
+	skipped := learnRule.Params.skippedUpdates(k, n)
 	for i := 0; i < k; i++ {
+		if !learns[i] {
+			continue
+		}
 		for j := 0; j < n; j++ {
-			newWeight := weights[i][j] + stimulus[i][j]*output_a*tpm_core.HeavisideStep(outputs[i]*output_a)*tpm_core.HeavisideStep(output_a*output_b)
-			weights[i][j] = tpm_core.GFunction(newWeight, l)
+			if skipped != nil && skipped[i][j] {
+				continue
+			}
+			newWeight := weights[i][j] + learnRule.Params.Step*stimulus[i][j]*output_a
+			weights[i][j] = tpm_core.BoundWeight(newWeight, l, learnRule.Boundary)
 		}
 	}
 }
 
 func (learnRule AntiHebbianLearnRule) TPMLearnLayer(k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	learns := learnRule.Params.learningUnits(k, n, weights, stimulus, outputs, output_a, output_b)
+	skipped := learnRule.Params.skippedUpdates(k, n)
 	for i := 0; i < k; i++ {
+		if !learns[i] {
+			continue
+		}
 		for j := 0; j < n; j++ {
-			newWeight := weights[i][j] - stimulus[i][j]*output_a*tpm_core.HeavisideStep(outputs[i]*output_a)*tpm_core.HeavisideStep(output_a*output_b)
-			weights[i][j] = tpm_core.GFunction(newWeight, l)
+			if skipped != nil && skipped[i][j] {
+				continue
+			}
+			newWeight := weights[i][j] - learnRule.Params.Step*stimulus[i][j]*output_a
+			weights[i][j] = tpm_core.BoundWeight(newWeight, l, learnRule.Boundary)
 		}
 	}
 }
 
 func (learnRule RandomWalkLearnRule) TPMLearnLayer(k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	learns := learnRule.Params.learningUnits(k, n, weights, stimulus, outputs, output_a, output_b)
+	skipped := learnRule.Params.skippedUpdates(k, n)
 	for i := 0; i < k; i++ {
+		if !learns[i] {
+			continue
+		}
 		for j := 0; j < n; j++ {
-			newWeight := weights[i][j] + stimulus[i][j]*tpm_core.HeavisideStep(outputs[i]*output_a)*tpm_core.HeavisideStep(output_a*output_b)
-			weights[i][j] = tpm_core.GFunction(newWeight, l)
+			if skipped != nil && skipped[i][j] {
+				continue
+			}
+			newWeight := weights[i][j] + learnRule.Params.Step*stimulus[i][j]
+			weights[i][j] = tpm_core.BoundWeight(newWeight, l, learnRule.Boundary)
 		}
 	}
 }
@@ -0,0 +1,33 @@
+package tpm_learnRules
+
+import "tpm_sync/tpm_core"
+
+// TPMLayerSelection decides which layers of a TPM learn on an iteration, outputs holds the outputs of every layer
+// and tau is the output the TPM learns towards
+type TPMLayerSelection interface {
+	LearnsLayer(outputs [][]int, layer int, tau int) bool
+}
+
+// AllLayers learns every layer, which is what a TPM does by default
+type AllLayers struct{}
+
+// LastLayer only learns the layer that produces the output
+type LastLayer struct{}
+
+// AgreeingLayers learns the last layer and the hidden layers whose parity agrees with tau
+type AgreeingLayers struct{}
+
+func (AllLayers) LearnsLayer(outputs [][]int, layer int, tau int) bool {
+	return true
+}
+
+func (LastLayer) LearnsLayer(outputs [][]int, layer int, tau int) bool {
+	return layer == len(outputs)-1
+}
+
+func (AgreeingLayers) LearnsLayer(outputs [][]int, layer int, tau int) bool {
+	if layer == len(outputs)-1 {
+		return true
+	}
+	return tpm_core.Thau(outputs[layer], len(outputs[layer])) == tau
+}
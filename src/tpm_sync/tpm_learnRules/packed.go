@@ -0,0 +1,27 @@
+package tpm_learnRules
+
+import "tpm_sync/tpm_core"
+
+// TPMPackedLearnRule is a learn rule that the packed kernel can run with tpm_core.PackedLayer.LearnUnit. PackedDirection is
+// what every weight of an agreeing unit moves towards, times its ±1 input, when the output is output_a. It is false when
+// the params or the boundary of the rule need the reference path
+type TPMPackedLearnRule interface {
+	PackedDirection(output_a int) (int, bool)
+}
+
+// isPackable is true for the fixed ±1 step on every weight of every agreeing unit, clipped to [-L, L]
+func (params Params) isPackable(boundary tpm_core.WeightBoundary) bool {
+	return params.Step == 1 && !params.IsStochastic() && params.Units == 0 && boundary == tpm_core.BoundaryClip
+}
+
+func (learnRule HebbianLearnRule) PackedDirection(output_a int) (int, bool) {
+	return output_a, learnRule.Params.isPackable(learnRule.Boundary)
+}
+
+func (learnRule AntiHebbianLearnRule) PackedDirection(output_a int) (int, bool) {
+	return -output_a, learnRule.Params.isPackable(learnRule.Boundary)
+}
+
+func (learnRule RandomWalkLearnRule) PackedDirection(output_a int) (int, bool) {
+	return 1, learnRule.Params.isPackable(learnRule.Boundary)
+}
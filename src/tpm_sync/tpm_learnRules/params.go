@@ -0,0 +1,112 @@
+package tpm_learnRules
+
+import (
+	"math"
+	"sort"
+	"tpm_sync/tpm_registry"
+)
+
+// Params are the settings the learn rules read besides the network shape.
+// Step scales every update, Probability is the chance of applying the update of each weight, and Units limits the update
+// to that many of the agreeing hidden units of a layer, the ones with the smallest |local field|, 0 meaning all of them.
+// Skips decides the stochastic updates, it is only needed when Probability is below 1, and Layer is the layer the rule learns.
+// There is no momentum, every update only depends on the current stimulus and outputs
+type Params struct {
+	Step        int
+	Probability float64
+	Units       int
+	Layer       int
+	Skips       *UpdateSkips
+}
+
+// DefaultParams is the fixed ±1 step that every rule used before they had parameters
+var DefaultParams = Params{Step: 1, Probability: 1}
+
+// IsStochastic is true when the updates are drawn, so the rule needs Skips
+func (params Params) IsStochastic() bool {
+	return params.Probability < 1
+}
+
+// paramCapabilities describes the params in the settings file, every rule registered here reads all of them
+var paramCapabilities = []tpm_registry.Parameter{
+	{Name: "learn_steps", Description: "size of every weight update, 1 by default"},
+	{Name: "learn_probabilities", Description: "probability of applying the update of each weight, 1 by default"},
+	{Name: "learn_units", Description: "agreeing hidden units updated per layer, the ones with the smallest |local field|, 0 means all of them"},
+}
+
+// learningUnits marks the hidden units that learn: the ones whose output is output_a when A and B agree,
+// limited to the Units of them with the smallest |local field|. The fields are read before any weight changes
+func (params Params) learningUnits(k int, n int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) []bool {
+	learns := make([]bool, k)
+	if output_a != output_b {
+		return learns
+	}
+	var agreeing []int
+	for i := 0; i < k; i++ {
+		if outputs[i] == output_a {
+			agreeing = append(agreeing, i)
+		}
+	}
+	if params.Units > 0 && params.Units < len(agreeing) {
+		fields := make([]float64, k)
+		for _, i := range agreeing {
+			field := 0
+			for j := 0; j < n; j++ {
+				field += weights[i][j] * stimulus[i][j]
+			}
+			fields[i] = math.Abs(float64(field))
+		}
+		sort.SliceStable(agreeing, func(a, b int) bool {
+			return fields[agreeing[a]] < fields[agreeing[b]]
+		})
+		agreeing = agreeing[:params.Units]
+	}
+	for _, i := range agreeing {
+		learns[i] = true
+	}
+	return learns
+}
+
+// UpdateSkips decides which weight updates the stochastic rules skip. A skip only depends on the session seed, the iteration,
+// the layer and the weight, so parties that share the seed skip the same updates even when one of them didn't learn
+// some layers or iterations before. The session sets the iteration before anyone learns
+type UpdateSkips struct {
+	seed      int64
+	iteration int
+}
+
+func NewUpdateSkips(seed int64) *UpdateSkips {
+	return &UpdateSkips{seed: seed}
+}
+
+func (skips *UpdateSkips) SetIteration(iteration int) {
+	if skips != nil {
+		skips.iteration = iteration
+	}
+}
+
+// splitmix64 is the finalizer of the SplitMix64 generator, it scrambles every bit of x into every bit of the result
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// skippedUpdates decides which weight updates of the layer a stochastic rule skips, nil when every update is applied
+func (params Params) skippedUpdates(k int, n int) [][]bool {
+	if !params.IsStochastic() {
+		return nil
+	}
+	layerKey := splitmix64(splitmix64(splitmix64(uint64(params.Skips.seed))^uint64(params.Skips.iteration)) ^ uint64(params.Layer))
+	skipped := make([][]bool, k)
+	for i := 0; i < k; i++ {
+		skipped[i] = make([]bool, n)
+		for j := 0; j < n; j++ {
+			//The top 53 bits make a uniform float in [0, 1[, like rand.Float64
+			draw := float64(splitmix64(layerKey^uint64(i*n+j))>>11) / (1 << 53)
+			skipped[i][j] = draw >= params.Probability
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,119 @@
+package tpm_learnRules
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The fields of the units of unitsWeights with unitsStimulus are 3, -1, 2, 0 and -5, and their outputs are unitsOutputs
+var (
+	unitsWeights  = [][]int{{1, 2}, {-1, 0}, {2, 0}, {1, -1}, {-2, -3}}
+	unitsStimulus = [][]int{{1, 1}, {1, 1}, {1, 1}, {1, 1}, {1, 1}}
+	unitsOutputs  = []int{1, -1, 1, 1, -1}
+)
+
+func TestLearningUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    int
+		output_a int
+		output_b int
+		want     []bool
+	}{
+		{"all agreeing units", 0, 1, 1, []bool{true, false, true, true, false}},
+		{"smallest field", 1, 1, 1, []bool{false, false, false, true, false}},
+		{"two smallest fields", 2, 1, 1, []bool{false, false, true, true, false}},
+		{"as many as agree", 3, 1, 1, []bool{true, false, true, true, false}},
+		{"more than agree", 4, 1, 1, []bool{true, false, true, true, false}},
+		{"smallest field of the negative units", 1, -1, -1, []bool{false, true, false, false, false}},
+		{"disagreeing outputs", 0, 1, -1, []bool{false, false, false, false, false}},
+		{"disagreeing outputs with units", 1, -1, 1, []bool{false, false, false, false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := Params{Step: 1, Probability: 1, Units: test.units}
+			got := params.learningUnits(len(unitsWeights), 2, unitsWeights, unitsStimulus, unitsOutputs, test.output_a, test.output_b)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("learningUnits = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestLearningUnitsKeepsTheFirstOfEqualFields checks that units with the same |local field| are picked in order, so every party
+// picks the same ones
+func TestLearningUnitsKeepsTheFirstOfEqualFields(t *testing.T) {
+	weights := [][]int{{2, 0}, {-2, 0}, {0, 2}, {1, 0}}
+	stimulus := [][]int{{1, 1}, {1, 1}, {1, 1}, {1, 1}}
+	outputs := []int{1, -1, 1, 1}
+	params := Params{Step: 1, Probability: 1, Units: 2}
+	got := params.learningUnits(4, 2, weights, stimulus, outputs, 1, 1)
+	if want := []bool{true, false, false, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("learningUnits = %v, want %v", got, want)
+	}
+}
+
+// TestLearnUnitsOnlyMovesTheSelectedUnits checks the rules with Units, the fields are read before the weights change
+func TestLearnUnitsOnlyMovesTheSelectedUnits(t *testing.T) {
+	for _, rule := range []TPMLearnRuleHandler{
+		HebbianLearnRule{Params: Params{Step: 1, Probability: 1, Units: 1}},
+		AntiHebbianLearnRule{Params: Params{Step: 1, Probability: 1, Units: 1}},
+		RandomWalkLearnRule{Params: Params{Step: 1, Probability: 1, Units: 1}},
+	} {
+		weights := make([][]int, len(unitsWeights))
+		for i := range unitsWeights {
+			weights[i] = append([]int(nil), unitsWeights[i]...)
+		}
+		rule.TPMLearnLayer(len(weights), 2, 3, weights, unitsStimulus, unitsOutputs, 1, 1)
+		for i := range weights {
+			if i != 3 && !reflect.DeepEqual(weights[i], unitsWeights[i]) {
+				t.Errorf("%T moved unit %d from %v to %v", rule, i, unitsWeights[i], weights[i])
+			}
+		}
+		if reflect.DeepEqual(weights[3], unitsWeights[3]) {
+			t.Errorf("%T didn't move unit 3", rule)
+		}
+	}
+}
+
+// TestSkippedUpdatesOnlyDependOnTheIteration checks that a party which didn't learn for a while skips the same updates as one
+// that learned every iteration, and that the skips change with the iteration and the layer
+func TestSkippedUpdatesOnlyDependOnTheIteration(t *testing.T) {
+	const k, n = 3, 20
+	always := Params{Probability: 0.5, Skips: NewUpdateSkips(7)}
+	sometimes := Params{Probability: 0.5, Skips: NewUpdateSkips(7)}
+	for iteration := 0; iteration < 10; iteration++ {
+		always.Skips.SetIteration(iteration)
+		always.skippedUpdates(k, n)
+	}
+	sometimes.Skips.SetIteration(9)
+	if !reflect.DeepEqual(always.skippedUpdates(k, n), sometimes.skippedUpdates(k, n)) {
+		t.Errorf("the skips of iteration 9 depend on the iterations before it")
+	}
+
+	last := always.skippedUpdates(k, n)
+	always.Skips.SetIteration(10)
+	if reflect.DeepEqual(always.skippedUpdates(k, n), last) {
+		t.Errorf("iterations 9 and 10 skip the same updates")
+	}
+	otherLayer := always
+	otherLayer.Layer = 1
+	if reflect.DeepEqual(always.skippedUpdates(k, n), otherLayer.skippedUpdates(k, n)) {
+		t.Errorf("layers 0 and 1 skip the same updates")
+	}
+
+	skips := 0
+	for iteration := 0; iteration < 100; iteration++ {
+		always.Skips.SetIteration(iteration)
+		for _, unit := range always.skippedUpdates(k, n) {
+			for _, skipped := range unit {
+				if skipped {
+					skips++
+				}
+			}
+		}
+	}
+	if rate := float64(skips) / (100 * k * n); rate < 0.45 || rate > 0.55 {
+		t.Errorf("skipped %v of the updates with probability 0.5", rate)
+	}
+}
@@ -0,0 +1,77 @@
+package tpm_learnRules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_registry"
+)
+
+// LearnRuleFactory creates a learn rule that keeps the weights in [-L, L] with boundary and updates them as params say
+type LearnRuleFactory func(boundary tpm_core.WeightBoundary, params Params) TPMLearnRuleHandler
+
+type registeredLearnRule struct {
+	capability tpm_registry.Capability
+	factory    LearnRuleFactory
+}
+
+var learnRules = map[string]registeredLearnRule{}
+
+// Register makes a learn rule available to the settings by its name, which has to be upper case and not taken yet
+func Register(capability tpm_registry.Capability, factory LearnRuleFactory) {
+	if capability.Name != strings.ToUpper(capability.Name) {
+		panic(fmt.Sprintf("learn rule names must be upper case: %s", capability.Name))
+	}
+	if _, isTaken := learnRules[capability.Name]; isTaken {
+		panic(fmt.Sprintf("learn rule registered twice: %s", capability.Name))
+	}
+	learnRules[capability.Name] = registeredLearnRule{capability: capability, factory: factory}
+}
+
+// NormalizeName is the name a learn rule is registered as, the names are case insensitive and surrounding spaces are ignored
+func NormalizeName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+// ParseLayerRules splits a learn rule that is either a single rule or a comma separated list with one rule per layer,
+// like "HEBBIAN,RANDOM-WALK", into the normalized name of every rule it lists
+func ParseLayerRules(learnRule string) []string {
+	layerRules := strings.Split(learnRule, ",")
+	for layer := range layerRules {
+		layerRules[layer] = NormalizeName(layerRules[layer])
+	}
+	return layerRules
+}
+
+// NormalizeLayerRules is the learn rule with every rule it lists normalized, which is how it is stored with the sessions
+func NormalizeLayerRules(learnRule string) string {
+	return strings.Join(ParseLayerRules(learnRule), ",")
+}
+
+// New creates the learn rule registered as name, which is normalized first
+func New(name string, boundary tpm_core.WeightBoundary, params Params) (TPMLearnRuleHandler, bool) {
+	learnRule, isRegistered := learnRules[NormalizeName(name)]
+	if !isRegistered {
+		return nil, false
+	}
+	return learnRule.factory(boundary, params), true
+}
+
+// IsRegistered is true when name is the name of a registered learn rule, it is normalized like in New
+func IsRegistered(name string) bool {
+	_, isRegistered := learnRules[NormalizeName(name)]
+	return isRegistered
+}
+
+// Capabilities lists the registered learn rules sorted by name
+func Capabilities() []tpm_registry.Capability {
+	capabilities := make([]tpm_registry.Capability, 0, len(learnRules))
+	for _, learnRule := range learnRules {
+		capabilities = append(capabilities, learnRule.capability)
+	}
+	sort.Slice(capabilities, func(a, b int) bool {
+		return capabilities[a].Name < capabilities[b].Name
+	})
+	return capabilities
+}
@@ -0,0 +1,43 @@
+package tpm_learnRules
+
+import (
+	"reflect"
+	"testing"
+	"tpm_sync/tpm_core"
+)
+
+func TestRegistryNamesAreNormalized(t *testing.T) {
+	for _, name := range []string{"HEBBIAN", "hebbian", " Hebbian ", "random-walk"} {
+		if !IsRegistered(name) {
+			t.Errorf("IsRegistered(%q) is false", name)
+		}
+		if _, isRegistered := New(name, tpm_core.BoundaryClip, DefaultParams); !isRegistered {
+			t.Errorf("New(%q) didn't find the rule", name)
+		}
+	}
+	for _, name := range []string{"", "HEBB", "HEBBIAN,RANDOM-WALK"} {
+		if IsRegistered(name) {
+			t.Errorf("IsRegistered(%q) is true", name)
+		}
+	}
+}
+
+func TestParseLayerRules(t *testing.T) {
+	tests := []struct {
+		learnRule string
+		want      []string
+	}{
+		{"HEBBIAN", []string{"HEBBIAN"}},
+		{"hebbian", []string{"HEBBIAN"}},
+		{"HEBBIAN,RANDOM-WALK", []string{"HEBBIAN", "RANDOM-WALK"}},
+		{"HEBBIAN, random-walk ,anti-hebbian", []string{"HEBBIAN", "RANDOM-WALK", "ANTI-HEBBIAN"}},
+	}
+	for _, test := range tests {
+		if got := ParseLayerRules(test.learnRule); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseLayerRules(%q) = %q, want %q", test.learnRule, got, test.want)
+		}
+	}
+	if got := NormalizeLayerRules("hebbian, RANDOM-WALK"); got != "HEBBIAN,RANDOM-WALK" {
+		t.Errorf("NormalizeLayerRules = %q", got)
+	}
+}
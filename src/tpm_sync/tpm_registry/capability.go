@@ -0,0 +1,14 @@
+package tpm_registry
+
+// Parameter is a setting that a registered implementation reads, Name is its key in the settings file
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Capability describes an implementation registered by name, which is how the settings pick it
+type Capability struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  []Parameter `json:"parameters"`
+}
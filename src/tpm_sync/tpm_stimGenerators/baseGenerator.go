@@ -0,0 +1,120 @@
+package tpm_stimGenerators
+
+import (
+	"math"
+	"math/rand"
+)
+
+// TPMStimulusGenerator creates the public stimulus of every iteration, the values are in ±[1..m] like the uniform stimulus.
+// Generators can keep state between calls, so every session needs its own
+type TPMStimulusGenerator interface {
+	CreateStimulus(k int, n int, m int) [][]int
+}
+
+// UniformGenerator draws a random sign and a uniform magnitude in [1..m]
+type UniformGenerator struct {
+	localRand *rand.Rand
+}
+
+// BinaryGenerator only draws ±1, whatever m is
+type BinaryGenerator struct {
+	localRand *rand.Rand
+}
+
+// GaussianGenerator draws from a normal distribution with deviation Sigma and rounds the magnitude up into [1..m]
+type GaussianGenerator struct {
+	Sigma     float64
+	localRand *rand.Rand
+}
+
+// BiasedGenerator draws a uniform magnitude like UniformGenerator, but the sign has mean Bias, so +1 comes with probability (1+Bias)/2
+type BiasedGenerator struct {
+	Bias      float64
+	localRand *rand.Rand
+}
+
+func NewUniformGenerator(localRand *rand.Rand) UniformGenerator {
+	return UniformGenerator{localRand: localRand}
+}
+
+func NewBinaryGenerator(localRand *rand.Rand) BinaryGenerator {
+	return BinaryGenerator{localRand: localRand}
+}
+
+func NewGaussianGenerator(sigma float64, localRand *rand.Rand) GaussianGenerator {
+	return GaussianGenerator{Sigma: sigma, localRand: localRand}
+}
+
+func NewBiasedGenerator(bias float64, localRand *rand.Rand) BiasedGenerator {
+	return BiasedGenerator{Bias: bias, localRand: localRand}
+}
+
+func (generator UniformGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	//Same draws as tpm_core.CreateRandomStimulusArray, so sessions keep their seeds
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			stim[i][j] = (generator.localRand.Intn(2)*2 - 1) * (generator.localRand.Intn(m) + 1)
+		}
+	}
+	return stim
+}
+
+func (generator BinaryGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			stim[i][j] = generator.localRand.Intn(2)*2 - 1
+		}
+	}
+	return stim
+}
+
+func (generator GaussianGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			x := generator.localRand.NormFloat64() * generator.Sigma
+			stim[i][j] = signOf(x) * quantizeMagnitude(math.Abs(x), m)
+		}
+	}
+	return stim
+}
+
+func (generator BiasedGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	positive := (1 + generator.Bias) / 2
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			sign := -1
+			if generator.localRand.Float64() < positive {
+				sign = 1
+			}
+			stim[i][j] = sign * (generator.localRand.Intn(m) + 1)
+		}
+	}
+	return stim
+}
+
+func signOf(x float64) int {
+	if x < 0 {
+		return -1
+	}
+	return 1
+}
+
+// quantizeMagnitude rounds a magnitude up and clamps it to [1..m], there are no zero stimuli
+func quantizeMagnitude(x float64, m int) int {
+	magnitude := int(math.Ceil(x))
+	if magnitude < 1 {
+		return 1
+	}
+	if magnitude > m {
+		return m
+	}
+	return magnitude
+}
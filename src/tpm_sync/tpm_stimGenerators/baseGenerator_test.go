@@ -0,0 +1,94 @@
+package tpm_stimGenerators
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// valueCounts counts every stimulus value of k*n stimuli, and fails when one is outside ±[1..m]
+func valueCounts(t *testing.T, generator TPMStimulusGenerator, k int, n int, m int) map[int]int {
+	t.Helper()
+	counts := map[int]int{}
+	for _, row := range generator.CreateStimulus(k, n, m) {
+		for _, value := range row {
+			if value == 0 || value < -m || value > m {
+				t.Fatalf("stimulus %d is outside ±[1..%d]", value, m)
+			}
+			counts[value]++
+		}
+	}
+	return counts
+}
+
+func TestQuantizeMagnitude(t *testing.T) {
+	tests := []struct {
+		x    float64
+		m    int
+		want int
+	}{
+		{0, 3, 1},
+		{0.2, 3, 1},
+		{1, 3, 1},
+		{1.01, 3, 2},
+		{3, 3, 3},
+		{3.5, 3, 3},
+		{1000, 3, 3},
+		{5, 1, 1},
+	}
+	for _, test := range tests {
+		if got := quantizeMagnitude(test.x, test.m); got != test.want {
+			t.Errorf("quantizeMagnitude(%v, %d) = %d, want %d", test.x, test.m, got, test.want)
+		}
+	}
+}
+
+func TestGaussianGeneratorClampsToM(t *testing.T) {
+	const m = 3
+	wide := valueCounts(t, NewGaussianGenerator(100, rand.New(rand.NewSource(1))), 10, 1000, m)
+	if wide[m] == 0 || wide[-m] == 0 || wide[m]+wide[-m] < 9000 {
+		t.Errorf("a deviation of 100 gave %d stimuli of ±%d, most of them should be clamped there", wide[m]+wide[-m], m)
+	}
+	narrow := valueCounts(t, NewGaussianGenerator(0.01, rand.New(rand.NewSource(1))), 10, 1000, m)
+	if narrow[1]+narrow[-1] != 10000 {
+		t.Errorf("a deviation of 0.01 gave %v, every stimulus should be ±1", narrow)
+	}
+}
+
+func TestBiasedGenerator(t *testing.T) {
+	tests := []struct {
+		bias         float64
+		wantPositive float64
+	}{
+		{1, 1},
+		{-1, 0},
+		{0, 0.5},
+		{0.5, 0.75},
+	}
+	for _, test := range tests {
+		const m = 4
+		counts := valueCounts(t, NewBiasedGenerator(test.bias, rand.New(rand.NewSource(2))), 10, 1000, m)
+		positive := 0
+		for value := 1; value <= m; value++ {
+			positive += counts[value]
+			if test.wantPositive == 1 && counts[value] == 0 {
+				t.Errorf("bias %v never drew %d", test.bias, value)
+			}
+		}
+		if got := float64(positive) / 10000; math.Abs(got-test.wantPositive) > 0.02 {
+			t.Errorf("bias %v drew %v positive stimuli, want %v", test.bias, got, test.wantPositive)
+		}
+	}
+}
+
+func TestUniformAndBinaryGenerators(t *testing.T) {
+	const m = 3
+	uniform := valueCounts(t, NewUniformGenerator(rand.New(rand.NewSource(3))), 10, 600, m)
+	if len(uniform) != 2*m {
+		t.Errorf("UNIFORM drew %v, want every value of ±[1..%d]", uniform, m)
+	}
+	binary := valueCounts(t, NewBinaryGenerator(rand.New(rand.NewSource(3))), 10, 600, m)
+	if len(binary) != 2 || binary[1] == 0 || binary[-1] == 0 {
+		t.Errorf("BINARY drew %v, want only ±1", binary)
+	}
+}
@@ -0,0 +1,108 @@
+package tpm_stimGenerators
+
+import (
+	"math"
+	"math/rand"
+)
+
+// LogisticGenerator iterates the logistic map x = 4x(1-x) once per stimulus, only the starting point is random.
+// [0, 1[ is split into 2m bins mapped to -m..-1, 1..m, so the stimuli follow the arcsine density of the map and the extremes are the most common
+type LogisticGenerator struct {
+	x         float64
+	localRand *rand.Rand
+}
+
+// LorenzGenerator integrates the Lorenz system with sigma 10, rho 28 and beta 8/3, taking lorenzSteps steps per stimulus.
+// The trajectory changes slowly, so the stimulus comes from the low digits of x instead of its value
+type LorenzGenerator struct {
+	x, y, z float64
+}
+
+const (
+	lorenzStep    = 0.01
+	lorenzSteps   = 10
+	lorenzBurnIn  = 1000
+	lorenzDigits  = 1e6
+	lorenzSigma   = 10.0
+	lorenzRho     = 28.0
+	lorenzBeta    = 8.0 / 3.0
+	logisticEdges = 0.01 //Keeps the starting point away from the fixed points at 0 and 3/4 and the 0.5 -> 1 -> 0 collapse
+)
+
+func NewLogisticGenerator(localRand *rand.Rand) *LogisticGenerator {
+	generator := &LogisticGenerator{localRand: localRand}
+	generator.reseed()
+	return generator
+}
+
+func NewLorenzGenerator(localRand *rand.Rand) *LorenzGenerator {
+	generator := &LorenzGenerator{
+		x: 1 + localRand.Float64(),
+		y: 1 + localRand.Float64(),
+		z: 1 + localRand.Float64(),
+	}
+	//Let the trajectory settle on the attractor
+	for i := 0; i < lorenzBurnIn; i++ {
+		generator.step()
+	}
+	return generator
+}
+
+func (generator *LogisticGenerator) reseed() {
+	generator.x = logisticEdges + generator.localRand.Float64()*(1-2*logisticEdges)
+}
+
+func (generator *LogisticGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			generator.x = 4 * generator.x * (1 - generator.x)
+			//Rounding can land the orbit on 0, where it would stay
+			if generator.x <= 0 || generator.x >= 1 {
+				generator.reseed()
+			}
+			bin := int(generator.x * float64(2*m))
+			if bin >= m {
+				stim[i][j] = bin - m + 1
+			} else {
+				stim[i][j] = bin - m
+			}
+		}
+	}
+	return stim
+}
+
+func (generator *LorenzGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		for j := 0; j < n; j++ {
+			for step := 0; step < lorenzSteps; step++ {
+				generator.step()
+			}
+			digits := int(math.Mod(math.Abs(generator.x)*lorenzDigits, float64(2*m)))
+			sign := 1
+			if digits%2 == 1 {
+				sign = -1
+			}
+			stim[i][j] = sign * (digits/2 + 1)
+		}
+	}
+	return stim
+}
+
+// step is one fourth order Runge-Kutta step of the Lorenz system
+func (generator *LorenzGenerator) step() {
+	derivative := func(x, y, z float64) (float64, float64, float64) {
+		return lorenzSigma * (y - x), x*(lorenzRho-z) - y, x*y - lorenzBeta*z
+	}
+	x, y, z := generator.x, generator.y, generator.z
+	dx1, dy1, dz1 := derivative(x, y, z)
+	dx2, dy2, dz2 := derivative(x+dx1*lorenzStep/2, y+dy1*lorenzStep/2, z+dz1*lorenzStep/2)
+	dx3, dy3, dz3 := derivative(x+dx2*lorenzStep/2, y+dy2*lorenzStep/2, z+dz2*lorenzStep/2)
+	dx4, dy4, dz4 := derivative(x+dx3*lorenzStep, y+dy3*lorenzStep, z+dz3*lorenzStep)
+	generator.x = x + (dx1+2*dx2+2*dx3+dx4)*lorenzStep/6
+	generator.y = y + (dy1+2*dy2+2*dy3+dy4)*lorenzStep/6
+	generator.z = z + (dz1+2*dz2+2*dz3+dz4)*lorenzStep/6
+}
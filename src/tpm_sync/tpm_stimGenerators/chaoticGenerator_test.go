@@ -0,0 +1,29 @@
+package tpm_stimGenerators
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestChaoticGeneratorsCoverTheRange(t *testing.T) {
+	const m = 3
+	generators := map[string]TPMStimulusGenerator{
+		"LOGISTIC": NewLogisticGenerator(rand.New(rand.NewSource(4))),
+		"LORENZ":   NewLorenzGenerator(rand.New(rand.NewSource(4))),
+	}
+	for name, generator := range generators {
+		counts := valueCounts(t, generator, 10, 1000, m)
+		if len(counts) != 2*m {
+			t.Errorf("%s drew %v, want every value of ±[1..%d]", name, counts, m)
+		}
+	}
+}
+
+// TestLogisticGeneratorFollowsTheArcsineDensity checks that the extremes, the bins next to 0 and 1, are the most common
+func TestLogisticGeneratorFollowsTheArcsineDensity(t *testing.T) {
+	const m = 3
+	counts := valueCounts(t, NewLogisticGenerator(rand.New(rand.NewSource(5))), 10, 10000, m)
+	if counts[m] <= counts[1] || counts[-m] <= counts[-1] {
+		t.Errorf("LOGISTIC drew %v, ±%d should be more common than ±1", counts, m)
+	}
+}
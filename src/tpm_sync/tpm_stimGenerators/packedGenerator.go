@@ -0,0 +1,81 @@
+package tpm_stimGenerators
+
+import (
+	"math/rand"
+	"tpm_sync/tpm_core"
+)
+
+// TPMPackedStimulusGenerator is a generator that can write ±1 stimuli straight into packed words for the packed kernel.
+// CreatePackedStimulus takes the same draws as CreateStimulus, so a session gets the same stimuli in both kernels,
+// as long as the generator only draws ±1 for the m of the session
+type TPMPackedStimulusGenerator interface {
+	TPMStimulusGenerator
+	CreatePackedStimulus(k int, n int, m int, stimulus []uint64)
+}
+
+// PackedBinaryGenerator draws ±1 like BinaryGenerator, but takes one 64 bit draw for every 64 stimuli of a row
+// instead of a draw per stimulus. It's a different stream from BinaryGenerator. With the other generators the draws take
+// most of the time of a packed iteration, BenchmarkPackedKernel measures the difference
+type PackedBinaryGenerator struct {
+	localRand *rand.Rand
+}
+
+func NewPackedBinaryGenerator(localRand *rand.Rand) PackedBinaryGenerator {
+	return PackedBinaryGenerator{localRand: localRand}
+}
+
+func (generator PackedBinaryGenerator) CreateStimulus(k int, n int, m int) [][]int {
+	words := make([]uint64, tpm_core.PackedWords(n))
+	stim := make([][]int, k)
+	for i := 0; i < k; i++ {
+		stim[i] = make([]int, n)
+		generator.createPackedRow(words)
+		tpm_core.UnpackSigns(words, stim[i])
+	}
+	return stim
+}
+
+func (generator PackedBinaryGenerator) CreatePackedStimulus(k int, n int, m int, stimulus []uint64) {
+	words := tpm_core.PackedWords(n)
+	for i := 0; i < k; i++ {
+		generator.createPackedRow(stimulus[i*words : (i+1)*words])
+	}
+}
+
+// createPackedRow draws every word of a row, the bits after n are drawn too so rows always take the same draws
+func (generator PackedBinaryGenerator) createPackedRow(words []uint64) {
+	for w := range words {
+		words[w] = generator.localRand.Uint64()
+	}
+}
+
+// CreatePackedStimulus of the BinaryGenerator still takes a draw per stimulus, Intn(2) uses a whole Int63 for one bit,
+// so packing saves the unpacking but not the draws that keep the stream of CreateStimulus
+func (generator BinaryGenerator) CreatePackedStimulus(k int, n int, m int, stimulus []uint64) {
+	words := tpm_core.PackedWords(n)
+	for i := 0; i < k; i++ {
+		row := stimulus[i*words : (i+1)*words]
+		for w := range row {
+			row[w] = 0
+		}
+		for j := 0; j < n; j++ {
+			row[j/64] |= uint64(generator.localRand.Intn(2)) << (j % 64)
+		}
+	}
+}
+
+// CreatePackedStimulus of the UniformGenerator only packs the signs, so it's only the same stimulus for m 1,
+// where the magnitude is always 1 but Intn(1) still takes its draw, two draws per stimulus like CreateStimulus
+func (generator UniformGenerator) CreatePackedStimulus(k int, n int, m int, stimulus []uint64) {
+	words := tpm_core.PackedWords(n)
+	for i := 0; i < k; i++ {
+		row := stimulus[i*words : (i+1)*words]
+		for w := range row {
+			row[w] = 0
+		}
+		for j := 0; j < n; j++ {
+			row[j/64] |= uint64(generator.localRand.Intn(2)) << (j % 64)
+			generator.localRand.Intn(m)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package tpm_stimGenerators
+
+import (
+	"math/rand"
+	"testing"
+	"tpm_sync/tpm_core"
+)
+
+// TestPackedBinaryGeneratorBitLayout checks that every row takes one Uint64 per word, padding included, and that bit j%64
+// of word j/64 set means stimulus j is +1
+func TestPackedBinaryGeneratorBitLayout(t *testing.T) {
+	const k, n = 3, 70
+	words := tpm_core.PackedWords(n)
+	stimulus := NewPackedBinaryGenerator(rand.New(rand.NewSource(6))).CreateStimulus(k, n, 1)
+	draws := rand.New(rand.NewSource(6))
+	for i := 0; i < k; i++ {
+		row := make([]uint64, words)
+		for w := range row {
+			row[w] = draws.Uint64()
+		}
+		for j := 0; j < n; j++ {
+			want := -1
+			if row[j/64]>>(j%64)&1 == 1 {
+				want = 1
+			}
+			if stimulus[i][j] != want {
+				t.Fatalf("stimulus %d of row %d is %d, want %d", j, i, stimulus[i][j], want)
+			}
+		}
+	}
+
+	packed := make([]uint64, k*words)
+	NewPackedBinaryGenerator(rand.New(rand.NewSource(6))).CreatePackedStimulus(k, n, 1, packed)
+	draws = rand.New(rand.NewSource(6))
+	for w := range packed {
+		if want := draws.Uint64(); packed[w] != want {
+			t.Fatalf("packed word %d is %x, want the draw %x", w, packed[w], want)
+		}
+	}
+}
+
+// TestPackedStimulusMatchesCreateStimulus checks that the generators that support the packed kernel take the same draws in both
+func TestPackedStimulusMatchesCreateStimulus(t *testing.T) {
+	const k, n = 2, 70
+	generators := map[string]func(localRand *rand.Rand) TPMPackedStimulusGenerator{
+		"BINARY":        func(localRand *rand.Rand) TPMPackedStimulusGenerator { return NewBinaryGenerator(localRand) },
+		"UNIFORM":       func(localRand *rand.Rand) TPMPackedStimulusGenerator { return NewUniformGenerator(localRand) },
+		"PACKED_BINARY": func(localRand *rand.Rand) TPMPackedStimulusGenerator { return NewPackedBinaryGenerator(localRand) },
+	}
+	for name, newGenerator := range generators {
+		words := tpm_core.PackedWords(n)
+		stimulus := newGenerator(rand.New(rand.NewSource(7))).CreateStimulus(k, n, 1)
+		packed := make([]uint64, k*words)
+		newGenerator(rand.New(rand.NewSource(7))).CreatePackedStimulus(k, n, 1, packed)
+		for i := 0; i < k; i++ {
+			unpacked := make([]int, n)
+			tpm_core.UnpackSigns(packed[i*words:(i+1)*words], unpacked)
+			for j := range unpacked {
+				if unpacked[j] != stimulus[i][j] {
+					t.Fatalf("%s: packed stimulus %d of row %d is %d, CreateStimulus drew %d", name, j, i, unpacked[j], stimulus[i][j])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package tpm_stimGenerators
+
+import (
+	"math"
+	"math/rand"
+)
+
+// QueryStimulus turns a first layer stimulus into a query of the party that owns weights, as in Ruttor et al.:
+// the local field of every hidden unit is pushed towards ±field, with a random sign per unit.
+// It only flips signs of the stimulus it gets, so the magnitudes drawn by the generator are kept.
+// The inputs are visited in a random order and a sign is flipped whenever that gets the field closer to the target
+func QueryStimulus(stimulus [][]int, weights [][]int, k int, n int, field float64, localRand *rand.Rand) {
+	for i := 0; i < k; i++ {
+		target := field * math.Sqrt(float64(n))
+		if localRand.Intn(2) == 0 {
+			target = -target
+		}
+		dot_prod := 0
+		for j := 0; j < n; j++ {
+			dot_prod += weights[i][j] * stimulus[i][j]
+		}
+		for _, j := range localRand.Perm(n) {
+			flipped := dot_prod - 2*weights[i][j]*stimulus[i][j]
+			if math.Abs(float64(flipped)-target) < math.Abs(float64(dot_prod)-target) {
+				stimulus[i][j] = -stimulus[i][j]
+				dot_prod = flipped
+			}
+		}
+	}
+}
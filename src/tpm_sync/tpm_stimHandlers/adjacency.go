@@ -0,0 +1,93 @@
+package tpm_stimHandlers
+
+import (
+	"fmt"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{
+			Name:        "ADJACENCY",
+			Description: "Every hidden unit after the first layer reads the outputs listed for it, from any earlier layer",
+			Parameters:  []tpm_registry.Parameter{{Name: "connectivity", Description: "[layer, unit] outputs read by every hidden unit of every layer after the first"}},
+		},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			if config.Connectivity == nil {
+				return nil, fmt.Errorf("ADJACENCY TPMs need a connectivity description")
+			}
+			return AdjacencyTPM{Connectivity: *config.Connectivity}, nil
+		},
+	})
+}
+
+// Connectivity describes the wiring of every layer after the first, which reads the stimulus.
+// Layers[h-1][i] lists the inputs of unit i of layer h as [layer, unit] pairs, any earlier layer can feed them so skip connections are allowed.
+// Every unit of a layer needs the same amount of inputs, that amount is the N of the layer
+type Connectivity struct {
+	Layers [][][][2]int `json:"layers"`
+}
+
+// AdjacencyTPM wires the layers as its Connectivity says
+type AdjacencyTPM struct {
+	Connectivity Connectivity
+}
+
+// Validate checks that the connectivity describes a TPM with the hidden units of k
+func (connectivity Connectivity) Validate(k []int) error {
+	h := len(k)
+	if len(connectivity.Layers) != h-1 {
+		return fmt.Errorf("connectivity describes %d layers after the first, K has %d: %v", len(connectivity.Layers), h-1, k)
+	}
+	for layer := 1; layer < h; layer++ {
+		units := connectivity.Layers[layer-1]
+		if len(units) != k[layer] {
+			return fmt.Errorf("connectivity of layer %d has %d units, K has %d", layer, len(units), k[layer])
+		}
+		for i, inputs := range units {
+			if len(inputs) == 0 {
+				return fmt.Errorf("unit %d of layer %d has no inputs", i, layer)
+			}
+			if len(inputs) != len(units[0]) {
+				return fmt.Errorf("unit %d of layer %d has %d inputs and unit 0 has %d, every unit of a layer needs the same amount", i, layer, len(inputs), len(units[0]))
+			}
+			for _, input := range inputs {
+				source, unit := input[0], input[1]
+				if source < 0 || source >= layer {
+					return fmt.Errorf("unit %d of layer %d reads layer %d, only the layers before it can feed it", i, layer, source)
+				}
+				if unit < 0 || unit >= k[source] {
+					return fmt.Errorf("unit %d of layer %d reads unit %d of layer %d, which has %d units", i, layer, unit, source, k[source])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (tpm AdjacencyTPM) CreateStimulationStructure(k []int, n_0 int) ([]int, error) {
+	if err := tpm.Connectivity.Validate(k); err != nil {
+		return nil, err
+	}
+	h := len(k)
+	n := make([]int, h)
+
+	n[0] = n_0
+
+	for layer := 1; layer < h; layer++ {
+		n[layer] = len(tpm.Connectivity.Layers[layer-1][0])
+	}
+	return n, nil
+}
+
+func (tpm AdjacencyTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
+	new_stimulus := make([][]int, k_h)
+	for i := 0; i < k_h; i++ {
+		new_stimulus[i] = make([]int, n_h)
+		for j, input := range tpm.Connectivity.Layers[layer-1][i] {
+			new_stimulus[i][j] = outputs[input[0]][input[1]]
+		}
+	}
+
+	return new_stimulus
+}
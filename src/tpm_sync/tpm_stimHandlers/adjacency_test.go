@@ -0,0 +1,57 @@
+package tpm_stimHandlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConnectivityValidate(t *testing.T) {
+	k := []int{3, 2, 1}
+	tests := []struct {
+		name   string
+		layers [][][][2]int
+		want   string
+	}{
+		{"valid with a skip connection", [][][][2]int{{{{0, 0}, {0, 1}}, {{0, 1}, {0, 2}}}, {{{1, 0}, {0, 2}}}}, ""},
+		{"too few layers", [][][][2]int{{{{0, 0}}, {{0, 1}}}}, "connectivity describes 1 layers after the first, K has 2: [3 2 1]"},
+		{"too many layers", [][][][2]int{{{{0, 0}}, {{0, 1}}}, {{{1, 0}}}, {{{2, 0}}}}, "connectivity describes 3 layers after the first, K has 2: [3 2 1]"},
+		{"wrong unit count", [][][][2]int{{{{0, 0}}}, {{{1, 0}}}}, "connectivity of layer 1 has 1 units, K has 2"},
+		{"unit without inputs", [][][][2]int{{{}, {}}, {{{1, 0}}}}, "unit 0 of layer 1 has no inputs"},
+		{"fan-in differs from the layer N", [][][][2]int{{{{0, 0}, {0, 1}}, {{0, 2}}}, {{{1, 0}}}}, "unit 1 of layer 1 has 1 inputs and unit 0 has 2, every unit of a layer needs the same amount"},
+		{"reads its own layer", [][][][2]int{{{{0, 0}}, {{0, 1}}}, {{{2, 0}}}}, "unit 0 of layer 2 reads layer 2, only the layers before it can feed it"},
+		{"reads a negative layer", [][][][2]int{{{{-1, 0}}, {{0, 1}}}, {{{1, 0}}}}, "unit 0 of layer 1 reads layer -1, only the layers before it can feed it"},
+		{"unit past the layer", [][][][2]int{{{{0, 0}}, {{0, 3}}}, {{{1, 0}}}}, "unit 1 of layer 1 reads unit 3 of layer 0, which has 3 units"},
+		{"negative unit", [][][][2]int{{{{0, 0}}, {{0, 1}}}, {{{1, -1}}}}, "unit 0 of layer 2 reads unit -1 of layer 1, which has 2 units"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Connectivity{Layers: test.layers}.Validate(k)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != test.want {
+				t.Errorf("Validate() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdjacencyStimulus(t *testing.T) {
+	k := []int{3, 2, 1}
+	tpm := AdjacencyTPM{Connectivity: Connectivity{Layers: [][][][2]int{{{{0, 0}, {0, 1}}, {{0, 1}, {0, 2}}}, {{{1, 0}, {0, 2}}}}}}
+	n, err := tpm.CreateStimulationStructure(k, 5)
+	if err != nil {
+		t.Fatalf("CreateStimulationStructure rejected a valid connectivity: %v", err)
+	}
+	if want := []int{5, 2, 2}; !reflect.DeepEqual(n, want) {
+		t.Errorf("N = %v, want %v", n, want)
+	}
+	outputs := layerOutputs(k)
+	if got, want := tpm.CreateStimulusFromLayerOutput(outputs, 1, k[1], n[1]), [][]int{{0, 1}, {1, 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("layer 1 stimulus %v, want %v", got, want)
+	}
+	if got, want := tpm.CreateStimulusFromLayerOutput(outputs, 2, k[2], n[2]), [][]int{{100, 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("layer 2 stimulus with a skip connection %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,43 @@
 package tpm_stimHandlers
 
+import "fmt"
+
+// TPMStimulationHandlers link the layers of a TPM. CreateStimulationStructure derives the inputs of every layer, or says why
+// the hidden units can't be linked. CreateStimulusFromLayerOutput builds the stimulus of layer from the outputs
+// of the layers before it, outputs is indexed by layer and only the entries before layer are read
 type TPMStimulationHandlers interface {
-	CreateStimulationStructure(k []int, n_0 int) []int
-	CreateStimulusFromLayerOutput(outputs []int, k_h int, n_h int) [][]int
+	CreateStimulationStructure(k []int, n_0 int) ([]int, error)
+	CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int
+}
+
+// TraceConnectivity describes the wiring of any handler as a Connectivity, for code that needs to know where every input
+// comes from instead of building the stimulus. The handlers copy outputs into the stimulus, so the wiring is traced by
+// stimulating them with outputs that hold their own position. It errors when a handler does anything else with the outputs
+func TraceConnectivity(handler TPMStimulationHandlers, k []int, n []int) (Connectivity, error) {
+	h := len(k)
+	outputs := make([][]int, h)
+	var positions [][2]int
+	for layer := 0; layer < h; layer++ {
+		outputs[layer] = make([]int, k[layer])
+		for i := range outputs[layer] {
+			positions = append(positions, [2]int{layer, i})
+			outputs[layer][i] = len(positions)
+		}
+	}
+	connectivity := Connectivity{Layers: make([][][][2]int, h-1)}
+	for layer := 1; layer < h; layer++ {
+		stimulus := handler.CreateStimulusFromLayerOutput(outputs, layer, k[layer], n[layer])
+		connectivity.Layers[layer-1] = make([][][2]int, k[layer])
+		for i := 0; i < k[layer]; i++ {
+			connectivity.Layers[layer-1][i] = make([][2]int, n[layer])
+			for j := 0; j < n[layer]; j++ {
+				position := stimulus[i][j] - 1
+				if position < 0 || position >= len(positions) || positions[position][0] >= layer {
+					return Connectivity{}, fmt.Errorf("the %T handler doesn't copy the outputs of the layers before %d into its stimulus", handler, layer)
+				}
+				connectivity.Layers[layer-1][i][j] = positions[position]
+			}
+		}
+	}
+	return connectivity, nil
 }
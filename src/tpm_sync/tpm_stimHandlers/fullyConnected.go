@@ -1,8 +1,19 @@
 package tpm_stimHandlers
 
+import "tpm_sync/tpm_registry"
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{Name: "FULLY_CONNECTED", Description: "Every hidden unit after the first layer reads every output of the layer before it"},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			return FullConnectionTPM{}, nil
+		},
+	})
+}
+
 type FullConnectionTPM struct{}
 
-func (tpm FullConnectionTPM) CreateStimulationStructure(k []int, n_0 int) []int {
+func (tpm FullConnectionTPM) CreateStimulationStructure(k []int, n_0 int) ([]int, error) {
 	h := len(k)
 	n := make([]int, h)
 
@@ -11,16 +22,16 @@ func (tpm FullConnectionTPM) CreateStimulationStructure(k []int, n_0 int) []int
 	for layer := 1; layer < h; layer++ {
 		n[layer] = k[layer-1]
 	}
-	return n
+	return n, nil
 }
 
-func (tpm FullConnectionTPM) CreateStimulusFromLayerOutput(outputs []int, k_h int, n_h int) [][]int {
+func (tpm FullConnectionTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
 	new_stimulus := make([][]int, k_h)
 	for i := 0; i < k_h; i++ {
 		new_stimulus[i] = make([]int, n_h)
 		//When fully connected, the stim count is the same as the neuron count from the prev layer
 		for j := 0; j < n_h; j++ {
-			new_stimulus[i][j] = outputs[j] //So this maps outputs to inputs, 1 to 1
+			new_stimulus[i][j] = outputs[layer-1][j] //So this maps outputs to inputs, 1 to 1
 		}
 	}
 
@@ -1,23 +1,42 @@
 package tpm_stimHandlers
 
+import "tpm_sync/tpm_registry"
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{
+			Name:        "NO_OVERLAP",
+			Description: "Every hidden unit after the first layer reads its own outputs of the layer before it, the structure is given by the inputs of every layer",
+			Parameters: []tpm_registry.Parameter{
+				{Name: "n_configs", Description: "inputs of every layer"},
+				{Name: "klast_configs", Description: "hidden units of the last layer"},
+			},
+		},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			return NoOverlapTPM{}, nil
+		},
+		ReverseParameters: true,
+	})
+}
+
 type NoOverlapTPM struct{}
 
-func (tpm NoOverlapTPM) CreateStimulationStructure(n []int, k_last int) []int {
+func (tpm NoOverlapTPM) CreateStimulationStructure(n []int, k_last int) ([]int, error) {
 	h := len(n)
 	k := make([]int, h)
 	k[h-1] = k_last
 	for i := 1; i < h; i++ {
 		k[h-1-i] = n[h-i] * k[h-i]
 	}
-	return k
+	return k, nil
 }
 
-func (tpm NoOverlapTPM) CreateStimulusFromLayerOutput(outputs []int, k_h int, n_h int) [][]int {
+func (tpm NoOverlapTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
 	new_stimulus := make([][]int, k_h)
 	for i := 0; i < k_h; i++ {
 		new_stimulus[i] = make([]int, n_h)
 		for j := 0; j < n_h; j++ {
-			new_stimulus[i][j] = outputs[n_h*i+j]
+			new_stimulus[i][j] = outputs[layer-1][n_h*i+j]
 		}
 	}
 
@@ -1,8 +1,22 @@
 package tpm_stimHandlers
 
+import (
+	"fmt"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{Name: "PARTIALLY_CONNECTED", Description: "Every hidden unit after the first layer reads a sliding window of the outputs of the layer before it, which needs less units"},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			return PartialConnectionTPM{}, nil
+		},
+	})
+}
+
 type PartialConnectionTPM struct{}
 
-func (tpm PartialConnectionTPM) CreateStimulationStructure(k []int, n_0 int) []int {
+func (tpm PartialConnectionTPM) CreateStimulationStructure(k []int, n_0 int) ([]int, error) {
 	prev := -1
 	h := len(k)
 	n := make([]int, h)
@@ -13,20 +27,20 @@ func (tpm PartialConnectionTPM) CreateStimulationStructure(k []int, n_0 int) []i
 	for layer := 1; layer < h; layer++ {
 
 		if k[layer] >= prev {
-			return nil
+			return nil, fmt.Errorf("every layer needs less units than the one before it, layer %d has %d and layer %d has %d", layer, k[layer], layer-1, prev)
 		}
 		n[layer] = k[layer-1] - k[layer] + 1
 		prev = k[layer]
 	}
-	return n
+	return n, nil
 }
 
-func (tpm PartialConnectionTPM) CreateStimulusFromLayerOutput(outputs []int, k_h int, n_h int) [][]int {
+func (tpm PartialConnectionTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
 	new_stimulus := make([][]int, k_h)
 	for i := 0; i < k_h; i++ {
 		new_stimulus[i] = make([]int, n_h)
 		for j := 0; j < n_h; j++ {
-			new_stimulus[i][j] = outputs[j+i]
+			new_stimulus[i][j] = outputs[layer-1][j+i]
 		}
 	}
 
@@ -0,0 +1,80 @@
+package tpm_stimHandlers
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{
+			Name:        "RANDOM_SPARSE",
+			Description: "Every hidden unit after the first layer reads a random subset of the outputs of the layer before it, drawn once per session",
+			Parameters: []tpm_registry.Parameter{
+				{Name: "fan_in_configs", Description: "outputs read by every hidden unit, 0 means all of them"},
+				{Name: "wiring_seeds", Description: "seeds of the wiring, 0 means it comes from the session seed"},
+			},
+		},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			return RandomSparseTPM{}, nil
+		},
+	})
+}
+
+// RandomSparseTPM feeds every hidden unit after the first layer with FanIn outputs of the layer before it, picked at random.
+// A FanIn of 0 uses every output of the layer before. The wiring is drawn by Wire, which has to be called once per session
+// before any stimulus is created, so A, B and the attackers share it
+type RandomSparseTPM struct {
+	FanIn  int
+	wiring *AdjacencyTPM
+}
+
+// fanIn is the amount of inputs of every hidden unit of layer, which can't be more than the outputs of the layer before
+func (tpm RandomSparseTPM) fanIn(k []int, layer int) int {
+	if tpm.FanIn == 0 {
+		return k[layer-1]
+	}
+	return tpm.FanIn
+}
+
+func (tpm RandomSparseTPM) CreateStimulationStructure(k []int, n_0 int) ([]int, error) {
+	if tpm.FanIn < 0 {
+		return nil, fmt.Errorf("fan in can't be negative: %d", tpm.FanIn)
+	}
+	h := len(k)
+	n := make([]int, h)
+
+	n[0] = n_0
+
+	for layer := 1; layer < h; layer++ {
+		n[layer] = tpm.fanIn(k, layer)
+		if n[layer] > k[layer-1] {
+			return nil, fmt.Errorf("fan in %d is more than the %d outputs of layer %d", n[layer], k[layer-1], layer-1)
+		}
+	}
+	return n, nil
+}
+
+// Wire returns a copy of the handler with a wiring drawn from localRand, the inputs of every unit are distinct and in order
+func (tpm RandomSparseTPM) Wire(k []int, localRand *rand.Rand) RandomSparseTPM {
+	h := len(k)
+	connectivity := Connectivity{Layers: make([][][][2]int, h-1)}
+	for layer := 1; layer < h; layer++ {
+		connectivity.Layers[layer-1] = make([][][2]int, k[layer])
+		for i := 0; i < k[layer]; i++ {
+			units := localRand.Perm(k[layer-1])[:tpm.fanIn(k, layer)]
+			sort.Ints(units)
+			for _, unit := range units {
+				connectivity.Layers[layer-1][i] = append(connectivity.Layers[layer-1][i], [2]int{layer - 1, unit})
+			}
+		}
+	}
+	tpm.wiring = &AdjacencyTPM{Connectivity: connectivity}
+	return tpm
+}
+
+func (tpm RandomSparseTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
+	return tpm.wiring.CreateStimulusFromLayerOutput(outputs, layer, k_h, n_h)
+}
@@ -0,0 +1,46 @@
+package tpm_stimHandlers
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRandomSparseWire(t *testing.T) {
+	k := []int{12, 6, 3}
+	tpm := RandomSparseTPM{FanIn: 3}
+	wired := tpm.Wire(k, rand.New(rand.NewSource(1)))
+	if err := wired.wiring.Connectivity.Validate(k); err != nil {
+		t.Fatalf("the wiring isn't a valid connectivity: %v", err)
+	}
+	for layer, units := range wired.wiring.Connectivity.Layers {
+		for i, inputs := range units {
+			if len(inputs) != tpm.FanIn {
+				t.Errorf("unit %d of layer %d has %d inputs, want %d", i, layer+1, len(inputs), tpm.FanIn)
+			}
+			for j := 1; j < len(inputs); j++ {
+				if inputs[j][1] <= inputs[j-1][1] {
+					t.Errorf("the inputs of unit %d of layer %d aren't distinct and in order: %v", i, layer+1, inputs)
+				}
+			}
+		}
+	}
+
+	same := tpm.Wire(k, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(wired.wiring, same.wiring) {
+		t.Errorf("the same wiring seed gave different wirings")
+	}
+	other := tpm.Wire(k, rand.New(rand.NewSource(2)))
+	if reflect.DeepEqual(wired.wiring, other.wiring) {
+		t.Errorf("wiring seeds 1 and 2 gave the same wiring")
+	}
+	if tpm.wiring != nil {
+		t.Errorf("Wire changed the handler it was called on")
+	}
+
+	full := RandomSparseTPM{}.Wire(k, rand.New(rand.NewSource(1)))
+	outputs := layerOutputs(k)
+	if got, want := full.CreateStimulusFromLayerOutput(outputs, 1, k[1], k[0]), (FullConnectionTPM{}).CreateStimulusFromLayerOutput(outputs, 1, k[1], k[0]); !reflect.DeepEqual(got, want) {
+		t.Errorf("a fan in of 0 reads %v, want every output %v", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package tpm_stimHandlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"tpm_sync/tpm_registry"
+)
+
+// HandlerConfig holds the settings a TPM type can read to create its handler, every type ignores the ones it doesn't use
+type HandlerConfig struct {
+	Connectivity *Connectivity
+	Window       int
+	Stride       int
+	Wrap         bool
+}
+
+// HandlerFactory creates the stimulation handler of a TPM type from the settings
+type HandlerFactory func(config HandlerConfig) (TPMStimulationHandlers, error)
+
+// TPMType is a stimulation handler registered by name
+type TPMType struct {
+	tpm_registry.Capability
+	Factory HandlerFactory
+	// ReverseParameters is set when the structure is defined by the stimulus, so K is read as the N of every layer and n_0 as the last K
+	ReverseParameters bool
+}
+
+var tpmTypes = map[string]TPMType{}
+
+// Register makes a TPM type available to the settings by its name, which has to be upper case and not taken yet
+func Register(tpmType TPMType) {
+	if tpmType.Name != strings.ToUpper(tpmType.Name) {
+		panic(fmt.Sprintf("TPM type names must be upper case: %s", tpmType.Name))
+	}
+	if _, isTaken := tpmTypes[tpmType.Name]; isTaken {
+		panic(fmt.Sprintf("TPM type registered twice: %s", tpmType.Name))
+	}
+	tpmTypes[tpmType.Name] = tpmType
+}
+
+// NormalizeName is the name a TPM type is registered as, the names are case insensitive and surrounding spaces are ignored
+func NormalizeName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+// Lookup finds the TPM type registered as name, which is normalized first
+func Lookup(name string) (TPMType, bool) {
+	tpmType, isRegistered := tpmTypes[NormalizeName(name)]
+	return tpmType, isRegistered
+}
+
+// IsRegistered is true when name is the name of a registered TPM type, it is normalized like in Lookup
+func IsRegistered(name string) bool {
+	_, isRegistered := tpmTypes[NormalizeName(name)]
+	return isRegistered
+}
+
+// Capabilities lists the registered TPM types sorted by name
+func Capabilities() []tpm_registry.Capability {
+	capabilities := make([]tpm_registry.Capability, 0, len(tpmTypes))
+	for _, tpmType := range tpmTypes {
+		capabilities = append(capabilities, tpmType.Capability)
+	}
+	sort.Slice(capabilities, func(a, b int) bool {
+		return capabilities[a].Name < capabilities[b].Name
+	})
+	return capabilities
+}
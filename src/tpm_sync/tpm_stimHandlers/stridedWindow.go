@@ -0,0 +1,86 @@
+package tpm_stimHandlers
+
+import (
+	"fmt"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	Register(TPMType{
+		Capability: tpm_registry.Capability{
+			Name:        "STRIDED_WINDOW",
+			Description: "Every hidden unit after the first layer reads a window of consecutive outputs of the layer before it, the windows start a stride apart",
+			Parameters: []tpm_registry.Parameter{
+				{Name: "window_configs", Description: "outputs read by every hidden unit, 0 means the window that covers the layer before exactly"},
+				{Name: "stride_configs", Description: "distance between the windows of consecutive hidden units, 0 means 1"},
+				{Name: "window_wrap", Description: "whether the windows go around the end of the layer before"},
+			},
+		},
+		Factory: func(config HandlerConfig) (TPMStimulationHandlers, error) {
+			if config.Stride == 0 {
+				config.Stride = 1
+			}
+			return StridedWindowTPM{Window: config.Window, Stride: config.Stride, Wrap: config.Wrap}, nil
+		},
+	})
+}
+
+// StridedWindowTPM feeds every hidden unit after the first layer with a window of consecutive outputs of the layer before it,
+// the window of unit i starts at output i*Stride. A Window of 0 is the one that makes the last window end at the last output.
+// With Wrap the windows go around the end of the layer before, so they can start anywhere.
+// PartialConnectionTPM is a stride of 1 with the derived window, except that it also rejects a layer as wide as the one before it.
+// NoOverlapTPM is a stride as wide as the window when every layer after the first has the same number of inputs
+type StridedWindowTPM struct {
+	Window int
+	Stride int
+	Wrap   bool
+}
+
+// window is the width of the windows of layer, which can be derived from the units of layer and the one before it
+func (tpm StridedWindowTPM) window(k []int, layer int) int {
+	if tpm.Window == 0 {
+		return k[layer-1] - (k[layer]-1)*tpm.Stride
+	}
+	return tpm.Window
+}
+
+func (tpm StridedWindowTPM) CreateStimulationStructure(k []int, n_0 int) ([]int, error) {
+	if tpm.Stride < 1 {
+		return nil, fmt.Errorf("stride must be positive: %d", tpm.Stride)
+	}
+	if tpm.Window < 0 {
+		return nil, fmt.Errorf("window can't be negative: %d", tpm.Window)
+	}
+	h := len(k)
+	n := make([]int, h)
+
+	n[0] = n_0
+
+	for layer := 1; layer < h; layer++ {
+		window := tpm.window(k, layer)
+		needed := (k[layer]-1)*tpm.Stride + window
+		switch {
+		case window < 1:
+			return nil, fmt.Errorf("the %d units of layer %d can't cover the %d outputs of layer %d with stride %d, the window would be %d", k[layer], layer, k[layer-1], layer-1, tpm.Stride, window)
+		case tpm.Wrap && window > k[layer-1]:
+			return nil, fmt.Errorf("window %d is wider than the %d outputs of layer %d", window, k[layer-1], layer-1)
+		case !tpm.Wrap && needed > k[layer-1]:
+			return nil, fmt.Errorf("the %d units of layer %d need %d outputs of layer %d with window %d and stride %d, it has %d", k[layer], layer, needed, layer-1, window, tpm.Stride, k[layer-1])
+		}
+		n[layer] = window
+	}
+	return n, nil
+}
+
+func (tpm StridedWindowTPM) CreateStimulusFromLayerOutput(outputs [][]int, layer int, k_h int, n_h int) [][]int {
+	previous := outputs[layer-1]
+	new_stimulus := make([][]int, k_h)
+	for i := 0; i < k_h; i++ {
+		new_stimulus[i] = make([]int, n_h)
+		for j := 0; j < n_h; j++ {
+			new_stimulus[i][j] = previous[(i*tpm.Stride+j)%len(previous)]
+		}
+	}
+
+	return new_stimulus
+}
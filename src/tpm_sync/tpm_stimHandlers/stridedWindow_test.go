@@ -0,0 +1,127 @@
+package tpm_stimHandlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// layerOutputs are distinct outputs for every unit of k, so a stimulus that reads the wrong output shows
+func layerOutputs(k []int) [][]int {
+	outputs := make([][]int, len(k))
+	for layer := range k {
+		outputs[layer] = make([]int, k[layer])
+		for i := range outputs[layer] {
+			outputs[layer][i] = 100*layer + i
+		}
+	}
+	return outputs
+}
+
+// sameStimuli checks that a and b build the same stimulus for every layer after the first
+func sameStimuli(t *testing.T, a TPMStimulationHandlers, b TPMStimulationHandlers, k []int, n []int) {
+	t.Helper()
+	outputs := layerOutputs(k)
+	for layer := 1; layer < len(k); layer++ {
+		if got, want := a.CreateStimulusFromLayerOutput(outputs, layer, k[layer], n[layer]), b.CreateStimulusFromLayerOutput(outputs, layer, k[layer], n[layer]); !reflect.DeepEqual(got, want) {
+			t.Errorf("layer %d of K %v: stimulus %v, want %v", layer, k, got, want)
+		}
+	}
+}
+
+func TestStridedWindowIsPartialConnection(t *testing.T) {
+	for _, k := range [][]int{{2}, {4, 2}, {5, 1}, {7, 4, 2}, {10, 9, 3, 2}} {
+		partial, err := PartialConnectionTPM{}.CreateStimulationStructure(k, 6)
+		if err != nil {
+			t.Fatalf("PARTIALLY_CONNECTED rejected K %v: %v", k, err)
+		}
+		strided, err := StridedWindowTPM{Stride: 1}.CreateStimulationStructure(k, 6)
+		if err != nil {
+			t.Fatalf("STRIDED_WINDOW rejected K %v: %v", k, err)
+		}
+		if !reflect.DeepEqual(strided, partial) {
+			t.Errorf("K %v: STRIDED_WINDOW gives N %v, PARTIALLY_CONNECTED %v", k, strided, partial)
+		}
+		sameStimuli(t, StridedWindowTPM{Stride: 1}, PartialConnectionTPM{}, k, partial)
+	}
+	//A layer can't grow with either, but only PARTIALLY_CONNECTED rejects a layer as wide as the one before it
+	for _, k := range [][]int{{2, 3}, {4, 2, 3}} {
+		if _, err := (PartialConnectionTPM{}).CreateStimulationStructure(k, 6); err == nil {
+			t.Errorf("PARTIALLY_CONNECTED accepted K %v", k)
+		}
+		if _, err := (StridedWindowTPM{Stride: 1}).CreateStimulationStructure(k, 6); err == nil {
+			t.Errorf("STRIDED_WINDOW accepted K %v", k)
+		}
+	}
+	if n, err := (StridedWindowTPM{Stride: 1}).CreateStimulationStructure([]int{3, 3}, 6); err != nil || n[1] != 1 {
+		t.Errorf("STRIDED_WINDOW gives N %v for K [3 3], want a window of 1: %v", n, err)
+	}
+}
+
+func TestStridedWindowIsNoOverlap(t *testing.T) {
+	for _, n := range [][]int{{4}, {5, 3}, {2, 2}, {6, 3, 2}, {3, 1, 4}} {
+		k, err := NoOverlapTPM{}.CreateStimulationStructure(n, 2)
+		if err != nil {
+			t.Fatalf("NO_OVERLAP rejected N %v: %v", n, err)
+		}
+		//Every layer has its own window, so every layer gets its own handler
+		for layer := 1; layer < len(n); layer++ {
+			strided := StridedWindowTPM{Window: n[layer], Stride: n[layer]}
+			structure, err := strided.CreateStimulationStructure(k[layer-1:layer+1], n[0])
+			if err != nil {
+				t.Fatalf("STRIDED_WINDOW rejected layer %d of K %v: %v", layer, k, err)
+			}
+			if structure[1] != n[layer] {
+				t.Errorf("layer %d of K %v: STRIDED_WINDOW gives %d inputs, NO_OVERLAP %d", layer, k, structure[1], n[layer])
+			}
+			outputs := layerOutputs(k)
+			if got, want := strided.CreateStimulusFromLayerOutput(outputs, layer, k[layer], n[layer]), (NoOverlapTPM{}).CreateStimulusFromLayerOutput(outputs, layer, k[layer], n[layer]); !reflect.DeepEqual(got, want) {
+				t.Errorf("layer %d of K %v: stimulus %v, want %v", layer, k, got, want)
+			}
+		}
+	}
+}
+
+func TestStridedWindowStructureErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tpm  StridedWindowTPM
+		k    []int
+		want string
+	}{
+		{"zero stride", StridedWindowTPM{Stride: 0}, []int{4, 2}, "stride must be positive: 0"},
+		{"negative stride", StridedWindowTPM{Stride: -1}, []int{4, 2}, "stride must be positive: -1"},
+		{"negative window", StridedWindowTPM{Window: -2, Stride: 1}, []int{4, 2}, "window can't be negative: -2"},
+		{"derived window below 1", StridedWindowTPM{Stride: 2}, []int{4, 3}, "the 3 units of layer 1 can't cover the 4 outputs of layer 0 with stride 2, the window would be 0"},
+		{"wrapped window wider than the layer", StridedWindowTPM{Window: 5, Stride: 1, Wrap: true}, []int{4, 2}, "window 5 is wider than the 4 outputs of layer 0"},
+		{"windows past the layer", StridedWindowTPM{Window: 3, Stride: 2}, []int{6, 3}, "the 3 units of layer 1 need 7 outputs of layer 0 with window 3 and stride 2, it has 6"},
+		{"error in a later layer", StridedWindowTPM{Window: 2, Stride: 2}, []int{8, 4, 3}, "the 3 units of layer 2 need 6 outputs of layer 1 with window 2 and stride 2, it has 4"},
+		{"windows that fit", StridedWindowTPM{Window: 2, Stride: 2}, []int{6, 3}, ""},
+		{"wrapped windows past the layer", StridedWindowTPM{Window: 3, Stride: 2, Wrap: true}, []int{6, 3}, ""},
+		{"wrapped window as wide as the layer", StridedWindowTPM{Window: 4, Stride: 1, Wrap: true}, []int{4, 4}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.tpm.CreateStimulationStructure(test.k, 5)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != test.want {
+				t.Errorf("CreateStimulationStructure() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStridedWindowWrapsAround(t *testing.T) {
+	k := []int{6, 3}
+	tpm := StridedWindowTPM{Window: 3, Stride: 2, Wrap: true}
+	n, err := tpm.CreateStimulationStructure(k, 5)
+	if err != nil {
+		t.Fatalf("CreateStimulationStructure rejected wrapped windows: %v", err)
+	}
+	want := [][]int{{0, 1, 2}, {2, 3, 4}, {4, 5, 0}}
+	if got := tpm.CreateStimulusFromLayerOutput(layerOutputs(k), 1, k[1], n[1]); !reflect.DeepEqual(got, want) {
+		t.Errorf("stimulus %v, want %v", got, want)
+	}
+}
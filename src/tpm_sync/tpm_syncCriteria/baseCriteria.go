@@ -0,0 +1,65 @@
+package tpm_syncCriteria
+
+import "tpm_sync/tpm_core"
+
+// TPMSyncCriterion decides when A and B, and every other party of a group session, are considered synchronized, it's checked before every iteration
+type TPMSyncCriterion interface {
+	IsSynced(progress SyncProgress) bool
+}
+
+// SyncProgress is the state of a session that the criteria can look at
+type SyncProgress struct {
+	H                  int
+	K                  []int
+	N                  []int
+	Weights_A          [][][]int
+	Weights_B          [][][]int
+	Weights_Group      [][][][]int //Parties after A and B, only in group sessions
+	ConsecutiveMatches int         //Iterations in a row where the outputs of all parties matched
+}
+
+// parties lists the weights of every party, A and B first
+func (progress SyncProgress) parties() [][][][]int {
+	return append([][][][]int{progress.Weights_A, progress.Weights_B}, progress.Weights_Group...)
+}
+
+// ExactWeightsCriterion stops when every weight of every party is the same
+type ExactWeightsCriterion struct{}
+
+// OverlapCriterion stops when the normalized overlap of every pair of parties reaches the threshold
+type OverlapCriterion struct {
+	Threshold float64
+}
+
+// ConsecutiveOutputsCriterion stops after Count iterations in a row with matching outputs, as done by practical protocols
+// since the parties can't compare their weights
+type ConsecutiveOutputsCriterion struct {
+	Count int
+}
+
+func (criterion ExactWeightsCriterion) IsSynced(progress SyncProgress) bool {
+	//Equality is transitive, so comparing everyone against A is enough
+	parties := progress.parties()
+	for party := 1; party < len(parties); party++ {
+		if !tpm_core.CompareWeights(progress.H, progress.K, progress.N, parties[0], parties[party]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (criterion OverlapCriterion) IsSynced(progress SyncProgress) bool {
+	parties := progress.parties()
+	for i := 0; i < len(parties); i++ {
+		for j := i + 1; j < len(parties); j++ {
+			if tpm_core.NetworkOverlap(progress.H, progress.K, progress.N, parties[i], parties[j]) < criterion.Threshold {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (criterion ConsecutiveOutputsCriterion) IsSynced(progress SyncProgress) bool {
+	return progress.ConsecutiveMatches >= criterion.Count
+}
@@ -0,0 +1,79 @@
+package tpm_syncCriteria
+
+import (
+	"testing"
+	"tpm_sync/tpm_core"
+)
+
+// progressOf is the progress of one layer with one hidden unit of two inputs, the first two weights are A and B
+func progressOf(weights ...[]int) SyncProgress {
+	progress := SyncProgress{H: 1, K: []int{1}, N: []int{2}}
+	for party, w := range weights {
+		layers := [][][]int{{w}}
+		switch party {
+		case 0:
+			progress.Weights_A = layers
+		case 1:
+			progress.Weights_B = layers
+		default:
+			progress.Weights_Group = append(progress.Weights_Group, layers)
+		}
+	}
+	return progress
+}
+
+func TestExactWeightsCriterion(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress SyncProgress
+		want     bool
+	}{
+		{"same weights", progressOf([]int{1, -2}, []int{1, -2}), true},
+		{"one weight differs", progressOf([]int{1, -2}, []int{1, 2}), false},
+		{"same group", progressOf([]int{1, -2}, []int{1, -2}, []int{1, -2}), true},
+		{"third party differs", progressOf([]int{1, -2}, []int{1, -2}, []int{0, -2}), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (ExactWeightsCriterion{}).IsSynced(test.progress); got != test.want {
+				t.Errorf("IsSynced() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOverlapCriterion(t *testing.T) {
+	//[1 0] and [1 1] have an overlap of 1/√2
+	pair := progressOf([]int{1, 0}, []int{1, 1})
+	overlap := tpm_core.NetworkOverlap(pair.H, pair.K, pair.N, pair.Weights_A, pair.Weights_B)
+	tests := []struct {
+		name      string
+		progress  SyncProgress
+		threshold float64
+		want      bool
+	}{
+		{"at the threshold", pair, overlap, true},
+		{"above the threshold", pair, 0.7, true},
+		{"below the threshold", pair, 0.71, false},
+		{"same weights", progressOf([]int{1, 0}, []int{1, 0}), 1, true},
+		//A and B are the same, but B and the third party are as far apart as the pair
+		{"group pair below the threshold", progressOf([]int{1, 1}, []int{1, 1}, []int{1, 0}), 0.71, false},
+		{"group pairs at the threshold", progressOf([]int{1, 1}, []int{1, 1}, []int{1, 0}), overlap, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (OverlapCriterion{Threshold: test.threshold}).IsSynced(test.progress); got != test.want {
+				t.Errorf("IsSynced() with threshold %v = %v, want %v", test.threshold, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConsecutiveOutputsCriterion(t *testing.T) {
+	criterion := ConsecutiveOutputsCriterion{Count: 3}
+	for matches, want := range []bool{false, false, false, true, true} {
+		if got := criterion.IsSynced(SyncProgress{ConsecutiveMatches: matches}); got != want {
+			t.Errorf("IsSynced() after %d matches = %v, want %v", matches, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tpm_variants
+
+import (
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_registry"
+	"tpm_sync/tpm_stimHandlers"
+)
+
+// TPMNeuronHandler is how the hidden units of a layer compute their outputs and learn. Every input of a unit takes
+// InputWidth entries of the weight and stimulus rows, so the rows are n = inputs * InputWidth long.
+// The numerics break the ties of the sign units, the variants without sign units ignore them
+type TPMNeuronHandler interface {
+	InputWidth() int
+	StimulateLayer(numerics tpm_core.Numerics, stimulus [][]int, weights [][]int, k int, n int) []int
+	Thau(outputs []int, k int) int
+	LearnLayer(learnRule tpm_learnRules.TPMLearnRuleHandler, k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int)
+}
+
+// BinaryNeurons are the usual sign units with integer weights
+type BinaryNeurons struct{}
+
+func (neurons BinaryNeurons) InputWidth() int {
+	return 1
+}
+
+func (neurons BinaryNeurons) StimulateLayer(numerics tpm_core.Numerics, stimulus [][]int, weights [][]int, k int, n int) []int {
+	return numerics.StimulateLayer(stimulus, weights, k, n)
+}
+
+func (neurons BinaryNeurons) Thau(outputs []int, k int) int {
+	return tpm_core.Thau(outputs, k)
+}
+
+func (neurons BinaryNeurons) LearnLayer(learnRule tpm_learnRules.TPMLearnRuleHandler, k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	learnRule.TPMLearnLayer(k, n, l, weights, stimulus, outputs, output_a, output_b)
+}
+
+var variantNeurons = map[string]func() TPMNeuronHandler{}
+
+// RegisterVariant makes a TPM type with its own neurons available to the settings. The variants have a single hidden layer,
+// so they are registered as fully connected TPM types whose handler never links layers
+func RegisterVariant(capability tpm_registry.Capability, neurons func() TPMNeuronHandler) {
+	tpm_stimHandlers.Register(tpm_stimHandlers.TPMType{
+		Capability: capability,
+		Factory: func(config tpm_stimHandlers.HandlerConfig) (tpm_stimHandlers.TPMStimulationHandlers, error) {
+			return tpm_stimHandlers.FullConnectionTPM{}, nil
+		},
+	})
+	variantNeurons[capability.Name] = neurons
+}
+
+// Neurons creates the neurons of a TPM type, which is normalized like in tpm_stimHandlers.Lookup. It returns false for the types that use BinaryNeurons
+func Neurons(tpmType string) (TPMNeuronHandler, bool) {
+	neurons, isVariant := variantNeurons[tpm_stimHandlers.NormalizeName(tpmType)]
+	if !isVariant {
+		return BinaryNeurons{}, false
+	}
+	return neurons(), true
+}
@@ -0,0 +1,85 @@
+package tpm_variants
+
+import (
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_registry"
+)
+
+func init() {
+	RegisterVariant(tpm_registry.Capability{
+		Name:        "COMPLEX_VALUED",
+		Description: "Single layer TPM with complex weights and stimuli, the real and imaginary signs of the local fields are learned separately",
+	}, func() TPMNeuronHandler {
+		return ComplexNeurons{}
+	})
+}
+
+// ComplexNeurons have complex weights and stimuli, every row holds the real parts first and the imaginary parts after.
+// The local field is the sum of the products of weights and stimuli, and a unit outputs the signs of its real and
+// imaginary parts. The output of the network is the parity of the real signs and the parity of the imaginary signs
+type ComplexNeurons struct{}
+
+// EncodeComplexOutput packs a pair of signs in one int: sigma_r + 2*sigma_i
+func EncodeComplexOutput(sigma_r int, sigma_i int) int {
+	return sigma_r + 2*sigma_i
+}
+
+func DecodeComplexOutput(output int) (int, int) {
+	sigma_i := tpm_core.OutputSigma(float64(output))
+	return output - 2*sigma_i, sigma_i
+}
+
+func (neurons ComplexNeurons) InputWidth() int {
+	return 2
+}
+
+func (neurons ComplexNeurons) StimulateLayer(numerics tpm_core.Numerics, stimulus [][]int, weights [][]int, k int, n int) []int {
+	inputs := n / 2
+	layerOutputs := make([]int, k)
+	for i := 0; i < k; i++ {
+		field_r, field_i := 0, 0
+		for j := 0; j < inputs; j++ {
+			a, b := weights[i][j], weights[i][inputs+j]
+			c, d := stimulus[i][j], stimulus[i][inputs+j]
+			field_r += a*c - b*d
+			field_i += a*d + b*c
+		}
+		layerOutputs[i] = EncodeComplexOutput(numerics.Sign(field_r), numerics.Sign(field_i))
+	}
+	return layerOutputs
+}
+
+func (neurons ComplexNeurons) Thau(outputs []int, k int) int {
+	thau_r, thau_i := 1, 1
+	for i := 0; i < k; i++ {
+		sigma_r, sigma_i := DecodeComplexOutput(outputs[i])
+		thau_r *= sigma_r
+		thau_i *= sigma_i
+	}
+	return EncodeComplexOutput(thau_r, thau_i)
+}
+
+// LearnLayer learns the real and the imaginary part separately. Moving the weights along the gradient of the real part
+// of the field means adding (c, -d) to (a, b), and along the gradient of the imaginary part means adding (d, c)
+func (neurons ComplexNeurons) LearnLayer(learnRule tpm_learnRules.TPMLearnRuleHandler, k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	inputs := n / 2
+	sigmas_r := make([]int, k)
+	sigmas_i := make([]int, k)
+	realGradient := make([][]int, k)
+	imaginaryGradient := make([][]int, k)
+	for i := 0; i < k; i++ {
+		sigmas_r[i], sigmas_i[i] = DecodeComplexOutput(outputs[i])
+		realGradient[i] = make([]int, n)
+		imaginaryGradient[i] = make([]int, n)
+		for j := 0; j < inputs; j++ {
+			c, d := stimulus[i][j], stimulus[i][inputs+j]
+			realGradient[i][j], realGradient[i][inputs+j] = c, -d
+			imaginaryGradient[i][j], imaginaryGradient[i][inputs+j] = d, c
+		}
+	}
+	thau_ra, thau_ia := DecodeComplexOutput(output_a)
+	thau_rb, thau_ib := DecodeComplexOutput(output_b)
+	learnRule.TPMLearnLayer(k, n, l, weights, realGradient, sigmas_r, thau_ra, thau_rb)
+	learnRule.TPMLearnLayer(k, n, l, weights, imaginaryGradient, sigmas_i, thau_ia, thau_ib)
+}
@@ -0,0 +1,76 @@
+package tpm_variants
+
+import (
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+	"tpm_sync/tpm_registry"
+)
+
+// DefaultOutputClasses is the amount of classes of a VECTOR_VALUED TPM when the settings don't set it
+const DefaultOutputClasses = 3
+
+func init() {
+	RegisterVariant(tpm_registry.Capability{
+		Name:        "VECTOR_VALUED",
+		Description: "Single layer TPM whose hidden units output the class with the largest local field, every input has one weight per class",
+		Parameters:  []tpm_registry.Parameter{{Name: "output_classes", Description: "classes of every hidden unit, 3 by default"}},
+	}, func() TPMNeuronHandler {
+		return VectorNeurons{Classes: DefaultOutputClasses}
+	})
+}
+
+// VectorNeurons output one of Classes classes. Every input has one weight and one stimulus per class, the rows are
+// laid out class by class. A unit outputs the class with the largest local field, ties going to the lowest class,
+// and the output of the network is the sum of the classes modulo Classes, which is the parity when Classes is 2
+type VectorNeurons struct {
+	Classes int
+}
+
+func (neurons VectorNeurons) InputWidth() int {
+	return neurons.Classes
+}
+
+// StimulateLayer ignores the numerics, there are no signs to break
+func (neurons VectorNeurons) StimulateLayer(numerics tpm_core.Numerics, stimulus [][]int, weights [][]int, k int, n int) []int {
+	inputs := n / neurons.Classes
+	layerOutputs := make([]int, k)
+	for i := 0; i < k; i++ {
+		bestField := 0
+		for class := 0; class < neurons.Classes; class++ {
+			field := 0
+			for j := class * inputs; j < (class+1)*inputs; j++ {
+				field += weights[i][j] * stimulus[i][j]
+			}
+			if class == 0 || field > bestField {
+				bestField = field
+				layerOutputs[i] = class
+			}
+		}
+	}
+	return layerOutputs
+}
+
+func (neurons VectorNeurons) Thau(outputs []int, k int) int {
+	sum := 0
+	for i := 0; i < k; i++ {
+		sum += outputs[i]
+	}
+	return sum % neurons.Classes
+}
+
+// LearnLayer is the update of the vector-valued TPM of Jeong et al., "Neural Cryptography Based on Generalized Tree
+// Parity Machine for Real-Life Systems" (2021): when the outputs of the networks agree, every unit applies the learn
+// rule to the weights of its winning class. A class can't be compared with the output like a sign, so no unit is left out
+func (neurons VectorNeurons) LearnLayer(learnRule tpm_learnRules.TPMLearnRuleHandler, k int, n int, l int, weights [][]int, stimulus [][]int, outputs []int, output_a int, output_b int) {
+	if output_a != output_b {
+		return
+	}
+	inputs := n / neurons.Classes
+	for i := 0; i < k; i++ {
+		//The class weights are a view of the row, so the rule updates them in place
+		start := outputs[i] * inputs
+		classWeights := [][]int{weights[i][start : start+inputs]}
+		classStimulus := [][]int{stimulus[i][start : start+inputs]}
+		learnRule.TPMLearnLayer(1, inputs, l, classWeights, classStimulus, []int{1}, 1, 1)
+	}
+}
@@ -0,0 +1,60 @@
+package tpm_variants
+
+import (
+	"reflect"
+	"testing"
+
+	"tpm_sync/tpm_core"
+	"tpm_sync/tpm_learnRules"
+)
+
+// The rows of vectorWeights hold 2 inputs for each of 3 classes, with vectorStimulus the class fields of the units are
+// (1, 4, 0), (2, 0, -1) and (0, 1, 3), so they output the classes 1, 0 and 2 and the network outputs 0
+var (
+	vectorWeights  = [][]int{{1, 0, 2, 2, 0, 0}, {1, 1, 0, 0, -1, 0}, {0, 0, 1, 0, 1, 2}}
+	vectorStimulus = [][]int{{1, 1, 1, 1, 1, 1}, {1, 1, 1, 1, 1, 1}, {1, 1, 1, 1, 1, 1}}
+)
+
+func copyRows(rows [][]int) [][]int {
+	copied := make([][]int, len(rows))
+	for i := range rows {
+		copied[i] = append([]int(nil), rows[i]...)
+	}
+	return copied
+}
+
+func TestVectorOutputs(t *testing.T) {
+	neurons := VectorNeurons{Classes: 3}
+	outputs := neurons.StimulateLayer(tpm_core.Numerics{}, vectorStimulus, vectorWeights, 3, 6)
+	if want := []int{1, 0, 2}; !reflect.DeepEqual(outputs, want) {
+		t.Fatalf("StimulateLayer = %v, want %v", outputs, want)
+	}
+	if got := neurons.Thau(outputs, 3); got != 0 {
+		t.Errorf("Thau = %d, want 0", got)
+	}
+	tied := [][]int{{1, 0, 1, 0, 0, 0}}
+	if got := neurons.StimulateLayer(tpm_core.Numerics{}, vectorStimulus[:1], tied, 1, 6); got[0] != 0 {
+		t.Errorf("a tie between classes 0 and 1 outputs class %d, want 0", got[0])
+	}
+}
+
+// TestVectorLearnLayer checks that every unit learns the weights of its winning class when the outputs agree, also the
+// units whose class differs from the output of the network
+func TestVectorLearnLayer(t *testing.T) {
+	neurons := VectorNeurons{Classes: 3}
+	rule := tpm_learnRules.HebbianLearnRule{Params: tpm_learnRules.Params{Step: 1, Probability: 1}}
+	outputs := []int{1, 0, 2}
+
+	weights := copyRows(vectorWeights)
+	neurons.LearnLayer(rule, 3, 6, 3, weights, vectorStimulus, outputs, 0, 0)
+	want := [][]int{{1, 0, 3, 3, 0, 0}, {2, 2, 0, 0, -1, 0}, {0, 0, 1, 0, 2, 3}}
+	if !reflect.DeepEqual(weights, want) {
+		t.Errorf("LearnLayer with agreeing outputs gives %v, want %v", weights, want)
+	}
+
+	weights = copyRows(vectorWeights)
+	neurons.LearnLayer(rule, 3, 6, 3, weights, vectorStimulus, outputs, 0, 2)
+	if !reflect.DeepEqual(weights, vectorWeights) {
+		t.Errorf("LearnLayer with disagreeing outputs moved the weights to %v", weights)
+	}
+}